@@ -6,15 +6,22 @@ import (
 	"io/ioutil"
 	"os"
 
+	"github.com/chain/txvm/protocol/txvm/analyzer"
 	"github.com/chain/txvm/protocol/txvm/asm"
+	"github.com/chain/txvm/protocol/txvm/op"
 )
 
 func main() {
 	doDisasm := flag.Bool("d", false, "disassemble")
+	doCheck := flag.Bool("check", false, "check the program for stack errors instead of assembling it")
+	isContract := flag.Bool("contract", false, "with -check, check the program as a contract rather than a transaction")
 	flag.Parse()
-	if *doDisasm {
+	switch {
+	case *doDisasm:
 		disassemble()
-	} else {
+	case *doCheck:
+		check(*isContract)
+	default:
 		assemble()
 	}
 }
@@ -42,3 +49,53 @@ func disassemble() {
 	}
 	fmt.Println(dis)
 }
+
+func check(isContract bool) {
+	src, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		panic(err)
+	}
+	m, err := asm.AssembleWithSourceMap(string(src))
+	if err != nil {
+		panic(err)
+	}
+	var r *analyzer.Report
+	if isContract {
+		r = analyzer.AnalyzeContract(m.Prog, analyzer.Diagrams(m))
+	} else {
+		r = analyzer.AnalyzeTx(m.Prog, analyzer.Diagrams(m))
+	}
+	for _, p := range r.Problems {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", position(m, p), p.Err)
+	}
+	for _, p := range r.Notes {
+		fmt.Fprintf(os.Stderr, "%s: note: %s\n", position(m, p), p.Err)
+	}
+	if len(r.Problems) > 0 {
+		os.Exit(1)
+	}
+}
+
+// position returns the source line and column of the instruction a
+// problem refers to, or of the stack diagram it refers to. A problem
+// at the end of a program is reported at its last instruction.
+func position(m *asm.SourceMap, p *analyzer.Problem) string {
+	if p.Diagram != nil {
+		return fmt.Sprintf("%d:%d", p.Diagram.Line, p.Diagram.Col)
+	}
+	pc := p.PC
+	if pc == int64(len(p.Prog)) {
+		for last := int64(0); last < int64(len(p.Prog)); {
+			pc = last
+			_, _, n, err := op.DecodeInst(p.Prog[last:])
+			if err != nil {
+				break
+			}
+			last += n
+		}
+	}
+	if inst, ok := m.Lookup(p.Prog, pc); ok {
+		return fmt.Sprintf("%d:%d", inst.Line, inst.Col)
+	}
+	return fmt.Sprintf("pc %d", p.PC)
+}
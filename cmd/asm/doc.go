@@ -5,12 +5,30 @@ Command asm assembles and disassembles
 Usage:
 
 	asm [-d] <program
+	asm -check [-contract] <program
 
 By default, asm assembles a binary code from a TxVM assembly language.
 
 Flag -d inverts the behavior: the binary code is read from stdin,
 and the TxVM assembly is printed to stdout.
 
+Flag -check reads assembly language and, instead of assembling it,
+checks the program for stack underflows, items of the wrong type,
+and residue left on the stacks, as described in package
+github.com/chain/txvm/protocol/txvm/analyzer. Each problem found is
+printed to stderr with its line and column, and asm exits with
+status 1 if there are any. Places where the analysis could not
+follow the program are printed too, as notes. By default the program
+is checked as a transaction program, which starts and must end with
+empty stacks; flag -contract checks it as a contract program, which
+starts with its inputs on the stacks.
+
+With -check, stack diagrams in comments (see package
+github.com/chain/txvm/protocol/txvm/asm) are checked too: after each
+line with a diagram, the stacks must have the items the diagram
+shows. Disagreements are printed with the line and column of the
+diagram.
+
 Examples:
 
 	$ echo "[1 verify] contract call" | asm | hex
@@ -19,5 +37,11 @@ Examples:
 	$ echo "6101303833" | hex -d | asm -d
 	[1 verify] contract call
 
+	$ echo "[get verify] contract call" | asm -check
+	1:2: get: argument stack has 0 items, want 1: stack underflow
+
+	$ printf '      # Contract stack\n1 2   # [1]\nadd verify\n' | asm -check
+	2:7: line 2: contract stack: diagram shows [1], stack has 2 items [1 2]: stack diagram disagrees with program
+
 */
 package main
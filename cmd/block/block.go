@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"encoding/hex"
 	"flag"
 	"fmt"
@@ -15,6 +16,7 @@ import (
 	"github.com/chain/txvm/crypto/ed25519"
 	"github.com/chain/txvm/protocol"
 	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/merkle"
 	"github.com/chain/txvm/protocol/state"
 	"github.com/chain/txvm/protocol/validation"
 )
@@ -24,6 +26,7 @@ var modes = map[string]func([]string){
 	"hash":     hash,
 	"header":   header,
 	"new":      newBlock,
+	"proof":    proof,
 	"sign":     sign,
 	"tx":       tx,
 	"validate": validate,
@@ -374,6 +377,107 @@ func tx(args []string) {
 	os.Stdout.Write(tx.Program)
 }
 
+func proof(args []string) {
+	fs := flag.NewFlagSet("proof", flag.PanicOnError)
+
+	var (
+		verify    = fs.Bool("verify", false, "verify a proof instead of producing one")
+		headerHex = fs.String("header", "", "block header to verify against (hex)")
+	)
+
+	err := fs.Parse(args)
+	must(err)
+
+	if *verify {
+		verifyProof(*headerHex)
+		return
+	}
+
+	args = fs.Args()
+	if len(args) < 1 {
+		usage()
+	}
+
+	idx, err := strconv.Atoi(args[0])
+	must(err)
+
+	inp, err := ioutil.ReadAll(os.Stdin)
+	must(err)
+
+	var b bc.Block
+	err = b.FromBytes(inp)
+	must(err)
+
+	if idx < 0 || idx >= len(b.Transactions) {
+		panic("index out of range")
+	}
+
+	path, err := bc.TxInclusionProof(b.UnsignedBlock, idx)
+	must(err)
+
+	fmt.Printf("commitment %x\n", bc.NewCommitmentsTx(b.Transactions[idx]).WitnessCommitment)
+	for _, a := range path {
+		side := "left"
+		if a.RightOperator {
+			side = "right"
+		}
+		fmt.Printf("%s %x\n", side, a.Val[:])
+	}
+}
+
+func verifyProof(headerHex string) {
+	if headerHex == "" {
+		fmt.Fprintln(os.Stderr, "block header not supplied")
+		os.Exit(1)
+	}
+	headerBytes, err := hex.DecodeString(headerHex)
+	must(err)
+
+	var bh bc.BlockHeader
+	err = proto.Unmarshal(headerBytes, &bh)
+	must(err)
+
+	var (
+		commitment []byte
+		path       []merkle.AuditHash
+	)
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			panic(fmt.Errorf("malformed proof line %q", scanner.Text()))
+		}
+		val, err := hex.DecodeString(fields[1])
+		must(err)
+		switch fields[0] {
+		case "commitment":
+			commitment = val
+		case "left", "right":
+			if len(val) != 32 {
+				panic(fmt.Errorf("bad hash length %d, want 32", len(val)))
+			}
+			a := merkle.AuditHash{RightOperator: fields[0] == "right"}
+			copy(a.Val[:], val)
+			path = append(path, a)
+		default:
+			panic(fmt.Errorf("unknown proof line type %q", fields[0]))
+		}
+	}
+	must(scanner.Err())
+
+	if commitment == nil {
+		fmt.Fprintln(os.Stderr, "proof has no commitment")
+		os.Exit(1)
+	}
+	if !bc.VerifyTxInclusion(&bh, commitment, path) {
+		fmt.Fprintln(os.Stderr, "proof does not match block header")
+		os.Exit(1)
+	}
+}
+
 func must(err error) {
 	if err != nil {
 		panic(err)
@@ -386,6 +490,8 @@ func usage() {
 	fmt.Fprintln(os.Stderr, "  block hash <BLOCK_OR_HEADER")
 	fmt.Fprintln(os.Stderr, "  block header [-pretty] <BLOCK")
 	fmt.Fprintln(os.Stderr, "  block tx [-raw] [-pretty] INDEX <BLOCK")
+	fmt.Fprintln(os.Stderr, "  block proof INDEX <BLOCK >PROOF")
+	fmt.Fprintln(os.Stderr, "  block proof -verify -header HEADERHEX <PROOF")
 	fmt.Fprintln(os.Stderr, "  block new [-quorum QUORUM] [-time TIME] PUBKEYHEX PUBKEYHEX ... >BLOCK")
 	fmt.Fprintln(os.Stderr, "  block build [-time TIME] [-snapout FILE] TXFILE TXFILE ... <SNAPSHOT >BLOCK")
 	fmt.Fprintln(os.Stderr, "  block sign -prev PREVHEX PRVHEX PRVHEX ... <BLOCK >BLOCK")
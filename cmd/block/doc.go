@@ -6,6 +6,8 @@ operations on them.
 Usage:
 
 	block tx [-raw|-pretty] INDEX <BLOCK
+	block proof INDEX <BLOCK >PROOF
+	block proof -verify -header HEADERHEX <PROOF
 	block header [-pretty] <BLOCK
 	block validate [-prev PREVHEX] [-noprev] [-nosig] <BLOCK
 	block new [-quorum QUORUM] [-time TIME] PUBKEYHEX PUBKEYHEX ... >BLOCK
@@ -21,6 +23,18 @@ serialization of the txwitness triple (version, runlimit, and
 program). With -pretty the output is a human-readable version of the
 txwitness triple.
 
+The proof subcommand produces a proof that the transaction with the
+given index (zero-based) is committed to by the block's
+TransactionsRoot. The proof is text: a line "commitment HEX" giving
+the transaction's witness commitment (its ID followed by the hash of
+its version, runlimit, and program), then one line per merkle audit
+hash, from the leaf up, each "left HEX" or "right HEX" according to
+which side of the concatenation the hash goes on. With -verify, block
+instead reads such a proof and checks it against the block header
+given by HEADERHEX (as produced by the header subcommand, in
+hex). It exits with status 0 if the proof is valid and 1 if it is not.
+Only the header is needed, not the block.
+
 The header subcommand causes block to extract and output the block's
 header. The default output is the serialized bytes of the raw
 header. With -pretty the output is a human-readable version of the
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/chain/txvm/protocol/txvm"
+	"github.com/chain/txvm/protocol/txvm/debugger"
+	"github.com/chain/txvm/protocol/txvm/op"
+)
+
+const debugHelp = `Commands:
+  s, step          execute one instruction, stepping into call and exec
+  n, next          execute one instruction, stepping over call and exec
+  o, out           run until the current program returns
+  c, continue      run until a breakpoint or the end of the program
+  b, break PC      break at PC in the current program
+  b, break OPNAME  break before every OPNAME instruction
+  clear            remove all breakpoints
+  p, print         show the stacks, contract seed, and log
+  l, list          list the current program
+  q, quit          run to the end of the program, ignoring breakpoints
+An empty line repeats the previous command.
+`
+
+func debug() {
+	var fs flag.FlagSet
+	readWitness := witnessFlags(&fs)
+	srcFile := fs.String("src", "", "assembly-language source of the program")
+	err := fs.Parse(args)
+	must(err)
+	args = fs.Args()
+	if len(args) != 1 {
+		usage()
+	}
+	f, err := os.Open(args[0])
+	must(err)
+	prog, version, runlimit := readWitness(f)
+	f.Close()
+
+	d := debugger.New(prog, version, runlimit)
+	if *srcFile != "" {
+		d.Source = loadSource(*srcFile, prog)
+	}
+	st, err := d.Start()
+	must(err)
+	showState(st)
+
+	var (
+		in      = bufio.NewScanner(os.Stdin)
+		lastCmd string
+	)
+	for st != nil {
+		fmt.Print("(txvm) ")
+		if !in.Scan() {
+			break
+		}
+		line := strings.TrimSpace(in.Text())
+		if line == "" {
+			line = lastCmd
+		}
+		lastCmd = line
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "s", "step":
+			st = d.Step()
+			showState(st)
+		case "n", "next":
+			st = d.StepOver()
+			showState(st)
+		case "o", "out":
+			st = d.StepOut()
+			showState(st)
+		case "c", "continue":
+			st = d.Continue()
+			showState(st)
+		case "b", "break":
+			if len(fields) != 2 {
+				fmt.Println("usage: break PC|OPNAME")
+				continue
+			}
+			if pc, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+				d.BreakAt(st.Program, pc)
+			} else if opcode, ok := op.Code(fields[1]); ok {
+				d.BreakOn(opcode)
+			} else {
+				fmt.Printf("unknown instruction %q\n", fields[1])
+			}
+		case "clear":
+			d.ClearBreakpoints()
+		case "p", "print":
+			printState(st)
+		case "l", "list":
+			lines, err := debugger.Listing(st.Program)
+			for _, l := range lines {
+				marker := " "
+				if l.PC == st.PC {
+					marker = ">"
+				}
+				fmt.Printf("%s %4d  %s\n", marker, l.PC, l.Instruction)
+			}
+			if err != nil {
+				fmt.Println(err)
+			}
+		case "q", "quit":
+			d.Finish()
+			st = nil
+		case "h", "help":
+			fmt.Print(debugHelp)
+		default:
+			fmt.Printf("unknown command %q; type \"help\" for a list\n", fields[0])
+		}
+	}
+
+	if st != nil {
+		// Standard input ended while the program was paused.
+		d.Finish()
+		fmt.Println()
+	}
+	vm, err := d.Result()
+	if err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+	if vm.Finalized {
+		fmt.Printf("finished, txid %x\n", vm.TxID[:])
+	} else {
+		fmt.Println("finished")
+	}
+}
+
+func showState(st *debugger.State) {
+	if st == nil {
+		return
+	}
+	fmt.Printf("vm %d pc %d: %s", st.Depth, st.PC, st.Instruction)
+	if st.Source != "" {
+		fmt.Printf("  (%s)", st.Source)
+	}
+	fmt.Println()
+}
+
+func printState(st *debugger.State) {
+	fmt.Printf("contract %x\n", st.Seed)
+	fmt.Printf("runlimit %d\n", st.Runlimit)
+	printStack("con stack", st.Stack)
+	printStack("arg stack", st.ArgStack)
+	if len(st.Log) > 0 {
+		fmt.Println("log:")
+		for i, t := range st.Log {
+			fmt.Printf("  %d: %s\n", i, t)
+		}
+	}
+}
+
+// printStack prints the items of s top first, as txvm.Trace does.
+func printStack(name string, s []txvm.Data) {
+	if len(s) == 0 {
+		return
+	}
+	fmt.Printf("%s:\n", name)
+	for i := len(s) - 1; i >= 0; i-- {
+		fmt.Printf("  %d: %s\n", len(s)-1-i, s[i])
+	}
+}
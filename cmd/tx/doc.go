@@ -7,15 +7,16 @@ Usage:
 
 	tx SUBCOMMAND ...args...
 
-Available subcommands are: id, validate, trace, log, result, build.
+Available subcommands are: id, validate, estimate, profile, trace,
+debug, log, result, build.
 
-All subcommands except build expect a transaction program on standard
-input, assigning it a default version of 3 and a default runlimit of
-2^63-1. The -runlimit and -version flags can override those default
-values. These subcommands also accept a -witness flag tells tx to
-expect a transaction witness tuple on standard input instead (such as
-can be produced with the "block tx -raw" command, qv), which dictates
-the version and runlimit.
+All subcommands except build and debug expect a transaction program
+on standard input, assigning it a default version of 3 and a default
+runlimit of 2^63-1. The -runlimit and -version flags can override
+those default values. These subcommands also accept a -witness flag
+tells tx to expect a transaction witness tuple on standard input
+instead (such as can be produced with the "block tx -raw" command,
+qv), which dictates the version and runlimit.
 
 The id subcommand causes tx to compute the transaction's ID and send
 it to standard output. Errors in the transaction beyond the "finalize"
@@ -24,8 +25,59 @@ instruction are not detected.
 The validate subcommand causes tx to validate the transaction. Exit
 value 0 means the transaction is valid, non-zero means it is not.
 
+The estimate subcommand runs the transaction and reports the smallest
+runlimit with which it is valid (ignoring -runlimit), followed by a
+breakdown of the runlimit consumed before and after its "finalize"
+instruction and by its checksig instructions (the checksig figure is
+included in the other two). Exit value 0 means the transaction is
+valid given that runlimit, non-zero means it is not valid with any.
+
+The profile subcommand runs the transaction and prints a table of the
+runlimit consumed by each instruction, most expensive first: its own
+("flat") consumption and its share of the total, its consumption
+including the instructions nested in it ("cum"; for instance the
+instructions of a contract it calls), the number of times it ran, its
+run depth, pc, and opcode, and the seed of the contract running it.
+With -pprof FILE, the profile is also written to FILE in the format
+read by "go tool pprof", in which each contract is a function and
+each pc a line number. If the transaction fails, the profile is of
+the instructions run up to the failure, and the exit value is
+non-zero.
+
 The trace subcommand causes an execution trace of the tx to be sent to
-standard output.
+standard output. With -src FILE, where FILE holds the assembly-language
+source of the transaction program, each instruction in the trace is
+followed by the source line that produced it. With -json, the trace
+is instead a sequence of JSON objects, one per line, each describing
+the VM just before one instruction executes: its run depth, pc,
+opcode, immediate data, remaining runlimit, contract seed, contract
+and argument stacks, and any entries the instruction adds to the
+transaction log. The -src and -json flags cannot be combined.
+
+The debug subcommand runs the tx under an interactive debugger. It is
+used like this:
+
+	tx debug [-witness] [-runlimit N] [-version N] [-src FILE] PROGFILE
+
+where PROGFILE holds the transaction program (or witness tuple). If
+-src is given, FILE holds the program's assembly-language source, and
+the debugger shows the source line for each instruction.
+Debugger commands are read from standard input, one per line:
+
+	s, step          execute one instruction, stepping into call and exec
+	n, next          execute one instruction, stepping over call and exec
+	o, out           run until the current program returns
+	c, continue      run until a breakpoint or the end of the program
+	b, break PC      break at PC in the current program
+	b, break OPNAME  break before every OPNAME instruction
+	clear            remove all breakpoints
+	p, print         show the stacks, contract seed, and log
+	l, list          list the current program
+	q, quit          run to the end of the program, ignoring breakpoints
+
+An empty line repeats the previous command. After each command the
+debugger shows the next instruction, prefixed with the run depth (the
+number of suspended programs) and pc.
 
 The log subcommand causes the transaction's log entries to be sent to
 standard output in assembly-language syntax, one per line. Errors in
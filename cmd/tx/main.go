@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
 	"os"
@@ -41,6 +42,9 @@ func main() {
 		}
 		os.Stdout.Write(vm.TxID[:])
 
+	case "debug":
+		debug()
+
 	case "validate":
 		prog, version, runlimit := getWitness()
 		_, err := txvm.Validate(prog, version, runlimit)
@@ -49,9 +53,47 @@ func main() {
 			os.Exit(1)
 		}
 
+	case "estimate":
+		prog, version, _ := getWitness()
+		e, err := txvm.EstimateRunlimit(prog, version)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Printf("runlimit %d\n", e.Runlimit)
+		fmt.Printf("  before finalize %d\n", e.BeforeFinalize)
+		fmt.Printf("  after finalize %d\n", e.AfterFinalize)
+		fmt.Printf("  checksig %d\n", e.CheckSig)
+
+	case "profile":
+		profile()
+
 	case "trace":
-		prog, version, runlimit := getWitness()
-		txvm.Validate(prog, version, runlimit, txvm.Trace(os.Stdout))
+		var fs flag.FlagSet
+		readWitness := witnessFlags(&fs)
+		srcFile := fs.String("src", "", "assembly-language source of the program")
+		asJSON := fs.Bool("json", false, "write the trace as JSON")
+		err := fs.Parse(args)
+		must(err)
+		args = fs.Args()
+		if *asJSON && *srcFile != "" {
+			usage()
+		}
+		prog, version, runlimit := readWitness(os.Stdin)
+		if *asJSON {
+			txvm.Validate(prog, version, runlimit, txvm.TraceJSON(os.Stdout))
+			break
+		}
+		opts := []txvm.Option{txvm.Trace(os.Stdout)}
+		if *srcFile != "" {
+			source := loadSource(*srcFile, prog)
+			opts = append(opts, txvm.BeforeStep(func(vm *txvm.VM) {
+				if s := source(vm.Program(), vm.PC()); s != "" {
+					fmt.Printf("  source %s\n", s)
+				}
+			}))
+		}
+		txvm.Validate(prog, version, runlimit, opts...)
 
 	case "log":
 		prog, version, runlimit := getWitness()
@@ -401,29 +443,34 @@ func main() {
 
 func getWitness() (prog []byte, version, runlimit int64) {
 	var fs flag.FlagSet
-	witness := fs.Bool("witness", false, "expect a witness tuple on stdin")
-	fs.Int64Var(&runlimit, "runlimit", math.MaxInt64, "runlimit")
-	fs.Int64Var(&version, "version", 3, "tx version")
+	readWitness := witnessFlags(&fs)
 	err := fs.Parse(args)
 	must(err)
 	args = fs.Args()
+	return readWitness(os.Stdin)
+}
 
-	inp, err := ioutil.ReadAll(os.Stdin)
-	must(err)
+// witnessFlags defines the -witness, -runlimit, and -version flags
+// in fs. Once fs has been parsed, the returned function reads a
+// transaction program (or, with -witness, a witness tuple) from r.
+func witnessFlags(fs *flag.FlagSet) func(r io.Reader) (prog []byte, version, runlimit int64) {
+	var version, runlimit int64
+	witness := fs.Bool("witness", false, "expect a witness tuple on stdin")
+	fs.Int64Var(&runlimit, "runlimit", math.MaxInt64, "runlimit")
+	fs.Int64Var(&version, "version", 3, "tx version")
 
-	if *witness {
-		var rawTx bc.RawTx
-		err = proto.Unmarshal(inp, &rawTx)
+	return func(r io.Reader) ([]byte, int64, int64) {
+		inp, err := ioutil.ReadAll(r)
 		must(err)
 
-		runlimit = rawTx.Runlimit
-		version = rawTx.Version
-		prog = rawTx.Program
-	} else {
-		prog = inp
+		if *witness {
+			var rawTx bc.RawTx
+			err = proto.Unmarshal(inp, &rawTx)
+			must(err)
+			return rawTx.Program, rawTx.Version, rawTx.Runlimit
+		}
+		return inp, version, runlimit
 	}
-
-	return prog, version, runlimit
 }
 
 func usage() {
@@ -431,15 +478,16 @@ func usage() {
 
 	tx SUBCOMMAND ...args...
 
-Available subcommands are: id, validate, trace, log, result, build.
+Available subcommands are: id, validate, estimate, profile, trace,
+debug, log, result, build.
 
-All subcommands except build expect a transaction program on standard
-input, assigning it a default version of 3 and a default runlimit of
-2^63-1. The -runlimit and -version flags can override those default
-values. These subcommands also accept a -witness flag tells tx to
-expect a transaction witness tuple on standard input instead (such as
-can be produced with the "block tx -raw" command, qv), which dictates
-the version and runlimit.
+All subcommands except build and debug expect a transaction program
+on standard input, assigning it a default version of 3 and a default
+runlimit of 2^63-1. The -runlimit and -version flags can override
+those default values. These subcommands also accept a -witness flag
+tells tx to expect a transaction witness tuple on standard input
+instead (such as can be produced with the "block tx -raw" command,
+qv), which dictates the version and runlimit.
 
 The id subcommand causes tx to compute the transaction's ID and send
 it to standard output. Errors in the transaction beyond the "finalize"
@@ -448,8 +496,45 @@ instruction are not detected.
 The validate subcommand causes tx to validate the transaction. Exit
 value 0 means the transaction is valid, non-zero means it is not.
 
+The estimate subcommand runs the transaction and reports the smallest
+runlimit with which it is valid (ignoring -runlimit), followed by a
+breakdown of the runlimit consumed before and after its "finalize"
+instruction and by its checksig instructions (the checksig figure is
+included in the other two). Exit value 0 means the transaction is
+valid given that runlimit, non-zero means it is not valid with any.
+
+The profile subcommand runs the transaction and prints a table of the
+runlimit consumed by each instruction, most expensive first: its own
+("flat") consumption and its share of the total, its consumption
+including the instructions nested in it ("cum"; for instance the
+instructions of a contract it calls), the number of times it ran, its
+run depth, pc, and opcode, and the seed of the contract running it.
+With -pprof FILE, the profile is also written to FILE in the format
+read by "go tool pprof", in which each contract is a function and
+each pc a line number. If the transaction fails, the profile is of
+the instructions run up to the failure, and the exit value is
+non-zero.
+
 The trace subcommand causes an execution trace of the tx to be sent to
-standard output.
+standard output. With -src FILE, where FILE holds the assembly-language
+source of the transaction program, each instruction in the trace is
+followed by the source line that produced it. With -json, the trace
+is instead a sequence of JSON objects, one per line, each describing
+the VM just before one instruction executes: its run depth, pc,
+opcode, immediate data, remaining runlimit, contract seed, contract
+and argument stacks, and any entries the instruction adds to the
+transaction log. The -src and -json flags cannot be combined.
+
+The debug subcommand runs the tx under an interactive debugger. It is
+used like this:
+
+	tx debug [-witness] [-runlimit N] [-version N] [-src FILE] PROGFILE
+
+where PROGFILE holds the transaction program (or witness tuple). If
+-src is given, FILE holds the program's assembly-language source, and
+the debugger shows the source line for each instruction.
+Debugger commands are read from standard input; type "help" for a
+list.
 
 The log subcommand causes the transaction's log entries to be sent to
 standard output in assembly-language syntax, one per line. Errors in
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/chain/txvm/protocol/txvm"
+)
+
+type profileEntry struct {
+	frame            txvm.ProfileFrame
+	flat, cum, count int64
+}
+
+func profile() {
+	var fs flag.FlagSet
+	readWitness := witnessFlags(&fs)
+	pprofFile := fs.String("pprof", "", "also write the profile to FILE in pprof format")
+	err := fs.Parse(args)
+	must(err)
+	args = fs.Args()
+	prog, version, runlimit := readWitness(os.Stdin)
+
+	var p txvm.Profile
+	_, vmErr := txvm.Validate(prog, version, runlimit, txvm.Profiler(&p))
+
+	// Aggregate the samples by instruction. An instruction's
+	// cumulative runlimit includes the runlimit of the instructions
+	// nested in it.
+	type key struct {
+		seed   string
+		depth  int
+		pc     int64
+		opcode byte
+	}
+	var (
+		entries = make(map[key]*profileEntry)
+		total   int64
+	)
+	for _, s := range p.Samples {
+		total += s.Runlimit
+		seen := make(map[key]bool)
+		for i, f := range s.Stack {
+			k := key{string(f.Seed), f.Depth, f.PC, f.OpCode}
+			e := entries[k]
+			if e == nil {
+				e = &profileEntry{frame: f}
+				entries[k] = e
+			}
+			if i == 0 {
+				e.flat += s.Runlimit
+				e.count += s.Count
+			}
+			if !seen[k] {
+				e.cum += s.Runlimit
+				seen[k] = true
+			}
+		}
+	}
+	var list []*profileEntry
+	for _, e := range entries {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.flat != b.flat {
+			return a.flat > b.flat
+		}
+		if a.cum != b.cum {
+			return a.cum > b.cum
+		}
+		if c := bytes.Compare(a.frame.Seed, b.frame.Seed); c != 0 {
+			return c < 0
+		}
+		return a.frame.PC < b.frame.PC
+	})
+
+	fmt.Printf("total runlimit %d\n", total)
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "flat\tflat%\tcum\tcum%\tcount\tdepth\tpc\t op\t contract\t")
+	for _, e := range list {
+		contract := "tx"
+		if !bytes.Equal(e.frame.Seed, make([]byte, 32)) {
+			contract = fmt.Sprintf("%x", e.frame.Seed)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%d\t%d\t%d\t %s\t %s\t\n",
+			e.flat, percent(e.flat, total), e.cum, percent(e.cum, total),
+			e.count, e.frame.Depth, e.frame.PC, e.frame.Op(), contract)
+	}
+	w.Flush()
+
+	if *pprofFile != "" {
+		f, err := os.Create(*pprofFile)
+		must(err)
+		must(p.WritePprof(f))
+		must(f.Close())
+	}
+	if vmErr != nil {
+		fmt.Fprintln(os.Stderr, vmErr)
+		os.Exit(1)
+	}
+}
+
+func percent(n, total int64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(n)/float64(total))
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/chain/txvm/protocol/txvm/asm"
+)
+
+// loadSource assembles the named assembly-language file, which must
+// produce prog, and returns a function giving the file position and
+// text of the source line for the instruction at pc in prog or in
+// any program quoted in it.
+func loadSource(filename string, prog []byte) func(prog []byte, pc int64) string {
+	src, err := ioutil.ReadFile(filename)
+	must(err)
+	m, err := asm.AssembleWithSourceMap(string(src))
+	must(err)
+	if !bytes.Equal(m.Prog, prog) {
+		must(fmt.Errorf("%s does not assemble to the transaction program", filename))
+	}
+	lines := strings.Split(string(src), "\n")
+
+	return func(prog []byte, pc int64) string {
+		pos, ok := m.Lookup(prog, pc)
+		if !ok {
+			return ""
+		}
+		return fmt.Sprintf("%s:%d: %s", filename, pos.Line, strings.TrimSpace(lines[pos.Line-1]))
+	}
+}
@@ -0,0 +1,83 @@
+package ed25519
+
+import (
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// ConcurrentVerifier accumulates signatures to be verified all at
+// once, concurrently. The zero value is empty and ready to use.
+//
+// This is not batch verification in the sense of checking all the
+// signatures with a single combined equation. Such checks are
+// faster, but cannot agree exactly with Verify on signatures with
+// small-order components, which matters to callers such as nodes
+// validating a blockchain. Instead each signature is checked with
+// Verify.
+type ConcurrentVerifier struct {
+	entries []verifierEntry
+	invalid bool
+}
+
+type verifierEntry struct {
+	pubkey PublicKey
+	msg    []byte
+	sig    []byte
+}
+
+// Add adds a signature to v. It will panic if len(publicKey) is not
+// PublicKeySize.
+func (v *ConcurrentVerifier) Add(publicKey PublicKey, message, sig []byte) {
+	if l := len(publicKey); l != PublicKeySize {
+		panic("ed25519: bad public key length: " + strconv.Itoa(l))
+	}
+	if len(sig) != SignatureSize || sig[63]&224 != 0 {
+		v.invalid = true
+	}
+	v.entries = append(v.entries, verifierEntry{pubkey: publicKey, msg: message, sig: sig})
+}
+
+// Len returns the number of signatures added to v.
+func (v *ConcurrentVerifier) Len() int {
+	return len(v.entries)
+}
+
+// Verify reports whether all the signatures added to v are valid,
+// in exact agreement with the package-level Verify function. If
+// there are none, it reports true. The signatures are checked on as
+// many goroutines as there are CPUs available, and checking stops at
+// the first invalid one.
+func (v *ConcurrentVerifier) Verify() bool {
+	if v.invalid {
+		return false
+	}
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(v.entries) {
+		workers = len(v.entries)
+	}
+	var (
+		next   int64 = -1
+		failed int32
+		wg     sync.WaitGroup
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for atomic.LoadInt32(&failed) == 0 {
+				i := atomic.AddInt64(&next, 1)
+				if i >= int64(len(v.entries)) {
+					return
+				}
+				e := v.entries[i]
+				if !Verify(e.pubkey, e.msg, e.sig) {
+					atomic.StoreInt32(&failed, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return failed == 0
+}
@@ -0,0 +1,138 @@
+package ed25519
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"fmt"
+	"testing"
+
+	"github.com/chain/txvm/crypto/ed25519/ecmath"
+)
+
+func verifierOf(tb testing.TB, n int) *ConcurrentVerifier {
+	v := new(ConcurrentVerifier)
+	for i := 0; i < n; i++ {
+		pub, priv, err := GenerateKey(rand.Reader)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		msg := []byte(fmt.Sprintf("message %d", i))
+		v.Add(pub, msg, Sign(priv, msg))
+	}
+	return v
+}
+
+func TestConcurrentVerify(t *testing.T) {
+	if !new(ConcurrentVerifier).Verify() {
+		t.Error("no signatures rejected")
+	}
+	for _, n := range []int{1, 2, 17} {
+		v := verifierOf(t, n)
+		if !v.Verify() {
+			t.Errorf("%d valid signatures rejected", n)
+		}
+
+		// Corrupt one message.
+		v = verifierOf(t, n)
+		v.entries[n/2].msg = []byte("wrong message")
+		if v.Verify() {
+			t.Errorf("%d signatures with a wrong message accepted", n)
+		}
+
+		// Corrupt one signature's s.
+		v = verifierOf(t, n)
+		sig := append([]byte(nil), v.entries[n-1].sig...)
+		sig[40] ^= 1
+		v.entries[n-1].sig = sig
+		if v.Verify() {
+			t.Errorf("%d signatures with a corrupted one accepted", n)
+		}
+
+		// Swap two signatures.
+		if n > 1 {
+			v = verifierOf(t, n)
+			v.entries[0].sig, v.entries[1].sig = v.entries[1].sig, v.entries[0].sig
+			if v.Verify() {
+				t.Errorf("%d signatures with two swapped accepted", n)
+			}
+		}
+	}
+
+	v := verifierOf(t, 3)
+	v.Add(v.entries[0].pubkey, []byte("x"), make([]byte, SignatureSize-1))
+	if v.Verify() {
+		t.Error("short signature accepted")
+	}
+}
+
+// smallOrderSig returns a public key and a signature of msg whose R
+// is offset from rB by the point of order 2, (0, -1). It satisfies
+// the cofactored verification equation but not the cofactorless one
+// that Verify checks.
+func smallOrderSig(msg []byte) (PublicKey, []byte) {
+	var a, r ecmath.Scalar
+	a.SetUint64(12345)
+	r.SetUint64(67890)
+
+	var A, R, T ecmath.Point
+	A.ScMulBase(&a)
+	R.ScMulBase(&r)
+	// The encoding of (0, -1) is p-1, little-endian.
+	tEnc := [32]byte{0xec}
+	for i := 1; i < 31; i++ {
+		tEnc[i] = 0xff
+	}
+	tEnc[31] = 0x7f
+	if _, ok := T.Decode(tEnc); !ok {
+		panic("cannot decode point of order 2")
+	}
+	R.Add(&R, &T)
+
+	aEnc, rEnc := A.Encode(), R.Encode()
+	h := sha512.New()
+	h.Write(rEnc[:])
+	h.Write(aEnc[:])
+	h.Write(msg)
+	var digest [64]byte
+	h.Sum(digest[:0])
+	var k, s ecmath.Scalar
+	k.Reduce(&digest)
+	s.MulAdd(&k, &a, &r)
+
+	return PublicKey(aEnc[:]), append(rEnc[:], s[:]...)
+}
+
+func TestConcurrentVerifySmallOrder(t *testing.T) {
+	msg := []byte("message")
+	pub, sig := smallOrderSig(msg)
+	if Verify(pub, msg, sig) {
+		t.Fatal("Verify accepted signature with small-order component")
+	}
+
+	v := verifierOf(t, 3)
+	v.Add(pub, msg, sig)
+	if v.Verify() {
+		t.Error("ConcurrentVerifier accepted signature rejected by Verify")
+	}
+}
+
+func benchmarkVerify(b *testing.B, n int, concurrent bool) {
+	v := verifierOf(b, n)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if concurrent {
+			if !v.Verify() {
+				b.Fatal("signatures rejected")
+			}
+			continue
+		}
+		for _, e := range v.entries {
+			if !Verify(e.pubkey, e.msg, e.sig) {
+				b.Fatal("signature rejected")
+			}
+		}
+	}
+}
+
+func BenchmarkVerify64(b *testing.B)           { benchmarkVerify(b, 64, false) }
+func BenchmarkConcurrentVerify64(b *testing.B) { benchmarkVerify(b, 64, true) }
@@ -1,5 +1,7 @@
 module github.com/chain/txvm
 
+go 1.19
+
 require (
 	github.com/davecgh/go-spew v1.1.1
 	github.com/golang/protobuf v1.3.1
@@ -5,7 +5,6 @@ import (
 	"encoding/hex"
 
 	"github.com/golang/protobuf/proto"
-	"golang.org/x/sync/errgroup"
 
 	"github.com/chain/txvm/errors"
 	"github.com/chain/txvm/protocol/txvm"
@@ -128,26 +127,15 @@ func (b *Block) FromBytes(bits []byte) error {
 	if err != nil {
 		return err
 	}
-	txs := make([]*Tx, len(rb.Transactions))
-	var eg errgroup.Group
-	for i := range rb.Transactions {
-		i := i
-		eg.Go(func() error {
-			tx, err := NewTx(rb.Transactions[i].Program, rb.Transactions[i].Version, rb.Transactions[i].Runlimit)
-			if err != nil {
-				return err
-			}
-			if !tx.Finalized {
-				return txvm.ErrUnfinalized
-			}
-			txs[i] = tx
-			return nil
-		})
-	}
-	err = eg.Wait()
+	txs, err := NewTxs(rb.Transactions)
 	if err != nil {
 		return err
 	}
+	for i, tx := range txs {
+		if !tx.Finalized {
+			return errors.Wrapf(txvm.ErrUnfinalized, "transaction %d", i)
+		}
+	}
 	b.UnsignedBlock = &UnsignedBlock{
 		BlockHeader:  rb.Header,
 		Transactions: txs,
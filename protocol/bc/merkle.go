@@ -3,19 +3,49 @@ package bc
 import (
 	"bytes"
 
+	"github.com/chain/txvm/errors"
 	"github.com/chain/txvm/protocol/merkle"
 )
 
 // TxMerkleRoot creates a merkle tree from a slice of Transactions and
 // returns the root hash of the tree.
 func TxMerkleRoot(txs []*Tx) Hash {
-	var txCommitments [][]byte
+	return NewHash(merkle.Root(witnessCommitments(txs)))
+}
 
-	for _, tx := range txs {
+func witnessCommitments(txs []*Tx) [][]byte {
+	if len(txs) == 0 {
+		return nil
+	}
+	txCommitments := make([][]byte, len(txs))
+	parallel(len(txs), func(i int) error {
 		var b bytes.Buffer
-		tx.WriteWitnessCommitmentTo(&b)
-		txCommitments = append(txCommitments, b.Bytes())
+		txs[i].WriteWitnessCommitmentTo(&b)
+		txCommitments[i] = b.Bytes()
+		return nil
+	})
+	return txCommitments
+}
+
+// TxInclusionProof returns a proof that the transaction at index i
+// in b is committed to by b's TransactionsRoot. The proof may be
+// checked with VerifyTxInclusion.
+func TxInclusionProof(b *UnsignedBlock, i int) ([]merkle.AuditHash, error) {
+	if i < 0 || i >= len(b.Transactions) {
+		return nil, errors.New("transaction index out of range")
 	}
+	return merkle.Proof(witnessCommitments(b.Transactions), i)
+}
 
-	return NewHash(merkle.Root(txCommitments))
+// VerifyTxInclusion tells whether proof, as returned by
+// TxInclusionProof, shows that the transaction with the given
+// witness commitment is committed to by h's TransactionsRoot. The
+// witness commitment is what Tx.WriteWitnessCommitmentTo writes (and
+// what CommitmentsTx.WitnessCommitment holds): the transaction ID
+// followed by the hash of its witness.
+func VerifyTxInclusion(h *BlockHeader, witnessCommitment []byte, proof []merkle.AuditHash) bool {
+	if h.TransactionsRoot == nil {
+		return false
+	}
+	return merkle.Verify(h.TransactionsRoot.Byte32(), witnessCommitment, proof)
 }
@@ -55,3 +55,35 @@ func must(err error) {
 		panic(err)
 	}
 }
+
+func TestTxInclusionProof(t *testing.T) {
+	var txs []*Tx
+	for i := byte(1); i <= 5; i++ {
+		txs = append(txs, &Tx{ID: NewHash([32]byte{i}), RawTx: RawTx{Program: []byte{i}}})
+	}
+	root := TxMerkleRoot(txs)
+	b := &UnsignedBlock{
+		BlockHeader:  &BlockHeader{TransactionsRoot: &root},
+		Transactions: txs,
+	}
+
+	for i, tx := range txs {
+		proof, err := TxInclusionProof(b, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commitment := NewCommitmentsTx(tx).WitnessCommitment
+		if !VerifyTxInclusion(b.BlockHeader, commitment, proof) {
+			t.Errorf("proof for tx %d does not verify", i)
+		}
+		other := NewCommitmentsTx(txs[(i+1)%len(txs)]).WitnessCommitment
+		if VerifyTxInclusion(b.BlockHeader, other, proof) {
+			t.Errorf("proof for tx %d verifies for tx %d", i, (i+1)%len(txs))
+		}
+	}
+
+	_, err := TxInclusionProof(b, len(txs))
+	if err == nil {
+		t.Error("TxInclusionProof with index out of range: got no error")
+	}
+}
@@ -0,0 +1,99 @@
+package bc
+
+import (
+	"runtime"
+	"sync/atomic"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/txvm"
+)
+
+// NewTxs is like NewTx, for each of the given raw transactions, but
+// runs them concurrently. If any fails, it returns the error for the
+// one with the lowest index (wrapped with that index), regardless of
+// the order in which they ran; the others may or may not have run.
+//
+// The options are applied to the VM of every transaction, so any
+// callbacks in them may be called concurrently.
+func NewTxs(raws []*RawTx, option ...txvm.Option) ([]*Tx, error) {
+	txs := make([]*Tx, len(raws))
+	err := parallel(len(raws), func(i int) error {
+		tx, err := NewTx(raws[i].Program, raws[i].Version, raws[i].Runlimit, option...)
+		if err != nil {
+			return errors.Wrapf(err, "transaction %d", i)
+		}
+		txs[i] = tx
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
+
+// NewCommitmentsTxs is like NewCommitmentsTx, for each of the given
+// transactions, but computes their commitments concurrently.
+func NewCommitmentsTxs(txs []*Tx) []*CommitmentsTx {
+	ctxs := make([]*CommitmentsTx, len(txs))
+	parallel(len(txs), func(i int) error {
+		ctxs[i] = NewCommitmentsTx(txs[i])
+		return nil
+	})
+	return ctxs
+}
+
+// parallel calls f(i) for each i from 0 through n-1, on as many
+// goroutines as there are CPUs available. Indexes are handed out in
+// increasing order, and none are handed out after one fails that
+// are higher than it. So when f fails for any i, parallel can return
+// the error for the lowest such i deterministically, as if it had
+// called f for each i in turn.
+func parallel(n int, f func(i int) error) error {
+	workers := runtime.GOMAXPROCS(0)
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			if err := f(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var (
+		next   int64 = -1
+		failed       = int64(n) // lowest failing index
+		errs         = make([]error, n)
+		eg     errgroup.Group
+	)
+	for w := 0; w < workers; w++ {
+		eg.Go(func() error {
+			for {
+				i := atomic.AddInt64(&next, 1)
+				if i >= int64(n) || i > atomic.LoadInt64(&failed) {
+					return nil
+				}
+				err := f(int(i))
+				if err == nil {
+					continue
+				}
+				errs[i] = err
+				for {
+					old := atomic.LoadInt64(&failed)
+					if i >= old || atomic.CompareAndSwapInt64(&failed, old, i) {
+						break
+					}
+				}
+			}
+		})
+	}
+	eg.Wait()
+	if failed < int64(n) {
+		return errs[failed]
+	}
+	return nil
+}
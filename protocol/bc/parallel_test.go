@@ -0,0 +1,119 @@
+package bc
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/txvm"
+	"github.com/chain/txvm/protocol/txvm/asm"
+	"github.com/chain/txvm/protocol/txvm/txvmtest"
+)
+
+func TestParallel(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+
+	const n = 1000
+	fail := map[int]bool{137: true, 138: true, 500: true, 999: true}
+	for iter := 0; iter < 20; iter++ {
+		var calls int64
+		err := parallel(n, func(i int) error {
+			atomic.AddInt64(&calls, 1)
+			if fail[i] {
+				return fmt.Errorf("index %d", i)
+			}
+			return nil
+		})
+		if err == nil || err.Error() != "index 137" {
+			t.Fatalf("iteration %d: got error %v, want index 137", iter, err)
+		}
+		if calls < 138 {
+			t.Fatalf("iteration %d: got %d calls, want at least 138", iter, calls)
+		}
+	}
+
+	var calls int64
+	err := parallel(n, func(int) error {
+		atomic.AddInt64(&calls, 1)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != n {
+		t.Errorf("got %d calls, want %d", calls, n)
+	}
+}
+
+func TestNewTxs(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+
+	good, err := asm.Assemble(txvmtest.SimplePayment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad, err := asm.Assemble("0 verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raws := make([]*RawTx, 50)
+	for i := range raws {
+		raws[i] = &RawTx{Version: 3, Runlimit: 100000, Program: good}
+	}
+	txs, err := NewTxs(raws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := NewTx(good, 3, 100000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tx := range txs {
+		if !reflect.DeepEqual(tx, want) {
+			t.Fatalf("transaction %d differs from NewTx result", i)
+		}
+	}
+
+	// Options passed in a slice with spare capacity must not be
+	// shared between the transactions' VMs. Run with -race.
+	option := append(make([]txvm.Option, 0, 10), txvm.EnableExtension)
+	for iter := 0; iter < 20; iter++ {
+		txs, err := NewTxs(raws, option...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, tx := range txs {
+			if !reflect.DeepEqual(tx, want) {
+				t.Fatalf("iteration %d: transaction %d, with options, differs from NewTx result", iter, i)
+			}
+		}
+	}
+
+	wantCommitments := NewCommitmentsTx(want)
+	for i, ctx := range NewCommitmentsTxs(txs) {
+		if !reflect.DeepEqual(ctx, wantCommitments) {
+			t.Fatalf("commitments %d differ from NewCommitmentsTx result", i)
+		}
+	}
+
+	for _, i := range []int{49, 31, 17} {
+		raws[i] = &RawTx{Version: 3, Runlimit: 100000, Program: bad}
+	}
+	for iter := 0; iter < 20; iter++ {
+		_, err = NewTxs(raws)
+		if err == nil {
+			t.Fatal("got no error, want one")
+		}
+		if !strings.HasPrefix(err.Error(), "transaction 17:") {
+			t.Fatalf("iteration %d: got error %q, want one for transaction 17", iter, err)
+		}
+		if errors.Root(err) != txvm.ErrVerifyFail {
+			t.Fatalf("iteration %d: got error %s, want %s", iter, errors.Root(err), txvm.ErrVerifyFail)
+		}
+	}
+}
@@ -73,6 +73,15 @@ type Output struct {
 	LogPos  int
 }
 
+// Snapshot returns the encoded snapshot of the output contract: the
+// program that pushes the tuple the input instruction takes to spend
+// it. The output's ID is the hash of the snapshot.
+func (o *Output) Snapshot() []byte {
+	t := txvm.Tuple{txvm.Bytes{txvm.ContractCode}, txvm.Bytes(o.Seed.Bytes()), txvm.Bytes(o.Program)}
+	t = append(t, o.Stack...)
+	return txvm.Encode(t)
+}
+
 // Input is a parsed input-typed txvm log entry, plus information
 // derived from stack introspection during execution.
 type Input struct {
@@ -129,7 +138,10 @@ func NewTx(prog []byte, version, runlimit int64, option ...txvm.Option) (*Tx, er
 			Runlimit: runlimit,
 		},
 	}
-	option = append(option, txvm.OnFinalize(tx.entryHook), txvm.BeforeStep(tx.stackHook))
+	// Clip option first, so that appending to it never writes into
+	// an array the caller may share with other goroutines (as
+	// NewTxs does).
+	option = append(option[:len(option):len(option)], txvm.OnFinalize(tx.entryHook), txvm.BeforeStep(tx.stackHook))
 	vm, err := txvm.Validate(prog, version, runlimit, option...)
 	if vm != nil {
 		tx.Finalized = vm.Finalized
@@ -197,6 +197,12 @@ func TestNewTx(t *testing.T) {
 
 			c.want.Log = tx.Log
 
+			for _, out := range tx.Outputs {
+				if got := NewHash(txvm.VMHash("SnapshotID", out.Snapshot())); got != out.ID {
+					t.Errorf("output %x has snapshot with hash %x", out.ID.Bytes(), got.Bytes())
+				}
+			}
+
 			cs := spew.NewDefaultConfig()
 			cs.DisableMethods = true
 			if !reflect.DeepEqual(tx, c.want) {
@@ -67,7 +67,7 @@ func (c *Chain) CommitAppliedBlock(ctx context.Context, block *bc.Block, snapsho
 	if block.Height <= curState.Height() {
 		return nil
 	}
-	return c.finalizeCommitState(ctx, snapshot)
+	return c.finalizeCommitState(ctx, curState, snapshot)
 }
 
 // CommitBlock takes a block, commits it to persistent storage and applies
@@ -88,8 +88,7 @@ func (c *Chain) CommitBlock(ctx context.Context, block *bc.Block) error {
 		return nil
 	}
 
-	snapshot := state.Copy(curSnapshot)
-	err = snapshot.ApplyBlock(block.UnsignedBlock)
+	snapshot, err := curSnapshot.ApplyBlock(block.UnsignedBlock)
 	if err != nil {
 		return err
 	}
@@ -99,10 +98,14 @@ func (c *Chain) CommitBlock(ctx context.Context, block *bc.Block) error {
 	if block.NoncesRoot.Byte32() != snapshot.NonceTree.RootHash() {
 		return ErrBadNoncesRoot
 	}
-	return c.finalizeCommitState(ctx, snapshot)
+	return c.finalizeCommitState(ctx, curSnapshot, snapshot)
 }
 
-func (c *Chain) finalizeCommitState(ctx context.Context, snapshot *state.Snapshot) error {
+func (c *Chain) finalizeCommitState(ctx context.Context, prev, snapshot *state.Snapshot) error {
+	if prev.Height()+1 == snapshot.Height() {
+		c.saveDelta(ctx, prev, snapshot)
+	}
+
 	// Save the blockchain state tree snapshot to persistent storage
 	// if we haven't done it recently.
 	lastQueuedHeight := atomic.LoadUint64(&c.lastQueuedSnapshotHeight)
@@ -111,6 +114,7 @@ func (c *Chain) finalizeCommitState(ctx context.Context, snapshot *state.Snapsho
 	}
 	// setState will update c's current block and snapshot, or no-op
 	// if another goroutine has already updated the state.
+	c.history.Add(snapshot)
 	c.setState(snapshot)
 
 	// The below FinalizeHeight will notify other cored processes that
@@ -121,6 +125,23 @@ func (c *Chain) finalizeCommitState(ctx context.Context, snapshot *state.Snapsho
 	return errors.Wrap(err, "finalizing block")
 }
 
+// saveDelta saves the delta from prev to snapshot, if c's store is a
+// DeltaStore. Failure is not fatal: Recover replays the blocks after
+// any gap in the stored deltas.
+func (c *Chain) saveDelta(ctx context.Context, prev, snapshot *state.Snapshot) {
+	ds, ok := c.store.(DeltaStore)
+	if !ok {
+		return
+	}
+	d, err := state.NewDelta(prev, snapshot)
+	if err == nil {
+		err = ds.SaveDelta(ctx, d)
+	}
+	if err != nil {
+		log.Error(ctx, err, "at", "saving state delta")
+	}
+}
+
 func (c *Chain) queueSnapshot(ctx context.Context, s *state.Snapshot) {
 	// Non-blockingly queue the snapshot for storage.
 	select {
@@ -26,8 +26,7 @@ func TestGetBlock(t *testing.T) {
 	noBlocks := memstore.New()
 	oneBlock := memstore.New()
 	oneBlock.SaveBlock(ctx, b1)
-	snapshot := state.Empty()
-	snapshot.ApplyBlock(b1.UnsignedBlock)
+	snapshot, _ := state.Empty().ApplyBlock(b1.UnsignedBlock)
 	oneBlock.SaveSnapshot(ctx, snapshot)
 
 	cases := []struct {
@@ -81,8 +80,7 @@ func TestGenerateBlock(t *testing.T) {
 		{ID: bc.NewHash([32]byte{3}), Contracts: []bc.Contract{{Type: bc.OutputType, ID: bc.NewHash([32]byte{4})}}, Finalized: true},
 	}
 
-	st := state.Empty()
-	err := st.ApplyBlock(b1.UnsignedBlock)
+	_, err := state.Empty().ApplyBlock(b1.UnsignedBlock)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -170,8 +168,7 @@ func TestCommitBlockIdempotence(t *testing.T) {
 	c, b1 := newTestChain(t, now)
 
 	var blocks []*bc.Block
-	s := state.Empty()
-	s.ApplyBlock(b1.UnsignedBlock)
+	s, _ := state.Empty().ApplyBlock(b1.UnsignedBlock)
 	for i := 0; i < numOfBlocks; i++ {
 		tx := &bc.Tx{ID: bc.NewHash([32]byte{byte(i)})}
 		newBlock, newSnapshot, err := c.GenerateBlock(ctx, bc.Millis(now)+uint64(i+1), []*bc.CommitmentsTx{bc.NewCommitmentsTx(tx)})
@@ -197,8 +194,7 @@ func TestCommitBlockIdempotence(t *testing.T) {
 		testutil.FatalErr(t, err)
 	}
 	c.bb.MaxNonceWindow = 48 * time.Hour
-	snapshot := state.Empty()
-	snapshot.ApplyBlock(b1.UnsignedBlock)
+	snapshot, _ := state.Empty().ApplyBlock(b1.UnsignedBlock)
 	c.setState(snapshot)
 
 	// Apply all of the blocks concurrently in separate goroutines
@@ -232,8 +228,7 @@ func TestPersistSnapshot(t *testing.T) {
 	c.blocksPerSnapshot = 50
 	numBlocks := int(c.blocksPerSnapshot) - 1 // minus initial block
 
-	s := state.Empty()
-	s.ApplyBlock(b1.UnsignedBlock)
+	s, _ := state.Empty().ApplyBlock(b1.UnsignedBlock)
 	appliedSnapshot := s
 
 	for i := 0; i < numBlocks; i++ {
@@ -292,8 +287,7 @@ func newTestChain(tb testing.TB, ts time.Time) (c *Chain, sb1 *bc.Block) {
 	}
 	c.bb.MaxNonceWindow = 48 * time.Hour
 	c.bb.MaxBlockWindow = 100
-	st := state.Empty()
-	err = st.ApplyBlock(b1.UnsignedBlock)
+	st, err := state.Empty().ApplyBlock(b1.UnsignedBlock)
 	if err != nil {
 		testutil.FatalErr(tb, err)
 	}
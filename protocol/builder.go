@@ -43,8 +43,7 @@ func (bb *BlockBuilder) Start(snapshot *state.Snapshot, timestampMS uint64) erro
 	if timestampMS <= snapshot.Header.TimestampMs {
 		return fmt.Errorf("timestamp %d is not greater than prevblock timestamp %d", timestampMS, snapshot.Header.TimestampMs)
 	}
-	bb.snapshot = state.Copy(snapshot)
-	bb.snapshot.PruneNonces(timestampMS)
+	bb.snapshot = snapshot.PruneNonces(timestampMS)
 	bb.timestampMS = timestampMS
 	bb.txs = nil
 	bb.runlimit = 0
@@ -87,11 +86,12 @@ func (bb *BlockBuilder) AddTx(tx *bc.CommitmentsTx) error {
 	if !ok {
 		return ErrBlockRunlimit
 	}
-	err = bb.snapshot.ApplyTx(tx)
+	snapshot, err := bb.snapshot.ApplyTx(tx)
 	if err != nil {
 		return err
 	}
 
+	bb.snapshot = snapshot
 	bb.runlimit = runlimit
 	bb.txs = append(bb.txs, tx)
 
@@ -137,12 +137,11 @@ func (bb *BlockBuilder) Build() (*bc.UnsignedBlock, *state.Snapshot, error) {
 		BlockHeader:  h,
 		Transactions: txs,
 	}
-	err := bb.snapshot.ApplyBlockHeader(h)
+	snapshot, err := bb.snapshot.ApplyBlockHeader(h)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	snapshot := bb.snapshot
 	bb.snapshot = nil
 	bb.txs = nil
 	bb.timestampMS = 0
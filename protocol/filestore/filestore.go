@@ -0,0 +1,560 @@
+// Package filestore is a protocol.Store implementation that keeps
+// blockchain data in a directory on the local filesystem.
+//
+// Blocks are appended to a single log file, blocks.log. Each record
+// in the log is a fixed-size header (block height, payload length,
+// and a CRC-32C checksum of the height and payload) followed by the
+// serialized block. A second file, blocks.idx, holds the log offset
+// of each block as a fixed-width big-endian integer, so that the
+// block at height h is found at index position h-1.
+//
+// Every write to the log and the index is followed by an fsync. The
+// log is the source of truth: when a Store is opened, the index is
+// checked against the log and rebuilt as necessary, and any torn
+// record at the end of the log (left by a crash in the middle of
+// SaveBlock) is truncated away.
+//
+// State snapshots are written to files named snapshot-HEIGHT. Each
+// one is written to a temporary file, synced, and atomically renamed
+// into place, so a snapshot file is either complete or absent.
+// Only the most recent few snapshots are retained.
+//
+// Store is also a protocol.DeltaStore. The state delta of each block
+// is written to a file named delta-HEIGHT in the same way as a
+// snapshot. Deltas are removed once they are no older than every
+// retained snapshot.
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/state"
+)
+
+const (
+	logName        = "blocks.log"
+	indexName      = "blocks.idx"
+	snapshotPrefix = "snapshot-"
+	deltaPrefix    = "delta-"
+	tmpSuffix      = ".tmp"
+
+	recordHeaderSize = 16 // height (8), payload length (4), checksum (4)
+	indexEntrySize   = 8
+
+	// keepSnapshots is the number of snapshot files retained
+	// after each successful SaveSnapshot.
+	keepSnapshots = 2
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	// ErrConflict is returned by SaveBlock when a different block
+	// has already been stored at the same height.
+	ErrConflict = errors.New("conflicting block at height")
+
+	// ErrNonContiguous is returned by SaveBlock when the block's
+	// height is not exactly one more than the store's height.
+	ErrNonContiguous = errors.New("block height is not contiguous with store")
+
+	// ErrNotFound is returned by GetBlock when no block exists at
+	// the requested height.
+	ErrNotFound = errors.New("block not found")
+
+	// ErrCorrupt is returned when stored data fails its checksum or
+	// cannot be parsed.
+	ErrCorrupt = errors.New("corrupt store data")
+)
+
+// Store satisfies the protocol.Store interface.
+type Store struct {
+	dir string
+
+	mu      sync.Mutex // protects the following
+	log     *os.File
+	index   *os.File
+	offsets []int64 // offsets[h-1] is the log offset of the block at height h
+	logSize int64
+}
+
+// Open opens the Store in the given directory, creating the
+// directory and its files if they do not already exist. It repairs
+// any damage left by an interrupted write before returning.
+func Open(dir string) (*Store, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating store directory")
+	}
+	s := &Store{dir: dir}
+	s.log, err = os.OpenFile(filepath.Join(dir, logName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening block log")
+	}
+	s.index, err = os.OpenFile(filepath.Join(dir, indexName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		s.log.Close()
+		return nil, errors.Wrap(err, "opening block index")
+	}
+	err = s.recover()
+	if err != nil {
+		s.Close()
+		return nil, errors.Wrap(err, "recovering store")
+	}
+	return s, nil
+}
+
+// Close releases the Store's open files.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err1 := s.log.Close()
+	err2 := s.index.Close()
+	if err1 != nil {
+		return err1
+	}
+	return err2
+}
+
+// recover brings the index and the log back into agreement.
+// Index entries are trusted only as far as they point at
+// consecutive, intact log records. Any intact records in the log
+// beyond the last trusted index entry are then indexed, and
+// everything after the last intact record is truncated.
+func (s *Store) recover() error {
+	idxBytes, err := ioutil.ReadAll(s.index)
+	if err != nil {
+		return errors.Wrap(err, "reading block index")
+	}
+	logInfo, err := s.log.Stat()
+	if err != nil {
+		return errors.Wrap(err, "reading block log size")
+	}
+	logSize := logInfo.Size()
+
+	var (
+		offsets []int64
+		next    int64 // offset just past the last verified record
+	)
+	for i := 0; i+indexEntrySize <= len(idxBytes); i += indexEntrySize {
+		off := int64(binary.BigEndian.Uint64(idxBytes[i:]))
+		if off != next {
+			break
+		}
+		n, err := s.checkRecord(off, logSize, uint64(len(offsets)+1))
+		if err != nil {
+			break
+		}
+		offsets = append(offsets, off)
+		next = off + n
+	}
+	indexed := len(offsets)
+
+	// Pick up records that made it into the log but not the index.
+	for next < logSize {
+		n, err := s.checkRecord(next, logSize, uint64(len(offsets)+1))
+		if err != nil {
+			break
+		}
+		offsets = append(offsets, next)
+		next += n
+	}
+
+	if next < logSize {
+		err = s.log.Truncate(next)
+		if err != nil {
+			return errors.Wrap(err, "truncating torn block log")
+		}
+		err = s.log.Sync()
+		if err != nil {
+			return errors.Wrap(err, "syncing block log")
+		}
+	}
+
+	wantIdxLen := int64(len(offsets) * indexEntrySize)
+	if int64(len(idxBytes)) != wantIdxLen || indexed != len(offsets) {
+		err = s.index.Truncate(int64(indexed * indexEntrySize))
+		if err != nil {
+			return errors.Wrap(err, "truncating block index")
+		}
+		var buf bytes.Buffer
+		for _, off := range offsets[indexed:] {
+			var b [indexEntrySize]byte
+			binary.BigEndian.PutUint64(b[:], uint64(off))
+			buf.Write(b[:])
+		}
+		_, err = s.index.WriteAt(buf.Bytes(), int64(indexed*indexEntrySize))
+		if err != nil {
+			return errors.Wrap(err, "rebuilding block index")
+		}
+		err = s.index.Sync()
+		if err != nil {
+			return errors.Wrap(err, "syncing block index")
+		}
+	}
+
+	s.offsets = offsets
+	s.logSize = next
+	return nil
+}
+
+// checkRecord verifies that an intact record for the given height
+// begins at off, returning the record's total length.
+func (s *Store) checkRecord(off, logSize int64, height uint64) (int64, error) {
+	h, _, n, err := s.readRecord(off, logSize)
+	if err != nil {
+		return 0, err
+	}
+	if h != height {
+		return 0, errors.WithDetailf(ErrCorrupt, "record at offset %d has height %d, want %d", off, h, height)
+	}
+	return n, nil
+}
+
+// readRecord reads and verifies the log record at off, returning its
+// height, its payload, and the total length of the record.
+func (s *Store) readRecord(off, logSize int64) (uint64, []byte, int64, error) {
+	if off+recordHeaderSize > logSize {
+		return 0, nil, 0, errors.WithDetailf(ErrCorrupt, "short record header at offset %d", off)
+	}
+	var hdr [recordHeaderSize]byte
+	_, err := s.log.ReadAt(hdr[:], off)
+	if err != nil {
+		return 0, nil, 0, errors.Wrapf(err, "reading record header at offset %d", off)
+	}
+	height := binary.BigEndian.Uint64(hdr[0:8])
+	size := int64(binary.BigEndian.Uint32(hdr[8:12]))
+	sum := binary.BigEndian.Uint32(hdr[12:16])
+	if off+recordHeaderSize+size > logSize {
+		return 0, nil, 0, errors.WithDetailf(ErrCorrupt, "short record payload at offset %d", off)
+	}
+	payload := make([]byte, size)
+	_, err = s.log.ReadAt(payload, off+recordHeaderSize)
+	if err != nil {
+		return 0, nil, 0, errors.Wrapf(err, "reading record payload at offset %d", off)
+	}
+	if checksum(hdr[:8], payload) != sum {
+		return 0, nil, 0, errors.WithDetailf(ErrCorrupt, "bad checksum for record at offset %d", off)
+	}
+	return height, payload, recordHeaderSize + size, nil
+}
+
+func checksum(parts ...[]byte) uint32 {
+	var sum uint32
+	for _, p := range parts {
+		sum = crc32.Update(sum, crcTable, p)
+	}
+	return sum
+}
+
+// Height satisfies the protocol.Store interface.
+func (s *Store) Height(context.Context) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return uint64(len(s.offsets)), nil
+}
+
+// GetBlock satisfies the protocol.Store interface.
+func (s *Store) GetBlock(ctx context.Context, height uint64) (*bc.Block, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.getBlock(height)
+}
+
+func (s *Store) getBlock(height uint64) (*bc.Block, error) {
+	if height == 0 || height > uint64(len(s.offsets)) {
+		return nil, errors.WithDetailf(ErrNotFound, "height %d", height)
+	}
+	_, payload, _, err := s.readRecord(s.offsets[height-1], s.logSize)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading block %d", height)
+	}
+	b := new(bc.Block)
+	err = b.FromBytes(payload)
+	if err != nil {
+		return nil, errors.Wrapf(errors.Sub(ErrCorrupt, err), "parsing block %d", height)
+	}
+	return b, nil
+}
+
+// SaveBlock satisfies the protocol.Store interface.
+//
+// Blocks must be saved in height order. Saving a block at a height
+// that is already stored succeeds if it is the same block, and fails
+// with ErrConflict otherwise.
+func (s *Store) SaveBlock(ctx context.Context, b *bc.Block) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	height := uint64(len(s.offsets))
+	if b.Height <= height {
+		existing, err := s.getBlock(b.Height)
+		if err != nil {
+			return err
+		}
+		if existing.Hash() != b.Hash() {
+			return errors.WithDetailf(ErrConflict, "height %d", b.Height)
+		}
+		return nil
+	}
+	if b.Height != height+1 {
+		return errors.WithDetailf(ErrNonContiguous, "store height %d, block height %d", height, b.Height)
+	}
+
+	payload, err := b.Bytes()
+	if err != nil {
+		return errors.Wrap(err, "serializing block")
+	}
+	if int64(len(payload)) > int64(^uint32(0)) {
+		return fmt.Errorf("block %d too large to store (%d bytes)", b.Height, len(payload))
+	}
+
+	rec := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint64(rec[0:8], b.Height)
+	binary.BigEndian.PutUint32(rec[8:12], uint32(len(payload)))
+	binary.BigEndian.PutUint32(rec[12:16], checksum(rec[0:8], payload))
+	copy(rec[recordHeaderSize:], payload)
+
+	off := s.logSize
+	_, err = s.log.WriteAt(rec, off)
+	if err != nil {
+		return errors.Wrap(err, "writing block log")
+	}
+	err = s.log.Sync()
+	if err != nil {
+		return errors.Wrap(err, "syncing block log")
+	}
+
+	// The block is durable once the log is synced. The index entry
+	// is a cache of its position; if we crash before writing it,
+	// Open will rebuild it from the log.
+	var entry [indexEntrySize]byte
+	binary.BigEndian.PutUint64(entry[:], uint64(off))
+	_, err = s.index.WriteAt(entry[:], int64(len(s.offsets)*indexEntrySize))
+	if err != nil {
+		return errors.Wrap(err, "writing block index")
+	}
+	err = s.index.Sync()
+	if err != nil {
+		return errors.Wrap(err, "syncing block index")
+	}
+
+	s.offsets = append(s.offsets, off)
+	s.logSize = off + int64(len(rec))
+	return nil
+}
+
+// FinalizeHeight satisfies the protocol.Store interface. Blocks are
+// durable as soon as SaveBlock returns, and a Store is not shared
+// between processes, so there is nothing further to do.
+func (s *Store) FinalizeHeight(context.Context, uint64) error { return nil }
+
+// SaveSnapshot satisfies the protocol.Store interface.
+func (s *Store) SaveSnapshot(ctx context.Context, snapshot *state.Snapshot) error {
+	b, err := snapshot.Bytes()
+	if err != nil {
+		return errors.Wrap(err, "serializing snapshot")
+	}
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], checksum(b))
+
+	err = s.writeAtomic(snapshotName(snapshot.Height()), sum[:], b)
+	if err != nil {
+		return errors.Wrap(err, "writing snapshot")
+	}
+
+	// Best-effort cleanup of older snapshots, and of the deltas
+	// they make unnecessary.
+	heights, err := s.fileHeights(snapshotPrefix)
+	if err == nil && len(heights) > keepSnapshots {
+		for _, h := range heights[:len(heights)-keepSnapshots] {
+			os.Remove(filepath.Join(s.dir, snapshotName(h)))
+		}
+		heights = heights[len(heights)-keepSnapshots:]
+	}
+	if err == nil && len(heights) > 0 {
+		deltaHeights, err := s.fileHeights(deltaPrefix)
+		if err == nil {
+			for _, h := range deltaHeights {
+				if h <= heights[0] {
+					os.Remove(filepath.Join(s.dir, deltaName(h)))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// SaveDelta satisfies the protocol.DeltaStore interface.
+func (s *Store) SaveDelta(ctx context.Context, d *state.Delta) error {
+	b, err := d.Bytes()
+	if err != nil {
+		return errors.Wrap(err, "serializing delta")
+	}
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], checksum(b))
+	err = s.writeAtomic(deltaName(d.Header.Height), sum[:], b)
+	return errors.Wrap(err, "writing delta")
+}
+
+// Deltas satisfies the protocol.DeltaStore interface. A delta file
+// that fails its checksum ends the sequence, as a missing one does.
+func (s *Store) Deltas(ctx context.Context, height uint64) ([]*state.Delta, error) {
+	var deltas []*state.Delta
+	for h := height; ; h++ {
+		b, err := ioutil.ReadFile(filepath.Join(s.dir, deltaName(h)))
+		if os.IsNotExist(err) {
+			return deltas, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading delta %d", h)
+		}
+		if len(b) < 4 || checksum(b[4:]) != binary.BigEndian.Uint32(b[:4]) {
+			return deltas, nil
+		}
+		d := new(state.Delta)
+		err = d.FromBytes(b[4:])
+		if err != nil || d.Header == nil || d.Header.Height != h {
+			return deltas, nil
+		}
+		deltas = append(deltas, d)
+	}
+}
+
+// LatestSnapshot satisfies the protocol.Store interface. It returns
+// the most recent intact snapshot that is not ahead of the block
+// log, or an empty snapshot if there is none.
+func (s *Store) LatestSnapshot(ctx context.Context) (*state.Snapshot, error) {
+	heights, err := s.fileHeights(snapshotPrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "listing snapshots")
+	}
+	storeHeight, err := s.Height(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(heights) - 1; i >= 0; i-- {
+		if heights[i] > storeHeight {
+			continue
+		}
+		snapshot, err := s.readSnapshot(heights[i])
+		if errors.Root(err) == ErrCorrupt {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return snapshot, nil
+	}
+	return state.Empty(), nil
+}
+
+func (s *Store) readSnapshot(height uint64) (*state.Snapshot, error) {
+	b, err := ioutil.ReadFile(filepath.Join(s.dir, snapshotName(height)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading snapshot %d", height)
+	}
+	if len(b) < 4 || checksum(b[4:]) != binary.BigEndian.Uint32(b[:4]) {
+		return nil, errors.WithDetailf(ErrCorrupt, "bad checksum for snapshot %d", height)
+	}
+	snapshot := state.Empty()
+	err = snapshot.FromBytes(b[4:])
+	if err != nil {
+		return nil, errors.Wrapf(errors.Sub(ErrCorrupt, err), "parsing snapshot %d", height)
+	}
+	if snapshot.Height() != height {
+		return nil, errors.WithDetailf(ErrCorrupt, "snapshot file %d contains height %d", height, snapshot.Height())
+	}
+	return snapshot, nil
+}
+
+// fileHeights returns the heights of the snapshot or delta files,
+// according to prefix, in the store directory, in increasing order.
+func (s *Store) fileHeights(prefix string) ([]uint64, error) {
+	names, err := filepath.Glob(filepath.Join(s.dir, prefix+"*"))
+	if err != nil {
+		return nil, err
+	}
+	var heights []uint64
+	for _, name := range names {
+		base := filepath.Base(name)
+		if strings.HasSuffix(base, tmpSuffix) {
+			continue
+		}
+		h, err := strconv.ParseUint(strings.TrimPrefix(base, prefix), 10, 64)
+		if err != nil {
+			continue
+		}
+		heights = append(heights, h)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	return heights, nil
+}
+
+func snapshotName(height uint64) string {
+	return fmt.Sprintf("%s%020d", snapshotPrefix, height)
+}
+
+func deltaName(height uint64) string {
+	return fmt.Sprintf("%s%020d", deltaPrefix, height)
+}
+
+// writeAtomic writes parts to the named file in the store directory
+// by way of a temporary file, so that the file is either complete or
+// absent.
+func (s *Store) writeAtomic(name string, parts ...[]byte) error {
+	name = filepath.Join(s.dir, name)
+	err := writeFileSync(name+tmpSuffix, parts...)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(name+tmpSuffix, name)
+	if err != nil {
+		return errors.Wrap(err, "renaming")
+	}
+	return errors.Wrap(syncDir(s.dir), "syncing store directory")
+}
+
+func writeFileSync(name string, parts ...[]byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	for _, p := range parts {
+		_, err = f.Write(p)
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+	err = f.Sync()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
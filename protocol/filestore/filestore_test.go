@@ -0,0 +1,388 @@
+package filestore
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/bc/bctest"
+	"github.com/chain/txvm/protocol/prottest"
+	"github.com/chain/txvm/protocol/state"
+	"github.com/chain/txvm/testutil"
+)
+
+// newTestStore makes a Store in a temporary directory and commits
+// an initial block plus n more blocks to it, each with one
+// transaction. It returns the store's directory and the blocks.
+func newTestStore(t *testing.T, n int) (string, []*bc.Block) {
+	dir, err := ioutil.TempDir("", "filestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	s, err := Open(dir)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	defer s.Close()
+
+	c := prottest.NewChain(t, prottest.WithStore(s))
+	blocks := []*bc.Block{prottest.Initial(t, c)}
+	for i := 0; i < n; i++ {
+		tx := bctest.EmptyTx(t, blocks[0].Hash(), time.Now().Add(time.Hour))
+		blocks = append(blocks, prottest.MakeBlock(t, c, []*bc.Tx{tx}))
+	}
+	return dir, blocks
+}
+
+func TestSaveGetBlock(t *testing.T) {
+	ctx := context.Background()
+	dir, blocks := newTestStore(t, 3)
+
+	s, err := Open(dir)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	defer s.Close()
+
+	height, err := s.Height(ctx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if height != uint64(len(blocks)) {
+		t.Fatalf("Height() = %d, want %d", height, len(blocks))
+	}
+	for _, want := range blocks {
+		got, err := s.GetBlock(ctx, want.Height)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if got.Hash() != want.Hash() {
+			t.Errorf("GetBlock(%d) hash = %x, want %x", want.Height, got.Hash().Bytes(), want.Hash().Bytes())
+		}
+	}
+	_, err = s.GetBlock(ctx, height+1)
+	if errors.Root(err) != ErrNotFound {
+		t.Errorf("GetBlock(%d) error = %v, want %v", height+1, err, ErrNotFound)
+	}
+}
+
+func TestSaveBlockIdempotence(t *testing.T) {
+	ctx := context.Background()
+	dir, blocks := newTestStore(t, 2)
+
+	s, err := Open(dir)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	defer s.Close()
+
+	err = s.SaveBlock(ctx, blocks[1])
+	if err != nil {
+		t.Errorf("re-saving block 2: %v", err)
+	}
+
+	conflict := &bc.Block{UnsignedBlock: &bc.UnsignedBlock{BlockHeader: new(bc.BlockHeader)}}
+	*conflict.BlockHeader = *blocks[1].BlockHeader
+	conflict.TimestampMs++
+	err = s.SaveBlock(ctx, conflict)
+	if errors.Root(err) != ErrConflict {
+		t.Errorf("saving conflicting block: got error %v, want %v", err, ErrConflict)
+	}
+
+	gap := &bc.Block{UnsignedBlock: &bc.UnsignedBlock{BlockHeader: new(bc.BlockHeader)}}
+	*gap.BlockHeader = *blocks[2].BlockHeader
+	gap.Height += 2
+	err = s.SaveBlock(ctx, gap)
+	if errors.Root(err) != ErrNonContiguous {
+		t.Errorf("saving block past the end: got error %v, want %v", err, ErrNonContiguous)
+	}
+}
+
+func TestTornWrites(t *testing.T) {
+	cases := []struct {
+		name       string
+		damage     func(t *testing.T, dir string)
+		wantHeight uint64
+	}{{
+		name:       "torn log payload",
+		damage:     func(t *testing.T, dir string) { truncateBy(t, filepath.Join(dir, logName), 5) },
+		wantHeight: 3,
+	}, {
+		name: "torn log header",
+		damage: func(t *testing.T, dir string) {
+			appendTo(t, filepath.Join(dir, logName), []byte{0, 0, 0, 0, 0, 0, 0, 5, 0, 0})
+		},
+		wantHeight: 4,
+	}, {
+		name:       "torn index entry",
+		damage:     func(t *testing.T, dir string) { truncateBy(t, filepath.Join(dir, indexName), 3) },
+		wantHeight: 4,
+	}, {
+		name: "missing index",
+		damage: func(t *testing.T, dir string) {
+			err := os.Remove(filepath.Join(dir, indexName))
+			if err != nil {
+				t.Fatal(err)
+			}
+		},
+		wantHeight: 4,
+	}, {
+		name: "index ahead of log",
+		damage: func(t *testing.T, dir string) {
+			appendTo(t, filepath.Join(dir, indexName), []byte{0, 0, 0, 0, 0, 0, 0x10, 0})
+		},
+		wantHeight: 4,
+	}, {
+		name: "corrupt final record",
+		damage: func(t *testing.T, dir string) {
+			name := filepath.Join(dir, logName)
+			b, err := ioutil.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b[len(b)-1] ^= 0xff
+			err = ioutil.WriteFile(name, b, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		},
+		wantHeight: 3,
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+			dir, blocks := newTestStore(t, 3)
+			c.damage(t, dir)
+
+			s, err := Open(dir)
+			if err != nil {
+				testutil.FatalErr(t, err)
+			}
+			height, err := s.Height(ctx)
+			if err != nil {
+				testutil.FatalErr(t, err)
+			}
+			if height != c.wantHeight {
+				t.Fatalf("Height() = %d, want %d", height, c.wantHeight)
+			}
+
+			chain, err := protocol.NewChain(ctx, blocks[0], s, nil)
+			if err != nil {
+				testutil.FatalErr(t, err)
+			}
+			snapshot, err := chain.Recover(ctx)
+			if err != nil {
+				testutil.FatalErr(t, err)
+			}
+			if snapshot.Height() != height {
+				t.Errorf("recovered snapshot height = %d, want %d", snapshot.Height(), height)
+			}
+			want := blocks[height-1]
+			if snapshot.Header.Hash() != want.Hash() {
+				t.Errorf("recovered header %x, want %x", snapshot.Header.Hash().Bytes(), want.Hash().Bytes())
+			}
+
+			// The repaired store must accept the lost blocks again.
+			for _, b := range blocks[height:] {
+				err = s.SaveBlock(ctx, b)
+				if err != nil {
+					testutil.FatalErr(t, err)
+				}
+			}
+			s.Close()
+
+			s, err = Open(dir)
+			if err != nil {
+				testutil.FatalErr(t, err)
+			}
+			defer s.Close()
+			height, err = s.Height(ctx)
+			if err != nil {
+				testutil.FatalErr(t, err)
+			}
+			if height != uint64(len(blocks)) {
+				t.Errorf("after re-saving, Height() = %d, want %d", height, len(blocks))
+			}
+		})
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	ctx := context.Background()
+	dir, blocks := newTestStore(t, 3)
+
+	s, err := Open(dir)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	defer s.Close()
+
+	snapshot, err := s.LatestSnapshot(ctx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if snapshot.Height() != 0 {
+		t.Fatalf("initial snapshot height = %d, want 0", snapshot.Height())
+	}
+
+	var snapshots []*state.Snapshot
+	snapshot = state.Empty()
+	for _, b := range blocks {
+		snapshot, err = snapshot.ApplyBlock(b.UnsignedBlock)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		snapshots = append(snapshots, snapshot)
+		err = s.SaveSnapshot(ctx, snapshot)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+	}
+
+	names, err := filepath.Glob(filepath.Join(dir, snapshotPrefix+"*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != keepSnapshots {
+		t.Errorf("got %d snapshot files, want %d", len(names), keepSnapshots)
+	}
+
+	got, err := s.LatestSnapshot(ctx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	want := snapshots[len(snapshots)-1]
+	if !testutil.DeepEqual(got.Header, want.Header) {
+		t.Errorf("latest snapshot header = %v, want %v", got.Header, want.Header)
+	}
+	if got.ContractsTree.RootHash() != want.ContractsTree.RootHash() {
+		t.Error("latest snapshot has wrong contracts root")
+	}
+	if got.NonceTree.RootHash() != want.NonceTree.RootHash() {
+		t.Error("latest snapshot has wrong nonces root")
+	}
+	if !testutil.DeepEqual(got.RefIDs, want.RefIDs) {
+		t.Errorf("latest snapshot RefIDs = %v, want %v", got.RefIDs, want.RefIDs)
+	}
+
+	// A leftover temp file and a damaged latest snapshot are both
+	// skipped in favor of the previous intact snapshot.
+	err = ioutil.WriteFile(filepath.Join(dir, snapshotName(99)+tmpSuffix), []byte("partial"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncateBy(t, filepath.Join(dir, snapshotName(want.Height())), 1)
+
+	got, err = s.LatestSnapshot(ctx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if got.Height() != want.Height()-1 {
+		t.Errorf("after damage, latest snapshot height = %d, want %d", got.Height(), want.Height()-1)
+	}
+}
+
+func TestDeltas(t *testing.T) {
+	ctx := context.Background()
+	dir, blocks := newTestStore(t, 3)
+
+	s, err := Open(dir)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	defer s.Close()
+
+	// The chain saved a delta for each block.
+	deltas, err := s.Deltas(ctx, 1)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(deltas) != len(blocks) {
+		t.Fatalf("got %d deltas, want %d", len(deltas), len(blocks))
+	}
+	snapshot := state.Empty()
+	for i, d := range deltas {
+		snapshot, err = snapshot.ApplyDelta(d)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if snapshot.ContractsTree.RootHash() != blocks[i].ContractsRoot.Byte32() {
+			t.Errorf("after delta %d, wrong contracts root", d.Header.Height)
+		}
+	}
+
+	// Recovery from the deltas alone reaches the tip.
+	c, err := protocol.NewChain(ctx, blocks[0], s, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	recovered, err := c.Recover(ctx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if recovered.Height() != 4 {
+		t.Errorf("recovered height = %d, want 4", recovered.Height())
+	}
+
+	// A damaged delta ends the sequence.
+	truncateBy(t, filepath.Join(dir, deltaName(3)), 1)
+	deltas, err = s.Deltas(ctx, 1)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(deltas) != 2 {
+		t.Errorf("after damage, got %d deltas, want 2", len(deltas))
+	}
+
+	// Saving a snapshot removes the deltas it covers.
+	snapshot = state.Empty()
+	for _, b := range blocks[:3] {
+		snapshot, err = snapshot.ApplyBlock(b.UnsignedBlock)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+	}
+	err = s.SaveSnapshot(ctx, snapshot)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	names, err := filepath.Glob(filepath.Join(dir, deltaPrefix+"*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || filepath.Base(names[0]) != deltaName(4) {
+		t.Errorf("after snapshot, got delta files %v, want only %s", names, deltaName(4))
+	}
+}
+
+func truncateBy(t *testing.T, name string, n int64) {
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Truncate(name, info.Size()-n)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func appendTo(t *testing.T, name string, b []byte) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, err = f.Write(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,442 @@
+package protocol
+
+import (
+	"context"
+	"sync"
+
+	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/state"
+	"github.com/chain/txvm/protocol/validation"
+)
+
+var (
+	// ErrUnknownParent is returned by ForkChoice.AddBlock when the
+	// block's previous block is neither the Chain's committed tip
+	// nor a block held by the ForkChoice.
+	ErrUnknownParent = errors.New("unknown parent block")
+
+	// ErrStaleBlock is returned by ForkChoice.AddBlock when the block
+	// is not higher than the Chain's committed height.
+	ErrStaleBlock = errors.New("block is at or below the committed height")
+
+	// ErrUnknownBlock is returned by ForkChoice.AddSignature and
+	// ForkChoice.Finalize when the named block is not held by the
+	// ForkChoice.
+	ErrUnknownBlock = errors.New("unknown block")
+
+	// ErrBadSignature is returned when a block signature does not
+	// verify against the corresponding public key in the previous
+	// block's NextPredicate.
+	ErrBadSignature = errors.New("invalid block signature")
+)
+
+// ForkChoice holds competing, not-yet-committed blocks on top of a
+// Chain's committed state, for networks where more than one block
+// may be proposed at a height.
+//
+// Each block added to a ForkChoice is validated against the state
+// snapshot of its parent, which is either the Chain's committed tip
+// or another held block. Signatures may arrive with the block or
+// separately. A block becomes eligible to be the canonical tip once
+// it carries a quorum of valid signatures (per its parent's
+// NextPredicate) and its parent is eligible too. The canonical tip
+// is the highest eligible block; ties go to the block that became
+// eligible first.
+//
+// When the tip moves to a different branch, subscribers are notified
+// of the blocks rolled back and the blocks applied. Blocks reach the
+// Chain's Store only when Finalize is called.
+type ForkChoice struct {
+	chain *Chain
+
+	mu      sync.Mutex // protects the following
+	blocks  map[bc.Hash]*candidate
+	order   []*candidate // the held blocks, in the order added
+	tip     *candidate   // nil means the chain's committed tip
+	nextSeq uint64
+
+	notifyMu sync.Mutex // serializes notifications
+	subsMu   sync.Mutex
+	subs     []chan TipChange
+}
+
+// TipChange describes a move of a ForkChoice's canonical tip.
+type TipChange struct {
+	// RolledBack lists the blocks removed from the canonical
+	// chain, from the old tip downward.
+	RolledBack []*bc.Block
+
+	// Applied lists the blocks added to the canonical chain, from
+	// lowest to highest. Its last element is the new tip.
+	Applied []*bc.Block
+
+	// Snapshot is the state after the new tip.
+	Snapshot *state.Snapshot
+}
+
+type candidate struct {
+	block    *bc.Block
+	parent   *candidate // nil if the parent is the committed tip
+	snapshot *state.Snapshot
+	sigs     int32
+	quorum   int32
+	eligible bool
+	seq      uint64 // order of becoming eligible, for breaking ties
+}
+
+// NewForkChoice returns a ForkChoice building on c's current state.
+func NewForkChoice(c *Chain) *ForkChoice {
+	return &ForkChoice{
+		chain:  c,
+		blocks: make(map[bc.Hash]*candidate),
+	}
+}
+
+// Subscribe returns a channel on which every subsequent change of the
+// canonical tip is delivered. Subscribers must receive promptly;
+// AddBlock and AddSignature block until each notification has been
+// delivered.
+func (f *ForkChoice) Subscribe() <-chan TipChange {
+	ch := make(chan TipChange, 1)
+	f.subsMu.Lock()
+	f.subs = append(f.subs, ch)
+	f.subsMu.Unlock()
+	return ch
+}
+
+// Tip returns the canonical tip block and the state after it. If no
+// held block is eligible, it returns nil and the Chain's state.
+func (f *ForkChoice) Tip() (*bc.Block, *state.Snapshot) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.tip == nil {
+		return nil, f.chain.State()
+	}
+	return f.tip.block, f.tip.snapshot
+}
+
+// AddBlock validates b against its parent's state and holds it as a
+// candidate. Any signatures in b.Arguments are verified and recorded.
+// Adding a block that is already held merges its signatures with
+// those already recorded.
+func (f *ForkChoice) AddBlock(ctx context.Context, b *bc.Block) error {
+	f.notifyMu.Lock()
+	defer f.notifyMu.Unlock()
+
+	change, err := f.addBlock(b)
+	if err != nil {
+		return err
+	}
+	f.notify(change)
+	return nil
+}
+
+func (f *ForkChoice) addBlock(b *bc.Block) (*TipChange, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := b.Hash()
+	if cand, ok := f.blocks[id]; ok {
+		err := f.addSigs(cand, b.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		return f.updateTip(), nil
+	}
+
+	base := f.chain.State()
+	if b.Height <= base.Height() {
+		return nil, errors.WithDetailf(ErrStaleBlock, "block height %d, committed height %d", b.Height, base.Height())
+	}
+
+	var (
+		parent     *candidate
+		parentSnap = base
+	)
+	if b.PreviousBlockId == nil {
+		return nil, errors.WithDetail(ErrUnknownParent, "no previous block ID")
+	}
+	if *b.PreviousBlockId != base.Header.Hash() {
+		var ok bool
+		parent, ok = f.blocks[*b.PreviousBlockId]
+		if !ok {
+			return nil, errors.WithDetailf(ErrUnknownParent, "previous block %x", b.PreviousBlockId.Bytes())
+		}
+		parentSnap = parent.snapshot
+	}
+
+	err := validation.Block(b.UnsignedBlock, parentSnap.Header)
+	if err != nil {
+		return nil, errors.Wrap(err, "validating block")
+	}
+	snapshot, err := parentSnap.ApplyBlock(b.UnsignedBlock)
+	if err != nil {
+		return nil, errors.Wrap(err, "applying block")
+	}
+	if b.ContractsRoot.Byte32() != snapshot.ContractsTree.RootHash() {
+		return nil, ErrBadContractsRoot
+	}
+	if b.NoncesRoot.Byte32() != snapshot.NonceTree.RootHash() {
+		return nil, ErrBadNoncesRoot
+	}
+
+	pred := parentSnap.Header.NextPredicate
+	if pred.Version != 1 || pred.Quorum < 0 || int(pred.Quorum) > len(pred.Pubkeys) {
+		return nil, errors.WithDetailf(ErrBadSignature, "unusable predicate: version %d, quorum %d, pubkeys %d", pred.Version, pred.Quorum, len(pred.Pubkeys))
+	}
+	cand := &candidate{
+		block: &bc.Block{
+			UnsignedBlock: b.UnsignedBlock,
+			Arguments:     make([]interface{}, len(pred.Pubkeys)),
+		},
+		parent:   parent,
+		snapshot: snapshot,
+		quorum:   pred.Quorum,
+	}
+	for i := range cand.block.Arguments {
+		cand.block.Arguments[i] = []byte{}
+	}
+	err = f.addSigs(cand, b.Arguments)
+	if err != nil {
+		return nil, err
+	}
+	f.blocks[id] = cand
+	f.order = append(f.order, cand)
+	return f.updateTip(), nil
+}
+
+// addSigs verifies the non-empty signatures in args and, only if all
+// are valid, records them in cand.
+func (f *ForkChoice) addSigs(cand *candidate, args []interface{}) error {
+	for i, arg := range args {
+		sig, _ := arg.([]byte)
+		if len(sig) == 0 {
+			continue
+		}
+		err := f.verifySig(cand, i, sig)
+		if err != nil {
+			return err
+		}
+	}
+	for i, arg := range args {
+		if sig, _ := arg.([]byte); len(sig) > 0 {
+			recordSig(cand, i, sig)
+		}
+	}
+	return nil
+}
+
+// AddSignature records the signature at the given position of the
+// held block with the given ID, possibly moving the canonical tip.
+func (f *ForkChoice) AddSignature(ctx context.Context, blockID bc.Hash, index int, sig []byte) error {
+	f.notifyMu.Lock()
+	defer f.notifyMu.Unlock()
+
+	change, err := f.addSignature(blockID, index, sig)
+	if err != nil {
+		return err
+	}
+	f.notify(change)
+	return nil
+}
+
+func (f *ForkChoice) addSignature(blockID bc.Hash, index int, sig []byte) (*TipChange, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	cand, ok := f.blocks[blockID]
+	if !ok {
+		return nil, errors.WithDetailf(ErrUnknownBlock, "block %x", blockID.Bytes())
+	}
+	err := f.verifySig(cand, index, sig)
+	if err != nil {
+		return nil, err
+	}
+	recordSig(cand, index, sig)
+	return f.updateTip(), nil
+}
+
+// verifySig checks that sig is a valid signature of cand's block at
+// the given position of its parent's NextPredicate.
+func (f *ForkChoice) verifySig(cand *candidate, index int, sig []byte) error {
+	pred := f.parentHeader(cand).NextPredicate
+	if index < 0 || index >= len(pred.Pubkeys) {
+		return errors.WithDetailf(ErrBadSignature, "signature index %d, pubkeys %d", index, len(pred.Pubkeys))
+	}
+	pk := pred.Pubkeys[index]
+	if len(pk) != ed25519.PublicKeySize || len(sig) != ed25519.SignatureSize {
+		return errors.WithDetailf(ErrBadSignature, "public key length %d, signature length %d", len(pk), len(sig))
+	}
+	if !ed25519.Verify(pk, cand.block.Hash().Bytes(), sig) {
+		return errors.WithDetailf(ErrBadSignature, "signature %d for block %x", index, cand.block.Hash().Bytes())
+	}
+	return nil
+}
+
+// recordSig records a verified signature in cand. A signature already
+// recorded at the same position is not counted twice.
+func recordSig(cand *candidate, index int, sig []byte) {
+	if prev, _ := cand.block.Arguments[index].([]byte); len(prev) == 0 {
+		cand.sigs++
+	}
+	cand.block.Arguments[index] = sig
+}
+
+func (f *ForkChoice) parentHeader(cand *candidate) *bc.BlockHeader {
+	if cand.parent != nil {
+		return cand.parent.block.BlockHeader
+	}
+	return f.chain.State().Header
+}
+
+// updateTip marks newly eligible candidates and moves the tip to the
+// highest eligible one if that is higher than the current tip. It
+// returns the resulting change, or nil if the tip did not move.
+func (f *ForkChoice) updateTip() *TipChange {
+	// Eligibility propagates from parents to children, and
+	// signatures may arrive in any order, so iterate to a fixed
+	// point. Blocks becoming eligible in the same call are ordered
+	// by when they were added.
+	for changed := true; changed; {
+		changed = false
+		for _, cand := range f.order {
+			if cand.eligible || cand.sigs < cand.quorum {
+				continue
+			}
+			if cand.parent == nil || cand.parent.eligible {
+				cand.eligible = true
+				cand.seq = f.nextSeq
+				f.nextSeq++
+				changed = true
+			}
+		}
+	}
+
+	best := f.tip
+	for _, cand := range f.order {
+		if !cand.eligible {
+			continue
+		}
+		if best == nil || cand.block.Height > best.block.Height ||
+			(cand.block.Height == best.block.Height && cand.seq < best.seq) {
+			best = cand
+		}
+	}
+	if best == f.tip {
+		return nil
+	}
+
+	change := &TipChange{Snapshot: best.snapshot}
+	onNewBranch := make(map[*candidate]bool)
+	for c := best; c != nil; c = c.parent {
+		onNewBranch[c] = true
+	}
+	for c := f.tip; c != nil && !onNewBranch[c]; c = c.parent {
+		change.RolledBack = append(change.RolledBack, c.block)
+	}
+	var fork *candidate
+	for c := f.tip; c != nil; c = c.parent {
+		if onNewBranch[c] {
+			fork = c
+			break
+		}
+	}
+	for c := best; c != fork; c = c.parent {
+		change.Applied = append([]*bc.Block{c.block}, change.Applied...)
+	}
+	f.tip = best
+	return change
+}
+
+func (f *ForkChoice) notify(change *TipChange) {
+	if change == nil {
+		return
+	}
+	f.subsMu.Lock()
+	subs := append([]chan TipChange(nil), f.subs...)
+	f.subsMu.Unlock()
+	for _, ch := range subs {
+		ch <- *change
+	}
+}
+
+// Finalize commits the canonical chain up to and including the given
+// height to the Chain, then discards every held block at or below
+// that height and every block that does not descend from the new
+// committed tip.
+func (f *ForkChoice) Finalize(ctx context.Context, height uint64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var path []*candidate
+	for c := f.tip; c != nil; c = c.parent {
+		if c.block.Height <= height {
+			path = append([]*candidate{c}, path...)
+		}
+	}
+	if len(path) == 0 || path[len(path)-1].block.Height != height {
+		return errors.WithDetailf(ErrUnknownBlock, "no canonical block at height %d", height)
+	}
+
+	for _, c := range path {
+		err := f.chain.CommitAppliedBlock(ctx, quorumBlock(c), c.snapshot)
+		if err != nil {
+			return errors.Wrapf(err, "committing block %d", c.block.Height)
+		}
+	}
+
+	newBase := path[len(path)-1]
+	if f.tip == newBase {
+		f.tip = nil
+	}
+	kept := f.order[:0]
+	for _, c := range f.order {
+		if c.block.Height <= height || !descends(c, newBase) {
+			delete(f.blocks, c.block.Hash())
+		} else {
+			kept = append(kept, c)
+		}
+	}
+	for i := len(kept); i < len(f.order); i++ {
+		f.order[i] = nil
+	}
+	f.order = kept
+	for _, c := range f.order {
+		if c.parent == newBase {
+			c.parent = nil
+		}
+	}
+	return nil
+}
+
+func descends(c, ancestor *candidate) bool {
+	for ; c != nil; c = c.parent {
+		if c.parent == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// quorumBlock returns a copy of c's block carrying exactly a quorum
+// of signatures, as validation.BlockSig requires.
+func quorumBlock(c *candidate) *bc.Block {
+	b := &bc.Block{
+		UnsignedBlock: c.block.UnsignedBlock,
+		Arguments:     make([]interface{}, len(c.block.Arguments)),
+	}
+	n := c.quorum
+	for i, arg := range c.block.Arguments {
+		sig, _ := arg.([]byte)
+		if n > 0 && len(sig) > 0 {
+			b.Arguments[i] = sig
+			n--
+		} else {
+			b.Arguments[i] = []byte{}
+		}
+	}
+	return b
+}
@@ -0,0 +1,255 @@
+package protocol
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/prottest/memstore"
+	"github.com/chain/txvm/protocol/state"
+	"github.com/chain/txvm/testutil"
+)
+
+// newSignedTestChain is like newTestChain but requires 2 of 3
+// signatures on every block after the first.
+func newSignedTestChain(tb testing.TB, ts time.Time) (*Chain, []ed25519.PrivateKey) {
+	ctx := context.Background()
+
+	var (
+		pubkeys  []ed25519.PublicKey
+		privkeys []ed25519.PrivateKey
+	)
+	for i := 0; i < 3; i++ {
+		pub, priv, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			testutil.FatalErr(tb, err)
+		}
+		pubkeys = append(pubkeys, pub)
+		privkeys = append(privkeys, priv)
+	}
+
+	b1, err := NewInitialBlock(pubkeys, 2, ts)
+	if err != nil {
+		testutil.FatalErr(tb, err)
+	}
+	c, err := NewChain(ctx, b1, memstore.New(), nil)
+	if err != nil {
+		testutil.FatalErr(tb, err)
+	}
+	st, err := state.Empty().ApplyBlock(b1.UnsignedBlock)
+	if err != nil {
+		testutil.FatalErr(tb, err)
+	}
+	err = c.CommitAppliedBlock(ctx, b1, st)
+	if err != nil {
+		testutil.FatalErr(tb, err)
+	}
+	return c, privkeys
+}
+
+// buildOn returns an unsigned block with no transactions on top of
+// the given state.
+func buildOn(tb testing.TB, snapshot *state.Snapshot, timestampMS uint64) (*bc.Block, *state.Snapshot) {
+	bb := NewBlockBuilder()
+	err := bb.Start(snapshot, timestampMS)
+	if err != nil {
+		testutil.FatalErr(tb, err)
+	}
+	ub, next, err := bb.Build()
+	if err != nil {
+		testutil.FatalErr(tb, err)
+	}
+	return &bc.Block{UnsignedBlock: ub}, next
+}
+
+func signAt(b *bc.Block, key ed25519.PrivateKey) []byte {
+	return ed25519.Sign(key, b.Hash().Bytes())
+}
+
+func TestForkChoiceReorg(t *testing.T) {
+	ctx := context.Background()
+	c, keys := newSignedTestChain(t, time.Now())
+	f := NewForkChoice(c)
+	changes := f.Subscribe()
+
+	base := c.State()
+	a2, _ := buildOn(t, base, base.TimestampMS()+1)
+	b2, bSnap := buildOn(t, base, base.TimestampMS()+2)
+	b3, _ := buildOn(t, bSnap, bSnap.TimestampMS()+1)
+
+	for _, b := range []*bc.Block{a2, b2, b3} {
+		err := f.AddBlock(ctx, b)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+	}
+	if tip, _ := f.Tip(); tip != nil {
+		t.Fatalf("tip without signatures = block %d, want none", tip.Height)
+	}
+
+	// One signature is not a quorum.
+	err := f.AddSignature(ctx, a2.Hash(), 0, signAt(a2, keys[0]))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if tip, _ := f.Tip(); tip != nil {
+		t.Fatalf("tip with one signature = block %d, want none", tip.Height)
+	}
+
+	err = f.AddSignature(ctx, a2.Hash(), 1, signAt(a2, keys[1]))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	change := <-changes
+	if len(change.RolledBack) != 0 || len(change.Applied) != 1 || change.Applied[0].Hash() != a2.Hash() {
+		t.Fatalf("first change = %+v, want a2 applied", change)
+	}
+
+	// b3 reaches quorum before its parent, so it cannot be the tip yet.
+	for i := 1; i < 3; i++ {
+		err = f.AddSignature(ctx, b3.Hash(), i, signAt(b3, keys[i]))
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+	}
+	if tip, _ := f.Tip(); tip.Hash() != a2.Hash() {
+		t.Fatalf("tip = %x, want a2", tip.Hash().Bytes())
+	}
+
+	// Signatures for b2 arriving with the block itself make the b
+	// branch eligible and longer.
+	signed := &bc.Block{UnsignedBlock: b2.UnsignedBlock, Arguments: []interface{}{signAt(b2, keys[0]), []byte{}, signAt(b2, keys[2])}}
+	err = f.AddBlock(ctx, signed)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	change = <-changes
+	if len(change.RolledBack) != 1 || change.RolledBack[0].Hash() != a2.Hash() {
+		t.Errorf("rolled back %v, want [a2]", change.RolledBack)
+	}
+	if len(change.Applied) != 2 || change.Applied[0].Hash() != b2.Hash() || change.Applied[1].Hash() != b3.Hash() {
+		t.Errorf("applied %v, want [b2 b3]", change.Applied)
+	}
+
+	err = f.Finalize(ctx, 3)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if c.Height() != 3 {
+		t.Fatalf("chain height = %d, want 3", c.Height())
+	}
+	got, err := c.GetBlock(ctx, 2)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if got.Hash() != b2.Hash() {
+		t.Errorf("committed block 2 = %x, want b2", got.Hash().Bytes())
+	}
+	if tip, _ := f.Tip(); tip != nil {
+		t.Errorf("tip after finalize = block %d, want none", tip.Height)
+	}
+
+	err = f.AddBlock(ctx, a2)
+	if errors.Root(err) != ErrStaleBlock {
+		t.Errorf("re-adding a2 after finalize: got error %v, want %v", err, ErrStaleBlock)
+	}
+}
+
+func TestForkChoiceRejects(t *testing.T) {
+	ctx := context.Background()
+	c, keys := newSignedTestChain(t, time.Now())
+	f := NewForkChoice(c)
+
+	base := c.State()
+	b2, b2Snap := buildOn(t, base, base.TimestampMS()+1)
+	err := f.AddBlock(ctx, b2)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	orphanParent, _ := buildOn(t, base, base.TimestampMS()+2)
+	orphan, _ := buildOn(t, stateAfter(t, base, orphanParent), base.TimestampMS()+3)
+	err = f.AddBlock(ctx, orphan)
+	if errors.Root(err) != ErrUnknownParent {
+		t.Errorf("adding orphan: got error %v, want %v", err, ErrUnknownParent)
+	}
+
+	bad, _ := buildOn(t, b2Snap, b2Snap.TimestampMS()+1)
+	bogus := bc.NewHash([32]byte{1})
+	bad.NoncesRoot = &bogus
+	err = f.AddBlock(ctx, bad)
+	if errors.Root(err) != ErrBadNoncesRoot {
+		t.Errorf("adding block with bad nonces root: got error %v, want %v", err, ErrBadNoncesRoot)
+	}
+
+	err = f.AddSignature(ctx, b2.Hash(), 0, signAt(b2, keys[1]))
+	if errors.Root(err) != ErrBadSignature {
+		t.Errorf("adding signature by wrong key: got error %v, want %v", err, ErrBadSignature)
+	}
+	err = f.AddSignature(ctx, bc.Hash{}, 0, signAt(b2, keys[0]))
+	if errors.Root(err) != ErrUnknownBlock {
+		t.Errorf("signing unknown block: got error %v, want %v", err, ErrUnknownBlock)
+	}
+
+	// Re-adding a held block with one good and one bad signature
+	// records neither.
+	mixed := &bc.Block{UnsignedBlock: b2.UnsignedBlock, Arguments: []interface{}{signAt(b2, keys[0]), signAt(b2, keys[0]), []byte{}}}
+	err = f.AddBlock(ctx, mixed)
+	if errors.Root(err) != ErrBadSignature {
+		t.Errorf("re-adding block with a bad signature: got error %v, want %v", err, ErrBadSignature)
+	}
+	if sigs := f.blocks[b2.Hash()].sigs; sigs != 0 {
+		t.Errorf("after rejected signatures, block has %d signatures, want 0", sigs)
+	}
+}
+
+func TestForkChoiceTieBreak(t *testing.T) {
+	ctx := context.Background()
+
+	// Repeat, since a tie broken by map iteration order would pass
+	// some of the time.
+	for i := 0; i < 20; i++ {
+		c, keys := newSignedTestChain(t, time.Now())
+		f := NewForkChoice(c)
+
+		base := c.State()
+		p2, pSnap := buildOn(t, base, base.TimestampMS()+1)
+		x3, _ := buildOn(t, pSnap, pSnap.TimestampMS()+1)
+		y3, _ := buildOn(t, pSnap, pSnap.TimestampMS()+2)
+
+		err := f.AddBlock(ctx, p2)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		for _, b := range []*bc.Block{x3, y3} {
+			signed := &bc.Block{UnsignedBlock: b.UnsignedBlock, Arguments: []interface{}{signAt(b, keys[0]), signAt(b, keys[1]), []byte{}}}
+			err = f.AddBlock(ctx, signed)
+			if err != nil {
+				testutil.FatalErr(t, err)
+			}
+		}
+
+		// Signing p2 makes p2, x3, and y3 eligible at once. x3 was
+		// added first, so it wins the tie.
+		for j := 0; j < 2; j++ {
+			err = f.AddSignature(ctx, p2.Hash(), j, signAt(p2, keys[j]))
+			if err != nil {
+				testutil.FatalErr(t, err)
+			}
+		}
+		if tip, _ := f.Tip(); tip == nil || tip.Hash() != x3.Hash() {
+			t.Fatalf("run %d: tip is not x3, the first of the tied blocks", i)
+		}
+	}
+}
+
+func stateAfter(tb testing.TB, snapshot *state.Snapshot, b *bc.Block) *state.Snapshot {
+	s, err := snapshot.ApplyBlock(b.UnsignedBlock)
+	if err != nil {
+		testutil.FatalErr(tb, err)
+	}
+	return s
+}
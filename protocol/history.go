@@ -0,0 +1,35 @@
+package protocol
+
+import (
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/state"
+)
+
+// defaultHistoryBlocks is the number of recent heights whose state
+// a Chain retains by default.
+const defaultHistoryBlocks = uint64(100)
+
+// ErrNoSnapshot is returned by SnapshotAt for heights whose state
+// the Chain has not retained.
+var ErrNoSnapshot = errors.New("no state snapshot at height")
+
+// SnapshotAt returns the blockchain state as of the given height.
+// The state is available for the current height, and for past
+// heights that c has committed or recovered and that its history
+// policy retains (see SetHistoryPolicy).
+func (c *Chain) SnapshotAt(height uint64) (*state.Snapshot, error) {
+	if s := c.State(); s.Height() == height {
+		return s, nil
+	}
+	if s, ok := c.history.At(height); ok {
+		return s, nil
+	}
+	return nil, errors.WithDetailf(ErrNoSnapshot, "height %d", height)
+}
+
+// SetHistoryPolicy sets the policy deciding which past states c
+// retains for SnapshotAt. By default, c retains the states at the
+// most recent 100 heights.
+func (c *Chain) SetHistoryPolicy(policy state.RetentionPolicy) {
+	c.history.SetPolicy(policy)
+}
@@ -0,0 +1,79 @@
+package protocol
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/state"
+	"github.com/chain/txvm/testutil"
+)
+
+func TestSnapshotAt(t *testing.T) {
+	ctx := context.Background()
+	c, b1 := newTestChain(t, time.Now().Add(-time.Minute))
+
+	// The block at height h creates the contract with ID {h}.
+	contract := func(h uint64) []byte { return bc.NewHash([32]byte{byte(h)}).Bytes() }
+	prev := c.State()
+	for h := uint64(2); h <= 6; h++ {
+		tx := &bc.Tx{
+			ID:        bc.NewHash([32]byte{byte(h)}),
+			Contracts: []bc.Contract{{Type: bc.OutputType, ID: bc.NewHash([32]byte{byte(h)})}},
+			Finalized: true,
+		}
+		ub, snapshot, err := c.GenerateBlock(ctx, prev.TimestampMS()+1, []*bc.CommitmentsTx{bc.NewCommitmentsTx(tx)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := bc.SignBlock(ub, prev.Header, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.CommitAppliedBlock(ctx, b, snapshot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prev = snapshot
+	}
+
+	check := func(c *Chain, h uint64) {
+		t.Helper()
+		s, err := c.SnapshotAt(h)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if s.Height() != h {
+			t.Errorf("SnapshotAt(%d) has height %d", h, s.Height())
+		}
+		if !s.ContractsTree.Contains(contract(h)) || s.ContractsTree.Contains(contract(h+1)) {
+			t.Errorf("SnapshotAt(%d) has the wrong contracts", h)
+		}
+	}
+	for h := uint64(2); h <= 6; h++ {
+		check(c, h)
+	}
+
+	c.SetHistoryPolicy(state.KeepRecent(2))
+	_, err := c.SnapshotAt(4)
+	if errors.Root(err) != ErrNoSnapshot {
+		t.Errorf("SnapshotAt(4) got error %v, want %s", err, ErrNoSnapshot)
+	}
+	check(c, 5)
+	check(c, 6)
+
+	// A recovered chain has the states it rebuilt.
+	c2, err := NewChain(ctx, b1, c.store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c2.Recover(ctx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	for h := uint64(2); h <= 6; h++ {
+		check(c2, h)
+	}
+}
@@ -0,0 +1,161 @@
+// Package lightclient follows a blockchain by its block headers
+// alone.
+//
+// A HeaderChain starts from a trusted block header, obtained out of
+// band (for example, the initial block of the chain). Each
+// subsequent header is accepted only if it correctly follows the
+// previous one and carries a quorum of signatures from the keys in
+// the previous header's NextPredicate. Since every header names the
+// predicate for the next, trust passes from the trusted header to
+// every header accepted after it, across any changes of the signer
+// set along the way.
+//
+// Accepted headers can then be used to check transaction inclusion
+// proofs (see bc.TxInclusionProof) and contract proofs (see
+// state.Snapshot.ProveContract) without downloading any
+// transactions.
+package lightclient
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/merkle"
+	"github.com/chain/txvm/protocol/state"
+	"github.com/chain/txvm/protocol/validation"
+)
+
+var (
+	// ErrNotFound is returned when no accepted header has the
+	// requested height.
+	ErrNotFound = errors.New("no header at that height")
+
+	// ErrBadTxProof is returned by VerifyTx when the proof does not
+	// match the header.
+	ErrBadTxProof = errors.New("invalid transaction inclusion proof")
+
+	// ErrMalformedHeader is returned by Accept when the header is
+	// missing a field needed to check it.
+	ErrMalformedHeader = errors.New("malformed block header")
+)
+
+// Rotation records a change of block signers: the header at Height
+// has a NextPredicate that differs from its predecessor's.
+type Rotation struct {
+	Height    uint64
+	Predicate *bc.Predicate
+}
+
+// HeaderChain is a sequence of verified block headers. It is safe
+// for concurrent use.
+type HeaderChain struct {
+	mu        sync.Mutex
+	headers   []*bc.BlockHeader // headers[i] is at height headers[0].Height+i
+	rotations []Rotation
+}
+
+// New returns a HeaderChain whose first header is trusted.
+func New(trusted *bc.BlockHeader) *HeaderChain {
+	return &HeaderChain{headers: []*bc.BlockHeader{trusted}}
+}
+
+// Accept verifies that h follows the current tip and is signed by
+// a quorum of the tip's NextPredicate, then makes h the new tip.
+// The args are the block's signatures, as in bc.Block.Arguments.
+func (c *HeaderChain) Accept(h *bc.BlockHeader, args []interface{}) error {
+	switch {
+	case h == nil:
+		return errors.WithDetail(ErrMalformedHeader, "nil header")
+	case h.PreviousBlockId == nil:
+		return errors.WithDetailf(ErrMalformedHeader, "header %d has no previous block ID", h.Height)
+	case h.NextPredicate == nil:
+		return errors.WithDetailf(ErrMalformedHeader, "header %d has no next predicate", h.Height)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prev := c.headers[len(c.headers)-1]
+	ub := &bc.UnsignedBlock{BlockHeader: h}
+	err := validation.BlockPrev(ub, prev)
+	if err != nil {
+		return errors.Wrapf(err, "checking header %d against previous header", h.Height)
+	}
+	err = validation.BlockSig(&bc.Block{UnsignedBlock: ub, Arguments: args}, prev.NextPredicate)
+	if err != nil {
+		return errors.Wrapf(err, "checking signatures of header %d", h.Height)
+	}
+
+	if !samePredicate(h.NextPredicate, prev.NextPredicate) {
+		c.rotations = append(c.rotations, Rotation{Height: h.Height, Predicate: h.NextPredicate})
+	}
+	c.headers = append(c.headers, h)
+	return nil
+}
+
+func samePredicate(a, b *bc.Predicate) bool {
+	if a.Version != b.Version || a.Quorum != b.Quorum || len(a.Pubkeys) != len(b.Pubkeys) {
+		return false
+	}
+	for i := range a.Pubkeys {
+		if !bytes.Equal(a.Pubkeys[i], b.Pubkeys[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Tip returns the most recently accepted header, or the trusted
+// header if none has been accepted.
+func (c *HeaderChain) Tip() *bc.BlockHeader {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.headers[len(c.headers)-1]
+}
+
+// Header returns the accepted header at the given height.
+func (c *HeaderChain) Header(height uint64) (*bc.BlockHeader, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	first := c.headers[0].Height
+	if height < first || height-first >= uint64(len(c.headers)) {
+		return nil, errors.WithDetailf(ErrNotFound, "height %d", height)
+	}
+	return c.headers[height-first], nil
+}
+
+// Rotations returns the changes of block signers seen in the
+// accepted headers, in order of height.
+func (c *HeaderChain) Rotations() []Rotation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Rotation(nil), c.rotations...)
+}
+
+// VerifyTx checks a proof, as returned by bc.TxInclusionProof, that
+// the transaction with the given witness commitment is in the block
+// at the given height.
+func (c *HeaderChain) VerifyTx(height uint64, witnessCommitment []byte, proof []merkle.AuditHash) error {
+	h, err := c.Header(height)
+	if err != nil {
+		return err
+	}
+	if !bc.VerifyTxInclusion(h, witnessCommitment, proof) {
+		return errors.WithDetailf(ErrBadTxProof, "height %d", height)
+	}
+	return nil
+}
+
+// VerifyContract checks a contract proof against the accepted header
+// at the proof's height. It reports whether the proof shows the
+// contract to be unspent at that height.
+func (c *HeaderChain) VerifyContract(p *state.ContractProof) (unspent bool, err error) {
+	h, err := c.Header(p.Height)
+	if err != nil {
+		return false, err
+	}
+	return p.Verify(h)
+}
@@ -0,0 +1,174 @@
+package lightclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/testutil"
+)
+
+type signer struct {
+	pub  ed25519.PublicKey
+	priv ed25519.PrivateKey
+}
+
+func newSigner(t *testing.T) signer {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer{pub, priv}
+}
+
+func predicate(signers ...signer) *bc.Predicate {
+	p := &bc.Predicate{Version: 1, Quorum: int32(len(signers))}
+	for _, s := range signers {
+		p.Pubkeys = append(p.Pubkeys, s.pub)
+	}
+	return p
+}
+
+// next returns a header following prev, with the given next
+// predicate and transactions root, and signatures from signers
+// (which must be the signers of prev's NextPredicate).
+func next(prev *bc.BlockHeader, pred *bc.Predicate, txRoot bc.Hash, signers ...signer) (*bc.BlockHeader, []interface{}) {
+	prevID := prev.Hash()
+	h := &bc.BlockHeader{
+		Version:          prev.Version,
+		Height:           prev.Height + 1,
+		PreviousBlockId:  &prevID,
+		TimestampMs:      prev.TimestampMs + 1,
+		TransactionsRoot: &txRoot,
+		ContractsRoot:    prev.ContractsRoot,
+		NoncesRoot:       prev.NoncesRoot,
+		NextPredicate:    pred,
+	}
+	var args []interface{}
+	for _, s := range signers {
+		args = append(args, ed25519.Sign(s.priv, h.Hash().Bytes()))
+	}
+	return h, args
+}
+
+func TestAccept(t *testing.T) {
+	a, b := newSigner(t), newSigner(t)
+	b1, err := protocol.NewInitialBlock([]ed25519.PublicKey{a.pub}, 1, time.Now())
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	c := New(b1.BlockHeader)
+	emptyRoot := bc.TxMerkleRoot(nil)
+
+	h2, args := next(b1.BlockHeader, predicate(a), emptyRoot, a)
+	err = c.Accept(h2, args)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	// Signer a hands over to signer b.
+	h3, args := next(h2, predicate(b), emptyRoot, a)
+	err = c.Accept(h3, args)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	// From here on, a's signature is no good.
+	h4, args := next(h3, predicate(b), emptyRoot, a)
+	err = c.Accept(h4, args)
+	if err == nil {
+		t.Fatal("accepting header signed by rotated-out key: got no error")
+	}
+	h4, args = next(h3, predicate(b), emptyRoot, b)
+	err = c.Accept(h4, args)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	if c.Tip() != h4 {
+		t.Errorf("tip at height %d, want 4", c.Tip().Height)
+	}
+	rot := c.Rotations()
+	if len(rot) != 1 || rot[0].Height != 3 || !samePredicate(rot[0].Predicate, predicate(b)) {
+		t.Errorf("rotations = %+v, want one at height 3", rot)
+	}
+
+	// A header that skips a height is rejected.
+	h5, _ := next(h4, predicate(b), emptyRoot, b)
+	h6, args := next(h5, predicate(b), emptyRoot, b)
+	err = c.Accept(h6, args)
+	if err == nil {
+		t.Error("accepting header at height 6 after 4: got no error")
+	}
+}
+
+func TestAcceptMalformed(t *testing.T) {
+	a := newSigner(t)
+	b1, err := protocol.NewInitialBlock([]ed25519.PublicKey{a.pub}, 1, time.Now())
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	c := New(b1.BlockHeader)
+	emptyRoot := bc.TxMerkleRoot(nil)
+
+	noPrev, noPrevArgs := next(b1.BlockHeader, predicate(a), emptyRoot, a)
+	noPrev.PreviousBlockId = nil
+	noPred, noPredArgs := next(b1.BlockHeader, predicate(a), emptyRoot, a)
+	noPred.NextPredicate = nil
+
+	cases := []struct {
+		name string
+		h    *bc.BlockHeader
+		args []interface{}
+	}{
+		{"nil header", nil, nil},
+		{"no previous block ID", noPrev, noPrevArgs},
+		{"no next predicate", noPred, noPredArgs},
+	}
+	for _, tc := range cases {
+		err := c.Accept(tc.h, tc.args)
+		if errors.Root(err) != ErrMalformedHeader {
+			t.Errorf("%s: got error %v, want %s", tc.name, err, ErrMalformedHeader)
+		}
+	}
+	if c.Tip() != b1.BlockHeader {
+		t.Errorf("tip at height %d, want 1", c.Tip().Height)
+	}
+}
+
+func TestVerifyTx(t *testing.T) {
+	a := newSigner(t)
+	b1, err := protocol.NewInitialBlock([]ed25519.PublicKey{a.pub}, 1, time.Now())
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	c := New(b1.BlockHeader)
+
+	txs := []*bc.Tx{{ID: bc.NewHash([32]byte{1})}, {ID: bc.NewHash([32]byte{2})}}
+	h2, args := next(b1.BlockHeader, predicate(a), bc.TxMerkleRoot(txs), a)
+	err = c.Accept(h2, args)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	ub := &bc.UnsignedBlock{BlockHeader: h2, Transactions: txs}
+	proof, err := bc.TxInclusionProof(ub, 1)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = c.VerifyTx(2, bc.NewCommitmentsTx(txs[1]).WitnessCommitment, proof)
+	if err != nil {
+		t.Errorf("verifying tx proof: %v", err)
+	}
+	err = c.VerifyTx(2, bc.NewCommitmentsTx(txs[0]).WitnessCommitment, proof)
+	if errors.Root(err) != ErrBadTxProof {
+		t.Errorf("verifying proof for wrong tx: got error %v, want %v", err, ErrBadTxProof)
+	}
+	err = c.VerifyTx(3, bc.NewCommitmentsTx(txs[1]).WitnessCommitment, proof)
+	if errors.Root(err) != ErrNotFound {
+		t.Errorf("verifying proof at unknown height: got error %v, want %v", err, ErrNotFound)
+	}
+}
@@ -0,0 +1,314 @@
+/*
+Package mempool implements a pool of pending transactions for a
+block generator.
+
+Raw transactions are validated as they arrive: each one is run
+through the txvm virtual machine with bc.NewTx and applied to the
+pool's view of the blockchain state, which is the latest committed
+state snapshot plus every transaction already in the pool. A
+transaction may therefore spend outputs created by earlier pool
+transactions.
+
+The pool indexes the contract IDs spent by its transactions and
+their nonce commitments, so a double-spend of an output or a reused
+nonce is rejected when it is added rather than when a block is
+built.
+
+A generator typically uses a Pool like this:
+
+	p := mempool.New(chain.State())
+	...
+	_, err := p.Add(rawTx) // for each incoming transaction
+	...
+	ub, snapshot, err := chain.GenerateBlock(ctx, now, p.Batch(now, 0))
+	... // sign and commit the block
+	p.Update(snapshot)
+*/
+package mempool
+
+import (
+	"sync"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/state"
+)
+
+var (
+	// ErrDuplicate is returned by Add when a transaction with the
+	// same ID is already in the pool.
+	ErrDuplicate = errors.New("transaction already in pool")
+
+	// ErrConflict is returned by Add when a transaction spends an
+	// output or uses a nonce that another pool transaction already
+	// spends or uses.
+	ErrConflict = errors.New("transaction conflicts with pool transaction")
+
+	// ErrExpired is returned by Add when a transaction's timerange
+	// ends before the timestamp of the pool's state snapshot.
+	ErrExpired = errors.New("transaction timerange has expired")
+
+	// ErrUnfinalized is returned by Add when a transaction does not
+	// execute the finalize instruction.
+	ErrUnfinalized = errors.New("unfinalized transaction")
+
+	// ErrFull is returned by Add when the pool already holds MaxTxs
+	// transactions.
+	ErrFull = errors.New("transaction pool is full")
+)
+
+// Pool holds validated transactions that are waiting to be included
+// in a block. It is safe for concurrent use.
+type Pool struct {
+	// MaxTxs is the maximum number of transactions the pool will
+	// hold. Zero means no limit.
+	MaxTxs int
+
+	mu      sync.Mutex
+	base    *state.Snapshot // latest committed state
+	pending *state.Snapshot // base with every pool tx applied
+	txs     []*entry        // in arrival order
+	byID    map[bc.Hash]*entry
+	spent   map[bc.Hash]*entry // spent contract ID -> spending tx
+	nonces  map[string]*entry  // nonce commitment -> tx
+	outputs map[bc.Hash]*entry // contract ID -> creating tx
+}
+
+type entry struct {
+	tx   *bc.CommitmentsTx
+	deps []*entry // pool txs whose outputs this one spends
+}
+
+// New returns an empty Pool whose transactions are validated against
+// the given state snapshot.
+func New(snapshot *state.Snapshot) *Pool {
+	p := new(Pool)
+	p.reset(snapshot)
+	return p
+}
+
+func (p *Pool) reset(snapshot *state.Snapshot) {
+	p.base = snapshot
+	p.pending = snapshot
+	p.txs = nil
+	p.byID = make(map[bc.Hash]*entry)
+	p.spent = make(map[bc.Hash]*entry)
+	p.nonces = make(map[string]*entry)
+	p.outputs = make(map[bc.Hash]*entry)
+}
+
+// Len returns the number of transactions in the pool.
+func (p *Pool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.txs)
+}
+
+// Add validates a raw transaction and, if it is valid and does not
+// conflict with the pool, adds it. It returns the parsed transaction.
+func (p *Pool) Add(raw *bc.RawTx) (*bc.CommitmentsTx, error) {
+	tx, err := bc.NewTx(raw.Program, raw.Version, raw.Runlimit)
+	if err != nil {
+		return nil, errors.Wrap(err, "validating transaction")
+	}
+	if !tx.Finalized {
+		return nil, ErrUnfinalized
+	}
+	ctx := bc.NewCommitmentsTx(tx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.MaxTxs > 0 && len(p.txs) >= p.MaxTxs {
+		return nil, ErrFull
+	}
+	err = p.add(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ctx, nil
+}
+
+func (p *Pool) add(ctx *bc.CommitmentsTx) error {
+	tx := ctx.Tx
+	if _, ok := p.byID[tx.ID]; ok {
+		return errors.WithDetailf(ErrDuplicate, "tx %x", tx.ID.Bytes())
+	}
+	if expired(tx, p.base.TimestampMS()) {
+		return errors.WithDetailf(ErrExpired, "tx %x", tx.ID.Bytes())
+	}
+
+	e := &entry{tx: ctx}
+	for _, c := range tx.Contracts {
+		if c.Type != bc.InputType {
+			continue
+		}
+		if other, ok := p.spent[c.ID]; ok {
+			return errors.WithDetailf(ErrConflict, "contract %x already spent by tx %x", c.ID.Bytes(), other.tx.Tx.ID.Bytes())
+		}
+		if parent, ok := p.outputs[c.ID]; ok {
+			e.deps = append(e.deps, parent)
+		}
+	}
+	for _, nc := range ctx.NonceCommitments {
+		if other, ok := p.nonces[string(nc)]; ok {
+			return errors.WithDetailf(ErrConflict, "nonce already used by tx %x", other.tx.Tx.ID.Bytes())
+		}
+	}
+
+	// Check prevouts, nonce references, and nonces already in the
+	// blockchain against the pool's view of the state.
+	pending, err := p.pending.ApplyTx(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "applying tx %x", tx.ID.Bytes())
+	}
+
+	p.pending = pending
+	p.txs = append(p.txs, e)
+	p.byID[tx.ID] = e
+	for _, c := range tx.Contracts {
+		switch c.Type {
+		case bc.InputType:
+			p.spent[c.ID] = e
+		case bc.OutputType:
+			p.outputs[c.ID] = e
+		}
+	}
+	for _, nc := range ctx.NonceCommitments {
+		p.nonces[string(nc)] = e
+	}
+	return nil
+}
+
+// Remove removes the transaction with the given ID from the pool,
+// along with any pool transactions that depend on its outputs.
+// It returns the removed transactions.
+func (p *Pool) Remove(id bc.Hash) []*bc.CommitmentsTx {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e, ok := p.byID[id]
+	if !ok {
+		return nil
+	}
+	return p.evict(func(x *entry) bool { return x == e })
+}
+
+// Expire removes every transaction whose timerange ends before the
+// given timestamp, along with any pool transactions that depend on
+// their outputs. It returns the removed transactions.
+func (p *Pool) Expire(timestampMS uint64) []*bc.CommitmentsTx {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.evict(func(e *entry) bool { return expired(e.tx.Tx, timestampMS) })
+}
+
+// Update replaces the pool's state snapshot, typically with the
+// state after committing a new block. Transactions that are no
+// longer valid against the new state, including those that were
+// included in the block, are removed and returned.
+func (p *Pool) Update(snapshot *state.Snapshot) []*bc.CommitmentsTx {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	old := p.txs
+	p.reset(snapshot)
+
+	var removed []*bc.CommitmentsTx
+	for _, e := range old {
+		if p.add(e.tx) != nil {
+			removed = append(removed, e.tx)
+		}
+	}
+	return removed
+}
+
+// evict removes the entries selected by f and their dependents, then
+// rebuilds the pool's indexes and pending state from what remains.
+func (p *Pool) evict(f func(*entry) bool) []*bc.CommitmentsTx {
+	doomed := make(map[*entry]bool)
+	var removed []*bc.CommitmentsTx
+	for _, e := range p.txs {
+		drop := f(e)
+		for _, d := range e.deps {
+			drop = drop || doomed[d]
+		}
+		if drop {
+			doomed[e] = true
+			removed = append(removed, e.tx)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+
+	old := p.txs
+	p.reset(p.base)
+	for _, e := range old {
+		if !doomed[e] {
+			// Re-adding a subset of valid, non-conflicting
+			// transactions in their original order cannot fail.
+			p.add(e.tx)
+		}
+	}
+	return removed
+}
+
+// Batch returns pool transactions, in the order they were added,
+// that are suitable for a block with the given timestamp. It omits
+// transactions whose timeranges exclude the timestamp, and any
+// transactions that depend on those. If max is positive, at most max
+// transactions are returned. The pool is not modified; transactions
+// are removed when the resulting block is passed to Update.
+//
+// The result can be passed directly to protocol.Chain.GenerateBlock.
+func (p *Pool) Batch(timestampMS uint64, max int) []*bc.CommitmentsTx {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var (
+		batch   []*bc.CommitmentsTx
+		skipped = make(map[*entry]bool)
+	)
+	for _, e := range p.txs {
+		if max > 0 && len(batch) >= max {
+			break
+		}
+		skip := !inTimerange(e.tx.Tx, timestampMS)
+		for _, d := range e.deps {
+			skip = skip || skipped[d]
+		}
+		if skip {
+			skipped[e] = true
+			continue
+		}
+		batch = append(batch, e.tx)
+	}
+	return batch
+}
+
+// expired tells whether any of tx's timeranges ends before
+// timestampMS.
+func expired(tx *bc.Tx, timestampMS uint64) bool {
+	for _, tr := range tx.Timeranges {
+		if tr.MaxMS > 0 && timestampMS > uint64(tr.MaxMS) {
+			return true
+		}
+	}
+	return false
+}
+
+// inTimerange tells whether all of tx's timeranges include
+// timestampMS.
+func inTimerange(tx *bc.Tx, timestampMS uint64) bool {
+	if expired(tx, timestampMS) {
+		return false
+	}
+	for _, tr := range tx.Timeranges {
+		if tr.MinMS > 0 && timestampMS < uint64(tr.MinMS) {
+			return false
+		}
+	}
+	return true
+}
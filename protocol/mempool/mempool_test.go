@@ -0,0 +1,181 @@
+package mempool
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/prottest"
+	"github.com/chain/txvm/protocol/txvm"
+	"github.com/chain/txvm/protocol/txvm/asm"
+	"github.com/chain/txvm/testutil"
+)
+
+// anchorSrc produces a zero value on the contract stack from a nonce
+// contract salted with salt.
+func anchorSrc(salt string, blockID bc.Hash, exp time.Time) string {
+	return fmt.Sprintf(`[%q drop x'%x' %d nonce put] contract call get`, salt, blockID.Bytes(), bc.Millis(exp))
+}
+
+// emptyProgOutput returns the snapshot of a contract that has output
+// itself, leaving the empty program and an empty stack.
+func emptyProgOutput() txvm.Tuple {
+	seed := txvm.ContractSeed(asm.MustAssemble("[] output"))
+	return txvm.Tuple{txvm.Bytes{txvm.ContractCode}, txvm.Bytes(seed[:]), txvm.Bytes{}}
+}
+
+func rawTx(t *testing.T, src string) *bc.RawTx {
+	prog, err := asm.Assemble(src)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	return &bc.RawTx{Version: 3, Runlimit: 100000, Program: prog}
+}
+
+func mustAdd(t *testing.T, p *Pool, raw *bc.RawTx) *bc.CommitmentsTx {
+	tx, err := p.Add(raw)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	return tx
+}
+
+func TestAddDuplicateAndNonceConflict(t *testing.T) {
+	c := prottest.NewChain(t)
+	p := New(c.State())
+	initialID := c.InitialBlockHash
+	exp := time.Now().Add(time.Hour)
+
+	tx1 := rawTx(t, anchorSrc("a", initialID, exp)+" finalize")
+	mustAdd(t, p, tx1)
+
+	_, err := p.Add(tx1)
+	if errors.Root(err) != ErrDuplicate {
+		t.Errorf("re-adding tx: got error %v, want %v", err, ErrDuplicate)
+	}
+
+	// Same nonce, different transaction.
+	tx2 := rawTx(t, anchorSrc("a", initialID, exp)+" 'x' log finalize")
+	_, err = p.Add(tx2)
+	if errors.Root(err) != ErrConflict {
+		t.Errorf("adding tx with reused nonce: got error %v, want %v", err, ErrConflict)
+	}
+
+	// Unknown nonce block reference.
+	tx3 := rawTx(t, anchorSrc("b", bc.NewHash([32]byte{9}), exp)+" finalize")
+	_, err = p.Add(tx3)
+	if err == nil {
+		t.Error("adding tx with unknown nonce block reference: got no error")
+	}
+
+	if p.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", p.Len())
+	}
+}
+
+func TestDoubleSpend(t *testing.T) {
+	c := prottest.NewChain(t)
+	p := New(c.State())
+	initialID := c.InitialBlockHash
+	exp := time.Now().Add(time.Hour)
+
+	outSrc := anchorSrc("out", initialID, exp) + " [[] output] contract call finalize"
+	spendSrc := func(salt string) string {
+		dis, err := asm.Disassemble(txvm.Encode(emptyProgOutput()))
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		return anchorSrc(salt, initialID, exp) + " " + dis + " input call finalize"
+	}
+
+	create := mustAdd(t, p, rawTx(t, outSrc))
+	spend := mustAdd(t, p, rawTx(t, spendSrc("spend1")))
+	if len(spend.Tx.Inputs) != 1 || spend.Tx.Inputs[0].ID != create.Tx.Outputs[0].ID {
+		t.Fatal("spending tx does not spend the created output")
+	}
+
+	_, err := p.Add(rawTx(t, spendSrc("spend2")))
+	if errors.Root(err) != ErrConflict {
+		t.Errorf("adding double-spend: got error %v, want %v", err, ErrConflict)
+	}
+
+	removed := p.Remove(create.Tx.ID)
+	if len(removed) != 2 {
+		t.Fatalf("Remove evicted %d txs, want 2", len(removed))
+	}
+	if p.Len() != 0 {
+		t.Errorf("Len() = %d, want 0", p.Len())
+	}
+
+	// With its parent gone, the spend refers to an unknown output.
+	_, err = p.Add(rawTx(t, spendSrc("spend1")))
+	if err == nil {
+		t.Error("adding spend of unknown output: got no error")
+	}
+}
+
+func TestExpireAndBatch(t *testing.T) {
+	c := prottest.NewChain(t)
+	p := New(c.State())
+	initialID := c.InitialBlockHash
+	now := time.Now()
+
+	soon := mustAdd(t, p, rawTx(t, anchorSrc("soon", initialID, now.Add(time.Minute))+" finalize"))
+	later := mustAdd(t, p, rawTx(t, anchorSrc("later", initialID, now.Add(time.Hour))+" finalize"))
+
+	batch := p.Batch(bc.Millis(now.Add(2*time.Minute)), 0)
+	if len(batch) != 1 || batch[0] != later {
+		t.Errorf("Batch after first expiry = %v, want [later]", batch)
+	}
+	if got := p.Batch(bc.Millis(now), 1); len(got) != 1 || got[0] != soon {
+		t.Errorf("Batch with max 1 = %v, want [soon]", got)
+	}
+
+	removed := p.Expire(bc.Millis(now.Add(2 * time.Minute)))
+	if len(removed) != 1 || removed[0] != soon {
+		t.Errorf("Expire removed %v, want [soon]", removed)
+	}
+	if p.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", p.Len())
+	}
+}
+
+func TestGenerateAndUpdate(t *testing.T) {
+	ctx := context.Background()
+	c := prottest.NewChain(t)
+	p := New(c.State())
+	initialID := c.InitialBlockHash
+	exp := time.Now().Add(time.Hour)
+
+	for _, salt := range []string{"a", "b", "c"} {
+		mustAdd(t, p, rawTx(t, anchorSrc(salt, initialID, exp)+" finalize"))
+	}
+
+	ts := c.State().TimestampMS() + 1
+	ub, snapshot, err := c.GenerateBlock(ctx, ts, p.Batch(ts, 2))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(ub.Transactions) != 2 {
+		t.Fatalf("generated block has %d txs, want 2", len(ub.Transactions))
+	}
+	b, err := bc.SignBlock(ub, c.State().Header, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = c.CommitAppliedBlock(ctx, b, snapshot)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	removed := p.Update(c.State())
+	if len(removed) != 2 {
+		t.Errorf("Update removed %d txs, want 2", len(removed))
+	}
+	if p.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", p.Len())
+	}
+}
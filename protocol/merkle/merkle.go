@@ -51,6 +51,32 @@ func Proof(items [][]byte, i int) ([]AuditHash, error) {
 	return res, nil
 }
 
+// Verify tells whether proof, as returned by Proof, shows that item
+// is a leaf of the merkle tree with the given root hash.
+func Verify(root [32]byte, item []byte, proof []AuditHash) bool {
+	h := sha3pool.Get256()
+	defer sha3pool.Put256(h)
+
+	var hash [32]byte
+	h.Write(leafPrefix)
+	h.Write(item)
+	h.Read(hash[:])
+
+	for _, a := range proof {
+		h.Reset()
+		h.Write(interiorPrefix)
+		if a.RightOperator {
+			h.Write(hash[:])
+			h.Write(a.Val[:])
+		} else {
+			h.Write(a.Val[:])
+			h.Write(hash[:])
+		}
+		h.Read(hash[:])
+	}
+	return hash == root
+}
+
 // Root creates a merkle tree from a slice of byte slices
 // and returns the root hash of the tree.
 func Root(items [][]byte) [32]byte {
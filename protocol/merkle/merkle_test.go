@@ -222,6 +222,9 @@ func TestTrees(t *testing.T) {
 			t.Errorf("unexpected error: %v", err)
 		}
 		validate(t, got, c.w.res)
+		if !didErr && !Verify(Root(c.i.data), c.i.data[c.i.ind], got) {
+			t.Errorf("proof for item %d does not verify", c.i.ind)
+		}
 	}
 }
 
@@ -243,3 +246,19 @@ func validate(t *testing.T, actual []AuditHash, expected []auditHashT) {
 func hash2hex(hash [32]byte) string {
 	return hex.EncodeToString(hash[:])
 }
+
+func TestVerifyBadProof(t *testing.T) {
+	items := [][]byte{{1}, {2}, {3}, {4}, {5}}
+	root := Root(items)
+	proof, err := Proof(items, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Verify(root, items[3], proof) {
+		t.Error("proof verifies for a different item")
+	}
+	proof[0].RightOperator = !proof[0].RightOperator
+	if Verify(root, items[2], proof) {
+		t.Error("proof with flipped operator verifies")
+	}
+}
@@ -65,6 +65,93 @@ func walk(n *node, walkFn WalkFunc) error {
 	return err
 }
 
+// WalkPrefix is like Walk, but visits only the items in t that begin
+// with prefix. It takes time proportional to the length of prefix
+// plus the number of items visited.
+func WalkPrefix(t *Tree, prefix []byte, walkFn WalkFunc) error {
+	n := t.root
+	for n != nil {
+		if nbits(n) >= 8*len(prefix) {
+			if !bytes.HasPrefix(n.key, prefix) {
+				return nil
+			}
+			return walk(n, walkFn)
+		}
+		if n.isLeaf || !hasPrefix(prefix, n.key, n.keybit) {
+			return nil
+		}
+		n = n.children[childIdx(prefix, len(n.key), n.keybit)]
+	}
+	return nil
+}
+
+// Diff calls deleted for each item in old that is not in new, and
+// inserted for each item in new that is not in old. Subtrees that
+// new shares with old (as when new was made by copying old and
+// updating the copy) are skipped without being visited, so Diff
+// takes time roughly proportional to the number of changes.
+// If an error is returned by deleted or inserted,
+// processing is stopped and the error is returned.
+func Diff(old, new *Tree, deleted, inserted WalkFunc) error {
+	return diff(old.root, new.root, deleted, inserted)
+}
+
+func diff(a, b *node, deleted, inserted WalkFunc) error {
+	if a == b {
+		return nil
+	}
+	if a == nil {
+		return walk(b, inserted)
+	}
+	if b == nil {
+		return walk(a, deleted)
+	}
+
+	abits, bbits := nbits(a), nbits(b)
+	switch {
+	case abits == bbits && a.isLeaf == b.isLeaf && hasPrefix(b.key, a.key, a.keybit):
+		if a.isLeaf {
+			return nil
+		}
+		err := diff(a.children[0], b.children[0], deleted, inserted)
+		if err != nil {
+			return err
+		}
+		return diff(a.children[1], b.children[1], deleted, inserted)
+
+	case abits < bbits && !a.isLeaf && hasPrefix(b.key, a.key, a.keybit):
+		// b belongs under one child of a.
+		bit := childIdx(b.key, len(a.key), a.keybit)
+		err := diff(a.children[bit], b, deleted, inserted)
+		if err != nil {
+			return err
+		}
+		return walk(a.children[1-bit], deleted)
+
+	case bbits < abits && !b.isLeaf && hasPrefix(a.key, b.key, b.keybit):
+		// a belongs under one child of b.
+		bit := childIdx(a.key, len(b.key), b.keybit)
+		err := diff(a, b.children[bit], deleted, inserted)
+		if err != nil {
+			return err
+		}
+		return walk(b.children[1-bit], inserted)
+	}
+
+	// a and b have nothing in common.
+	err := walk(a, deleted)
+	if err != nil {
+		return err
+	}
+	return walk(b, inserted)
+}
+
+// nbits returns the number of leading bits shared by every item
+// under n.
+func nbits(n *node) int {
+	return 8*(len(n.key)-1) + int(n.keybit) + 1
+}
+
 // Contains returns whether t contains item.
 func (t *Tree) Contains(item []byte) bool {
 	if t.root == nil {
@@ -1,11 +1,14 @@
 package patricia
 
 import (
+	"bytes"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
+	"math/rand"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
@@ -593,6 +596,141 @@ func TestWalk(t *testing.T) {
 	}
 }
 
+func TestWalkPrefix(t *testing.T) {
+	// Items of three bytes drawn from a small alphabet, so that many
+	// share prefixes of various lengths.
+	rnd := rand.New(rand.NewSource(1))
+	alphabet := []byte{0x00, 0x01, 0x80, 0x81, 0xff}
+	tr := new(Tree)
+	var items [][]byte
+	for i := 0; i < 60; i++ {
+		item := []byte{alphabet[rnd.Intn(5)], alphabet[rnd.Intn(5)], alphabet[rnd.Intn(5)]}
+		if tr.Contains(item) {
+			continue
+		}
+		err := tr.Insert(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, item)
+	}
+
+	prefixes := [][]byte{nil, {0x00}, {0x80}, {0x80, 0x01}, {0xff, 0xff, 0xff}, {0x02}, {0x81, 0x80, 0x00, 0x00}}
+	for i := 0; i < 40; i++ {
+		prefix := make([]byte, rnd.Intn(4))
+		for j := range prefix {
+			prefix[j] = alphabet[rnd.Intn(5)]
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	for _, prefix := range prefixes {
+		want := make(map[string]bool)
+		for _, item := range items {
+			if bytes.HasPrefix(item, prefix) {
+				want[string(item)] = true
+			}
+		}
+		got := make(map[string]bool)
+		err := WalkPrefix(tr, prefix, func(item []byte) error {
+			if got[string(item)] {
+				t.Errorf("prefix %x: item %x visited twice", prefix, item)
+			}
+			got[string(item)] = true
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("prefix %x: got %d items, want %d", prefix, len(got), len(want))
+		}
+	}
+
+	err := WalkPrefix(new(Tree), nil, func([]byte) error { return errors.New("x") })
+	if err != nil {
+		t.Errorf("got error %s walking empty tree", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	alphabet := []byte{0x00, 0x01, 0x80, 0x81, 0xff}
+	randItem := func() []byte {
+		return []byte{alphabet[rnd.Intn(5)], alphabet[rnd.Intn(5)], alphabet[rnd.Intn(5)]}
+	}
+	contents := func(tr *Tree) map[string]bool {
+		m := make(map[string]bool)
+		Walk(tr, func(item []byte) error {
+			m[string(item)] = true
+			return nil
+		})
+		return m
+	}
+
+	for i := 0; i < 50; i++ {
+		oldTree := new(Tree)
+		for j := rnd.Intn(40); j > 0; j-- {
+			oldTree.Insert(randItem())
+		}
+
+		// Half the time, derive new from old so they share
+		// structure. Otherwise build it from scratch.
+		newTree := new(Tree)
+		if i%2 == 0 {
+			*newTree = *oldTree
+			for j := rnd.Intn(10); j > 0; j-- {
+				newTree.Delete(randItem())
+				newTree.Insert(randItem())
+			}
+		} else {
+			for j := rnd.Intn(40); j > 0; j-- {
+				newTree.Insert(randItem())
+			}
+		}
+
+		oldItems, newItems := contents(oldTree), contents(newTree)
+		got := contents(oldTree)
+		err := Diff(oldTree, newTree, func(item []byte) error {
+			if !got[string(item)] || newItems[string(item)] {
+				t.Errorf("case %d: bad deletion %x", i, item)
+			}
+			got[string(item)] = false
+			return nil
+		}, func(item []byte) error {
+			if got[string(item)] || oldItems[string(item)] {
+				t.Errorf("case %d: bad insertion %x", i, item)
+			}
+			got[string(item)] = true
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The package's delete shadows the builtin.
+		applied := make(map[string]bool)
+		for item, ok := range got {
+			if ok {
+				applied[item] = true
+			}
+		}
+		if !reflect.DeepEqual(applied, newItems) {
+			t.Errorf("case %d: applying diff to old got %d items, want %d", i, len(applied), len(newItems))
+		}
+	}
+
+	tr := new(Tree)
+	tr.Insert([]byte{1})
+	fail := func([]byte) error { return errors.New("x") }
+	err := Diff(tr, tr, fail, fail)
+	if err != nil {
+		t.Errorf("got error %s diffing a tree with itself", err)
+	}
+	err = Diff(tr, new(Tree), fail, fail)
+	if err == nil {
+		t.Error("got no error from failing WalkFunc")
+	}
+}
+
 func TestHasPrefix(t *testing.T) {
 	cases := []struct {
 		s, pref string
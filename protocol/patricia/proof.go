@@ -0,0 +1,235 @@
+package patricia
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/chain/txvm/crypto/sha3pool"
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/merkle"
+)
+
+var (
+	// ErrNotFound is returned by ProveInclusion when the item is
+	// not in the tree.
+	ErrNotFound = errors.New("item not in tree")
+
+	// ErrFound is returned by ProveNonInclusion when the item is in
+	// the tree.
+	ErrFound = errors.New("item in tree")
+)
+
+// Proof is a proof that an item is in a tree with a given root hash.
+//
+// Path holds the hashes of the siblings of the nodes on the path
+// from the item's leaf to the root, in that order. As with
+// merkle.Proof, RightOperator tells whether a sibling is to the
+// right of the path.
+type Proof struct {
+	Item []byte
+	Path []merkle.AuditHash
+}
+
+// NonInclusionProof is a proof that an item is not in a tree with a
+// given root hash. It consists of inclusion proofs for the items
+// immediately before and after the absent item in the tree's
+// lexicographic order. Left is nil when there is no item before it,
+// and Right is nil when there is no item after it. Both are nil for
+// the empty tree.
+type NonInclusionProof struct {
+	Left, Right *Proof
+}
+
+// ProveInclusion returns a proof that item is in t.
+// It returns ErrNotFound if it is not.
+func (t *Tree) ProveInclusion(item []byte) (*Proof, error) {
+	if !t.Contains(item) {
+		return nil, ErrNotFound
+	}
+	return prove(t.root, item), nil
+}
+
+// prove returns a proof for key, which must be a leaf under n.
+func prove(n *node, key []byte) *Proof {
+	var path []merkle.AuditHash
+	for !n.isLeaf {
+		bit := childIdx(key, len(n.key), n.keybit)
+		path = append(path, merkle.AuditHash{
+			Val:           n.children[1-bit].Hash(),
+			RightOperator: bit == 0,
+		})
+		n = n.children[bit]
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return &Proof{Item: n.key, Path: path}
+}
+
+// ProveNonInclusion returns a proof that item is not in t.
+// It returns ErrFound if it is.
+func (t *Tree) ProveNonInclusion(item []byte) (*NonInclusionProof, error) {
+	if t.Contains(item) {
+		return nil, ErrFound
+	}
+	p := new(NonInclusionProof)
+	if t.root == nil {
+		return p, nil
+	}
+	if l := before(t.root, item); l != nil {
+		p.Left = prove(t.root, l.key)
+	}
+	if r := after(t.root, item); r != nil {
+		p.Right = prove(t.root, r.key)
+	}
+	return p, nil
+}
+
+// within tells whether key falls between the leftmost and rightmost
+// leaves under the interior node n, so that one child of n precedes
+// it and the other follows it.
+func within(n *node, key []byte) bool {
+	if !hasPrefix(key, n.key, n.keybit) {
+		return false
+	}
+	// A key equal to n's prefix precedes every leaf under n.
+	return n.keybit < 7 || len(key) > len(n.key)
+}
+
+// before returns the greatest leaf under n that is less than key,
+// or nil if there is none.
+func before(n *node, key []byte) *node {
+	if n.isLeaf || !within(n, key) {
+		if m := rightmost(n); bytes.Compare(m.key, key) < 0 {
+			return m
+		}
+		return nil
+	}
+	bit := childIdx(key, len(n.key), n.keybit)
+	if l := before(n.children[bit], key); l != nil {
+		return l
+	}
+	if bit == 1 {
+		return rightmost(n.children[0])
+	}
+	return nil
+}
+
+// after returns the least leaf under n that is greater than key, or
+// nil if there is none.
+func after(n *node, key []byte) *node {
+	if n.isLeaf || !within(n, key) {
+		if m := leftmost(n); bytes.Compare(m.key, key) > 0 {
+			return m
+		}
+		return nil
+	}
+	bit := childIdx(key, len(n.key), n.keybit)
+	if r := after(n.children[bit], key); r != nil {
+		return r
+	}
+	if bit == 0 {
+		return leftmost(n.children[1])
+	}
+	return nil
+}
+
+func leftmost(n *node) *node {
+	for !n.isLeaf {
+		n = n.children[0]
+	}
+	return n
+}
+
+func rightmost(n *node) *node {
+	for !n.isLeaf {
+		n = n.children[1]
+	}
+	return n
+}
+
+// VerifyInclusion tells whether p proves that item is in the tree
+// with the given root hash.
+func VerifyInclusion(root [32]byte, item []byte, p *Proof) bool {
+	if p == nil || !bytes.Equal(p.Item, item) {
+		return false
+	}
+	return p.root() == root
+}
+
+// VerifyNonInclusion tells whether p proves that item is not in the
+// tree with the given root hash.
+func VerifyNonInclusion(root [32]byte, item []byte, p *NonInclusionProof) bool {
+	if p == nil {
+		return false
+	}
+	l, r := p.Left, p.Right
+	if l == nil && r == nil {
+		return root == [32]byte{}
+	}
+	if l != nil && (bytes.Compare(l.Item, item) >= 0 || l.root() != root) {
+		return false
+	}
+	if r != nil && (bytes.Compare(r.Item, item) <= 0 || r.root() != root) {
+		return false
+	}
+
+	// The two leaves must be adjacent: their paths from the root
+	// take the same turns down to some node, where the left one
+	// branches left and the right one branches right. From there
+	// the left leaf is the rightmost in its subtree, and the right
+	// leaf the leftmost in its. With a missing neighbor, the other
+	// leaf must be the leftmost or rightmost in the whole tree.
+	var lpath, rpath []merkle.AuditHash
+	if l != nil {
+		lpath = l.Path
+	}
+	if r != nil {
+		rpath = r.Path
+	}
+	i, j := len(lpath)-1, len(rpath)-1
+	if l != nil && r != nil {
+		for ; i >= 0 && j >= 0 && lpath[i].RightOperator == rpath[j].RightOperator; i, j = i-1, j-1 {
+		}
+		if i < 0 || j < 0 || !lpath[i].RightOperator {
+			return false
+		}
+		i, j = i-1, j-1
+	}
+	for ; i >= 0; i-- {
+		if lpath[i].RightOperator {
+			return false
+		}
+	}
+	for ; j >= 0; j-- {
+		if !rpath[j].RightOperator {
+			return false
+		}
+	}
+	return true
+}
+
+// root computes the root hash implied by p.
+func (p *Proof) root() [32]byte {
+	var hash [32]byte
+	h := sha3pool.Get256()
+	defer sha3pool.Put256(h)
+
+	h.Write(leafPrefix)
+	h.Write(p.Item)
+	io.ReadFull(h, hash[:])
+
+	for _, a := range p.Path {
+		h.Reset()
+		h.Write(interiorPrefix)
+		if a.RightOperator {
+			h.Write(hash[:])
+			h.Write(a.Val[:])
+		} else {
+			h.Write(a.Val[:])
+			h.Write(hash[:])
+		}
+		io.ReadFull(h, hash[:])
+	}
+	return hash
+}
@@ -0,0 +1,118 @@
+package patricia
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestProofs(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, n := range []int{0, 1, 2, 3, 10, 200} {
+		tr := new(Tree)
+		var items [][]byte
+		for len(items) < n {
+			item := make([]byte, 2)
+			rng.Read(item)
+			if tr.Contains(item) {
+				continue
+			}
+			err := tr.Insert(item)
+			if err != nil {
+				t.Fatal(err)
+			}
+			items = append(items, item)
+		}
+		root := tr.RootHash()
+
+		for _, item := range items {
+			p, err := tr.ProveInclusion(item)
+			if err != nil {
+				t.Fatalf("%d items: ProveInclusion(%x): %v", n, item, err)
+			}
+			if !VerifyInclusion(root, item, p) {
+				t.Errorf("%d items: inclusion proof for %x does not verify", n, item)
+			}
+			if _, err = tr.ProveNonInclusion(item); err != ErrFound {
+				t.Errorf("%d items: ProveNonInclusion(%x) error = %v, want %v", n, item, err, ErrFound)
+			}
+		}
+
+		for i := 0; i < 100; i++ {
+			item := make([]byte, 2)
+			rng.Read(item)
+			if i == 0 {
+				item = []byte{0, 0}
+			} else if i == 1 {
+				item = []byte{0xff, 0xff}
+			}
+			if tr.Contains(item) {
+				continue
+			}
+			p, err := tr.ProveNonInclusion(item)
+			if err != nil {
+				t.Fatalf("%d items: ProveNonInclusion(%x): %v", n, item, err)
+			}
+			if !VerifyNonInclusion(root, item, p) {
+				t.Errorf("%d items: non-inclusion proof for %x does not verify", n, item)
+			}
+			if _, err = tr.ProveInclusion(item); err != ErrNotFound {
+				t.Errorf("%d items: ProveInclusion(%x) error = %v, want %v", n, item, err, ErrNotFound)
+			}
+		}
+	}
+}
+
+func TestBadProofs(t *testing.T) {
+	tr := new(Tree)
+	for _, s := range []string{"\x10", "\x20", "\x30", "\x40", "\x50"} {
+		err := tr.Insert([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	root := tr.RootHash()
+
+	p, err := tr.ProveInclusion([]byte("\x30"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if VerifyInclusion(root, []byte("\x31"), p) {
+		t.Error("inclusion proof verifies for a different item")
+	}
+	p.Path[0].Val[0] ^= 1
+	if VerifyInclusion(root, []byte("\x30"), p) {
+		t.Error("inclusion proof with altered path verifies")
+	}
+
+	// Genuine inclusion proofs for non-adjacent items must not prove
+	// the absence of an item between them.
+	np, err := tr.ProveNonInclusion([]byte("\x35"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(np.Left.Item, []byte("\x30")) || !bytes.Equal(np.Right.Item, []byte("\x40")) {
+		t.Fatalf("neighbors of 0x35 = %x, %x; want 30, 40", np.Left.Item, np.Right.Item)
+	}
+	np.Left, _ = tr.ProveInclusion([]byte("\x20"))
+	if VerifyNonInclusion(root, []byte("\x35"), np) {
+		t.Error("non-inclusion proof with non-adjacent neighbors verifies")
+	}
+
+	// A proof that omits the left neighbor must not verify.
+	np, _ = tr.ProveNonInclusion([]byte("\x35"))
+	np.Left = nil
+	if VerifyNonInclusion(root, []byte("\x35"), np) {
+		t.Error("non-inclusion proof with missing left neighbor verifies")
+	}
+
+	// Nor may an item in the tree be proven absent.
+	np, _ = tr.ProveNonInclusion([]byte("\x35"))
+	if VerifyNonInclusion(root, []byte("\x40"), np) {
+		t.Error("non-inclusion proof verifies for a present item")
+	}
+
+	if VerifyNonInclusion(root, []byte("\x35"), new(NonInclusionProof)) {
+		t.Error("empty-tree non-inclusion proof verifies against a non-empty root")
+	}
+}
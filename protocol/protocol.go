@@ -20,7 +20,8 @@ parties), and call CommitAppliedBlock.
 Signer
 
 A signer validates blocks generated by the Generator and signs
-at most one block at each height.
+at most one block at each height. Package signer implements
+this role.
 
 Participant
 
@@ -87,7 +88,13 @@ import (
 	"github.com/chain/txvm/protocol/state"
 )
 
-const defaultBlocksPerSnapshot = uint64(100)
+const (
+	defaultBlocksPerSnapshot = uint64(100)
+
+	// With a DeltaStore, recovery replays stored deltas rather than
+	// blocks, so full snapshots can be much less frequent.
+	defaultBlocksPerDeltaSnapshot = uint64(10000)
+)
 
 // Store provides storage for blockchain data: blocks and state tree
 // snapshots.
@@ -106,6 +113,23 @@ type Store interface {
 	SaveSnapshot(context.Context, *state.Snapshot) error
 }
 
+// DeltaStore is a Store that can also persist the state delta of
+// each block (see state.Delta). When a Chain's Store is a DeltaStore,
+// the Chain saves a delta for each block it commits, and Recover
+// rebuilds the state by applying the deltas after the latest
+// snapshot instead of replaying the blocks' transactions.
+type DeltaStore interface {
+	Store
+
+	// SaveDelta stores the delta for the block at d.Header.Height.
+	SaveDelta(ctx context.Context, d *state.Delta) error
+
+	// Deltas returns the stored deltas for consecutive heights
+	// beginning at height, stopping at the first height with no
+	// stored delta.
+	Deltas(ctx context.Context, height uint64) ([]*state.Delta, error)
+}
+
 // Chain provides a complete, minimal blockchain database. It
 // delegates the underlying storage to other objects, and uses
 // validation logic from package validation to decide what
@@ -119,7 +143,8 @@ type Chain struct {
 		height   uint64
 		snapshot *state.Snapshot // current only if leader
 	}
-	store Store
+	store   Store
+	history *state.History
 
 	lastQueuedSnapshotHeight uint64 // atomic access only
 	blocksPerSnapshot        uint64
@@ -132,10 +157,15 @@ func NewChain(ctx context.Context, initialBlock *bc.Block, store Store, heights
 		InitialBlockHash:  initialBlock.Hash(),
 		bb:                NewBlockBuilder(),
 		store:             store,
+		history:           state.NewHistory(state.KeepRecent(defaultHistoryBlocks)),
 		pendingSnapshots:  make(chan *state.Snapshot, 1),
 		blocksPerSnapshot: defaultBlocksPerSnapshot,
 	}
 
+	if _, ok := store.(DeltaStore); ok {
+		c.blocksPerSnapshot = defaultBlocksPerDeltaSnapshot
+	}
+
 	c.state.cond.L = new(sync.Mutex)
 	c.state.snapshot = state.Empty()
 
@@ -87,11 +87,11 @@ func NewChain(tb testing.TB, opts ...Option) *protocol.Chain {
 		testutil.FatalErr(tb, err)
 	}
 
-	err = conf.initialState.ApplyBlock(b1.UnsignedBlock)
+	initialState, err := conf.initialState.ApplyBlock(b1.UnsignedBlock)
 	if err != nil {
 		testutil.FatalErr(tb, err)
 	}
-	err = c.CommitAppliedBlock(ctx, b1, conf.initialState)
+	err = c.CommitAppliedBlock(ctx, b1, initialState)
 	if err != nil {
 		testutil.FatalErr(tb, err)
 	}
@@ -13,16 +13,20 @@ import (
 	"github.com/chain/txvm/protocol/state"
 )
 
-// MemStore satisfies the Store interface.
+// MemStore satisfies the Store and DeltaStore interfaces.
 type MemStore struct {
 	mu     sync.Mutex
 	Blocks map[uint64]*bc.Block
 	State  *state.Snapshot
+	deltas map[uint64]*state.Delta
 }
 
 // New returns a new MemStore.
 func New() *MemStore {
-	return &MemStore{Blocks: make(map[uint64]*bc.Block)}
+	return &MemStore{
+		Blocks: make(map[uint64]*bc.Block),
+		deltas: make(map[uint64]*state.Delta),
+	}
 }
 
 // Height satisfies the protocol.Store interface.
@@ -51,10 +55,38 @@ func (m *MemStore) SaveSnapshot(ctx context.Context, snapshot *state.Snapshot) e
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.State = state.Copy(snapshot)
+	m.State = snapshot
+
+	// Deltas up to the snapshot height are no longer needed.
+	for h := range m.deltas {
+		if h <= snapshot.Height() {
+			delete(m.deltas, h)
+		}
+	}
 	return nil
 }
 
+// SaveDelta satisfies the protocol.DeltaStore interface.
+func (m *MemStore) SaveDelta(ctx context.Context, d *state.Delta) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deltas[d.Header.Height] = d
+	return nil
+}
+
+// Deltas satisfies the protocol.DeltaStore interface.
+func (m *MemStore) Deltas(ctx context.Context, height uint64) ([]*state.Delta, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deltas []*state.Delta
+	for h := height; m.deltas[h] != nil; h++ {
+		deltas = append(deltas, m.deltas[h])
+	}
+	return deltas, nil
+}
+
 // GetBlock satisfies the protocol.Store interface.
 func (m *MemStore) GetBlock(ctx context.Context, height uint64) (*bc.Block, error) {
 	m.mu.Lock()
@@ -74,7 +106,7 @@ func (m *MemStore) LatestSnapshot(context.Context) (*state.Snapshot, error) {
 	if m.State == nil {
 		m.State = state.Empty()
 	}
-	return state.Copy(m.State), nil
+	return m.State, nil
 }
 
 // FinalizeHeight satisfies the protocol.Store interface.
@@ -6,6 +6,7 @@ import (
 	"sync/atomic"
 
 	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/log"
 	"github.com/chain/txvm/protocol/bc"
 	"github.com/chain/txvm/protocol/state"
 )
@@ -16,6 +17,12 @@ import (
 //
 // If the blockchain is empty (missing initial block), this function
 // returns a nil block and an empty snapshot.
+//
+// If c's Store is a DeltaStore, Recover applies the stored deltas
+// after the latest snapshot, verifying the resulting contracts and
+// nonces roots, before replaying any remaining blocks. If the deltas
+// do not check out, Recover logs the error and replays the blocks
+// they cover instead.
 func (c *Chain) Recover(ctx context.Context) (*state.Snapshot, error) {
 	snapshot, err := c.store.LatestSnapshot(ctx)
 	if err != nil {
@@ -32,22 +39,32 @@ func (c *Chain) Recover(ctx context.Context) (*state.Snapshot, error) {
 	if snapshot == nil {
 		snapshot = state.Empty()
 	}
+	if snapshot.Height() > 0 {
+		c.history.Add(snapshot)
+	}
 
 	// The true height of the blockchain might be higher than the
-	// height at which the state snapshot was taken. Replay all
-	// existing blocks higher than the snapshot height.
+	// height at which the state snapshot was taken. Apply the
+	// stored deltas, if any, then replay all remaining blocks.
 	height, err := c.store.Height(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "getting blockchain height")
 	}
 
+	if ds, ok := c.store.(DeltaStore); ok {
+		snapshot, b, err = c.applyDeltas(ctx, ds, snapshot, height, b)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Bring the snapshot up to date with the latest block
 	for h := snapshot.Height() + 1; h <= height; h++ {
 		b, err = c.store.GetBlock(ctx, h)
 		if err != nil {
 			return nil, errors.Wrap(err, "getting block")
 		}
-		err = snapshot.ApplyBlock(b.UnsignedBlock)
+		snapshot, err = snapshot.ApplyBlock(b.UnsignedBlock)
 		if err != nil {
 			return nil, errors.Wrap(err, "applying block")
 		}
@@ -55,6 +72,7 @@ func (c *Chain) Recover(ctx context.Context) (*state.Snapshot, error) {
 			return nil, fmt.Errorf("block %d has contract root %x; snapshot has root %x",
 				b.Height, b.ContractsRoot.Bytes(), snapshot.ContractsTree.RootHash())
 		}
+		c.history.Add(snapshot)
 	}
 	if b != nil {
 		// All blocks before the latest one have been fully processed
@@ -69,3 +87,83 @@ func (c *Chain) Recover(ctx context.Context) (*state.Snapshot, error) {
 	}
 	return snapshot, nil
 }
+
+// applyDeltas brings snapshot up to date, as far as height, with the
+// deltas in ds. Since deltas are applied without running any
+// transactions, the state after each one is checked against the
+// contracts and nonces roots in its block header, and the header of
+// the last one against the stored block. (ApplyDelta checks that
+// each header follows the one before, so the others are the stored
+// blocks' headers too.) It returns the new state and the last block
+// applied, or snapshot and b if there were no deltas to apply.
+//
+// Deltas that cannot be applied, or that do not produce the state in
+// the block headers, are logged and skipped: applyDeltas returns
+// snapshot and b, and the caller replays the blocks instead.
+func (c *Chain) applyDeltas(ctx context.Context, ds DeltaStore, snapshot *state.Snapshot, height uint64, b *bc.Block) (*state.Snapshot, *bc.Block, error) {
+	deltas, err := ds.Deltas(ctx, snapshot.Height()+1)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "getting state deltas")
+	}
+	for i, d := range deltas {
+		if d.Header.Height > height {
+			deltas = deltas[:i]
+			break
+		}
+	}
+	if len(deltas) == 0 {
+		return snapshot, b, nil
+	}
+
+	// The states are added to c's history only once the last header
+	// is known to be the stored block's.
+	var (
+		next    = snapshot
+		applied []*state.Snapshot
+	)
+	for _, d := range deltas {
+		next, err = next.ApplyDelta(d)
+		if err != nil {
+			err = errors.Wrapf(err, "applying delta for block %d", d.Header.Height)
+			break
+		}
+		err = checkDeltaRoots(next)
+		if err != nil {
+			break
+		}
+		applied = append(applied, next)
+	}
+	if err == nil {
+		var last *bc.Block
+		last, err = c.store.GetBlock(ctx, next.Height())
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "getting block")
+		}
+		if last.Hash() == next.Header.Hash() {
+			for _, s := range applied {
+				c.history.Add(s)
+			}
+			return next, last, nil
+		}
+		err = fmt.Errorf("delta for block %d has header %x; block has header %x",
+			last.Height, next.Header.Hash().Bytes(), last.Hash().Bytes())
+	}
+
+	log.Error(ctx, err, fmt.Sprintf("replaying blocks %d to %d instead of their state deltas", snapshot.Height()+1, snapshot.Height()+uint64(len(deltas))))
+	return snapshot, b, nil
+}
+
+// checkDeltaRoots checks snapshot, made by applying a delta, against
+// the contracts and nonces roots in its header.
+func checkDeltaRoots(snapshot *state.Snapshot) error {
+	h := snapshot.Header
+	if h.ContractsRoot.Byte32() != snapshot.ContractsTree.RootHash() {
+		return errors.WithDetailf(ErrBadContractsRoot, "block %d has contract root %x; snapshot has root %x",
+			h.Height, h.ContractsRoot.Bytes(), snapshot.ContractsTree.RootHash())
+	}
+	if h.NoncesRoot.Byte32() != snapshot.NonceTree.RootHash() {
+		return errors.WithDetailf(ErrBadNoncesRoot, "block %d has nonce root %x; snapshot has root %x",
+			h.Height, h.NoncesRoot.Bytes(), snapshot.NonceTree.RootHash())
+	}
+	return nil
+}
@@ -23,8 +23,7 @@ func TestRecoverSnapshotNoAdditionalBlocks(t *testing.T) {
 		t.Fatal(err)
 	}
 	c1.blocksPerSnapshot = 0
-	st := state.Empty()
-	err = st.ApplyBlock(b1.UnsignedBlock)
+	st, err := state.Empty().ApplyBlock(b1.UnsignedBlock)
 	if err != nil {
 		testutil.FatalErr(t, err)
 	}
@@ -87,8 +86,7 @@ func TestRecoverSnapshotAdditionalBlocks(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	st := state.Empty()
-	err = st.ApplyBlock(b.UnsignedBlock)
+	st, err := state.Empty().ApplyBlock(b.UnsignedBlock)
 	if err != nil {
 		testutil.FatalErr(t, err)
 	}
@@ -129,3 +127,125 @@ func TestRecoverSnapshotAdditionalBlocks(t *testing.T) {
 		t.Fatal("chain.state.Header is nil")
 	}
 }
+
+// getCountingStore records the heights passed to GetBlock.
+type getCountingStore struct {
+	*memstore.MemStore
+	gets []uint64
+}
+
+func (s *getCountingStore) GetBlock(ctx context.Context, height uint64) (*bc.Block, error) {
+	s.gets = append(s.gets, height)
+	return s.MemStore.GetBlock(ctx, height)
+}
+
+func TestRecoverDeltas(t *testing.T) {
+	ctx := context.Background()
+	store := &getCountingStore{MemStore: memstore.New()}
+	now := time.Now()
+	b1, err := NewInitialBlock(nil, 0, now.Add(-time.Minute))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	c1, err := NewChain(ctx, b1, store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := state.Empty().ApplyBlock(b1.UnsignedBlock)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = c1.CommitAppliedBlock(ctx, b1, st)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	for i := 1; i <= 5; i++ {
+		tx := &bc.Tx{
+			ID:        bc.NewHash([32]byte{byte(i)}),
+			Contracts: []bc.Contract{{Type: bc.OutputType, ID: bc.NewHash([32]byte{byte(i)})}},
+			Nonces:    []bc.Nonce{{ID: bc.NewHash([32]byte{byte(i)}), ExpMS: bc.Millis(now.Add(time.Hour))}},
+			Finalized: true,
+		}
+		prev := c1.State()
+		ub, snapshot, err := c1.GenerateBlock(ctx, prev.TimestampMS()+1, []*bc.CommitmentsTx{bc.NewCommitmentsTx(tx)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ub.Transactions) != 1 {
+			t.Fatalf("block %d has %d transactions, want 1", ub.Height, len(ub.Transactions))
+		}
+		b, err := bc.SignBlock(ub, prev.Header, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c1.CommitAppliedBlock(ctx, b, snapshot)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Recovery uses only the deltas, fetching just the last block
+	// to check them against.
+	store.gets = nil
+	c2, err := NewChain(ctx, b1, store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := c2.Recover(ctx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	want := c1.State()
+	if got.Height() != 6 {
+		t.Fatalf("state.Height = %d, want 6", got.Height())
+	}
+	if got.ContractsTree.RootHash() != want.ContractsTree.RootHash() {
+		t.Error("recovered contracts root differs")
+	}
+	if got.NonceTree.RootHash() != want.NonceTree.RootHash() {
+		t.Error("recovered nonces root differs")
+	}
+	if !testutil.DeepEqual(store.gets, []uint64{6}) {
+		t.Errorf("recovery fetched blocks %v, want [6]", store.gets)
+	}
+
+	// A delta that does not match its block is caught, even if a
+	// later one undoes the damage, and recovery falls back to
+	// replaying the blocks.
+	deltas, err := store.Deltas(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	junk := make([]byte, 32)
+	bad3, bad4 := *deltas[0], *deltas[1]
+	bad3.Contracts.Inserted = append(bad3.Contracts.Inserted[:len(bad3.Contracts.Inserted):len(bad3.Contracts.Inserted)], junk)
+	bad4.Contracts.Deleted = append(bad4.Contracts.Deleted[:len(bad4.Contracts.Deleted):len(bad4.Contracts.Deleted)], junk)
+	for _, d := range []*state.Delta{&bad3, &bad4} {
+		err = store.SaveDelta(ctx, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.gets = nil
+	c3, err := NewChain(ctx, b1, store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = c3.Recover(ctx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if got.Height() != 6 || got.ContractsTree.RootHash() != want.ContractsTree.RootHash() {
+		t.Error("recovery with a bad delta did not reach the right state")
+	}
+	if !testutil.DeepEqual(store.gets, []uint64{1, 2, 3, 4, 5, 6}) {
+		t.Errorf("recovery with a bad delta fetched blocks %v, want [1 2 3 4 5 6]", store.gets)
+	}
+	for height := uint64(2); height <= 6; height++ {
+		s, ok := c3.history.At(height)
+		if !ok || s.ContractsTree.Contains(junk) {
+			t.Errorf("history does not hold the replayed state at height %d", height)
+		}
+	}
+}
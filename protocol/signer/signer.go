@@ -0,0 +1,122 @@
+// Package signer implements the block signer role described in the
+// documentation of package protocol.
+//
+// A Signer checks each block it is asked to sign against the
+// blockchain state after the block's parent, and signs at most one
+// block at each height. The highest height signed, and the ID of the
+// block signed at that height, are recorded in a WatermarkStore
+// before any signature is returned, so the guarantee survives a
+// restart of the signing process.
+//
+// The signature returned by Sign is suitable for use with
+// bc.SignBlock:
+//
+//	sig, err := s.Sign(ctx, ub, parentSnapshot)
+//	...
+//	b, err := bc.SignBlock(ub, parentSnapshot.Header, func(i int) (interface{}, error) {
+//		if i == myIndex {
+//			return sig, nil
+//		}
+//		return nil, nil
+//	})
+package signer
+
+import (
+	"context"
+	"sync"
+
+	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/state"
+	"github.com/chain/txvm/protocol/validation"
+)
+
+var (
+	// ErrConflict is returned by Sign when a different block has
+	// already been signed at the same height.
+	ErrConflict = errors.New("already signed a different block at this height")
+
+	// ErrStale is returned by Sign when a block at a greater height
+	// has already been signed.
+	ErrStale = errors.New("already signed a block at a greater height")
+
+	// ErrParent is returned by Sign when the given parent state is
+	// not the state after the block's previous block.
+	ErrParent = errors.New("block does not follow parent state")
+)
+
+// Signer signs blocks with a single ed25519 key. It is safe for
+// concurrent use.
+type Signer struct {
+	key ed25519.PrivateKey
+	wm  WatermarkStore
+
+	mu sync.Mutex // serializes watermark updates
+}
+
+// New returns a Signer that signs with key and records what it has
+// signed in wm.
+func New(key ed25519.PrivateKey, wm WatermarkStore) *Signer {
+	return &Signer{key: key, wm: wm}
+}
+
+// PublicKey returns the public key corresponding to s's signing key.
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// Sign validates ub against parent, which must be the state
+// snapshot after ub's previous block, and returns a signature of
+// ub's hash.
+//
+// Sign refuses to sign a block at a height lower than one it has
+// already signed, or a different block at the same height. Signing
+// the same block again returns a fresh signature of it.
+func (s *Signer) Sign(ctx context.Context, ub *bc.UnsignedBlock, parent *state.Snapshot) ([]byte, error) {
+	if parent.Header == nil {
+		return nil, errors.WithDetail(ErrParent, "empty parent state")
+	}
+	if ub.Height != parent.Height()+1 {
+		return nil, errors.WithDetailf(ErrParent, "block height %d, parent height %d", ub.Height, parent.Height())
+	}
+
+	err := validation.Block(ub, parent.Header)
+	if err != nil {
+		return nil, errors.Wrap(err, "validating block")
+	}
+	snapshot, err := parent.ApplyBlock(ub)
+	if err != nil {
+		return nil, errors.Wrap(err, "applying block")
+	}
+	if ub.ContractsRoot.Byte32() != snapshot.ContractsTree.RootHash() {
+		return nil, protocol.ErrBadContractsRoot
+	}
+	if ub.NoncesRoot.Byte32() != snapshot.NonceTree.RootHash() {
+		return nil, protocol.ErrBadNoncesRoot
+	}
+
+	id := ub.Hash()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, err := s.wm.Watermark(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading watermark")
+	}
+	switch {
+	case ub.Height < w.Height:
+		return nil, errors.WithDetailf(ErrStale, "block height %d, watermark height %d", ub.Height, w.Height)
+	case ub.Height == w.Height && id != w.BlockID:
+		return nil, errors.WithDetailf(ErrConflict, "height %d, signed block %x, requested block %x", ub.Height, w.BlockID.Bytes(), id.Bytes())
+	case ub.Height > w.Height:
+		err = s.wm.SetWatermark(ctx, Watermark{Height: ub.Height, BlockID: id})
+		if err != nil {
+			return nil, errors.Wrap(err, "saving watermark")
+		}
+	}
+
+	return ed25519.Sign(s.key, id.Bytes()), nil
+}
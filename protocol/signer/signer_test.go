@@ -0,0 +1,135 @@
+package signer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/prottest"
+	"github.com/chain/txvm/testutil"
+)
+
+func newTestSigner(t *testing.T) (*Signer, string) {
+	dir, err := ioutil.TempDir("", "signer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "watermark")
+	return New(key, NewFileWatermark(name)), name
+}
+
+func generate(t *testing.T, c *protocol.Chain, timestampMS uint64) *bc.UnsignedBlock {
+	ub, _, err := c.GenerateBlock(context.Background(), timestampMS, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	return ub
+}
+
+func TestSignOncePerHeight(t *testing.T) {
+	ctx := context.Background()
+	c := prottest.NewChain(t)
+	s, name := newTestSigner(t)
+
+	parent := c.State()
+	ub := generate(t, c, parent.TimestampMS()+1)
+	other := generate(t, c, parent.TimestampMS()+2)
+
+	sig, err := s.Sign(ctx, ub, parent)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !ed25519.Verify(s.PublicKey(), ub.Hash().Bytes(), sig) {
+		t.Error("signature does not verify")
+	}
+
+	_, err = s.Sign(ctx, ub, parent)
+	if err != nil {
+		t.Errorf("re-signing the same block: %v", err)
+	}
+	_, err = s.Sign(ctx, other, parent)
+	if errors.Root(err) != ErrConflict {
+		t.Errorf("signing a conflicting block: got error %v, want %v", err, ErrConflict)
+	}
+
+	// The watermark survives a restart.
+	s2 := New(s.key, NewFileWatermark(name))
+	_, err = s2.Sign(ctx, other, parent)
+	if errors.Root(err) != ErrConflict {
+		t.Errorf("after restart, signing a conflicting block: got error %v, want %v", err, ErrConflict)
+	}
+
+	b, err := bc.SignBlock(ub, parent.Header, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = c.CommitBlock(ctx, b)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	next := generate(t, c, c.State().TimestampMS()+1)
+	_, err = s2.Sign(ctx, next, c.State())
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	_, err = s2.Sign(ctx, ub, parent)
+	if errors.Root(err) != ErrStale {
+		t.Errorf("signing below the watermark: got error %v, want %v", err, ErrStale)
+	}
+}
+
+func TestSignInvalid(t *testing.T) {
+	ctx := context.Background()
+	c := prottest.NewChain(t)
+	s, _ := newTestSigner(t)
+
+	parent := c.State()
+	ub := generate(t, c, parent.TimestampMS()+1)
+	bogus := bc.NewHash([32]byte{1})
+	ub.ContractsRoot = &bogus
+	_, err := s.Sign(ctx, ub, parent)
+	if errors.Root(err) != protocol.ErrBadContractsRoot {
+		t.Errorf("signing block with bad contracts root: got error %v, want %v", err, protocol.ErrBadContractsRoot)
+	}
+
+	ub = generate(t, c, parent.TimestampMS()+1)
+	ub.TimestampMs = parent.TimestampMS() - 1
+	_, err = s.Sign(ctx, ub, parent)
+	if err == nil {
+		t.Error("signing block with timestamp before its parent: got no error")
+	}
+
+	// Neither failure moved the watermark.
+	w, err := s.wm.Watermark(ctx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if w != (Watermark{}) {
+		t.Errorf("watermark = %+v, want zero", w)
+	}
+}
+
+func TestCorruptWatermark(t *testing.T) {
+	ctx := context.Background()
+	s, name := newTestSigner(t)
+	err := ioutil.WriteFile(name, []byte("garbage"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.wm.Watermark(ctx)
+	if errors.Root(err) != ErrCorruptWatermark {
+		t.Errorf("reading corrupt watermark: got error %v, want %v", err, ErrCorruptWatermark)
+	}
+}
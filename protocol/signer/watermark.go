@@ -0,0 +1,127 @@
+package signer
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+)
+
+// Watermark records the highest block height a Signer has signed
+// and the ID of the block it signed at that height.
+type Watermark struct {
+	Height  uint64
+	BlockID bc.Hash
+}
+
+// WatermarkStore provides durable storage for a Signer's watermark.
+// SetWatermark must not return until the new watermark would
+// survive a crash.
+type WatermarkStore interface {
+	// Watermark returns the stored watermark, or the zero
+	// Watermark if none has been stored.
+	Watermark(context.Context) (Watermark, error)
+	SetWatermark(context.Context, Watermark) error
+}
+
+// ErrCorruptWatermark is returned by FileWatermark when the
+// watermark file exists but cannot be read back intact.
+var ErrCorruptWatermark = errors.New("corrupt watermark file")
+
+const watermarkSize = 8 + 32 + 4 // height, block ID, checksum
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// FileWatermark is a WatermarkStore that keeps the watermark in a
+// single file. Each update is written to a temporary file, synced,
+// and renamed over the old one, so the file always holds either the
+// old or the new watermark.
+//
+// A corrupt watermark file is reported as an error rather than
+// treated as absent, since that could allow a second signature at
+// an already-signed height.
+type FileWatermark struct {
+	name string
+
+	mu sync.Mutex
+}
+
+// NewFileWatermark returns a FileWatermark stored in the named file.
+func NewFileWatermark(name string) *FileWatermark {
+	return &FileWatermark{name: name}
+}
+
+// Watermark satisfies the WatermarkStore interface.
+func (f *FileWatermark) Watermark(ctx context.Context) (Watermark, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	b, err := ioutil.ReadFile(f.name)
+	if os.IsNotExist(err) {
+		return Watermark{}, nil
+	}
+	if err != nil {
+		return Watermark{}, errors.Wrap(err, "reading watermark file")
+	}
+	if len(b) != watermarkSize {
+		return Watermark{}, errors.WithDetailf(ErrCorruptWatermark, "file size %d", len(b))
+	}
+	if crc32.Checksum(b[:40], crcTable) != binary.BigEndian.Uint32(b[40:]) {
+		return Watermark{}, errors.WithDetail(ErrCorruptWatermark, "checksum mismatch")
+	}
+	return Watermark{
+		Height:  binary.BigEndian.Uint64(b),
+		BlockID: bc.HashFromBytes(b[8:40]),
+	}, nil
+}
+
+// SetWatermark satisfies the WatermarkStore interface.
+func (f *FileWatermark) SetWatermark(ctx context.Context, w Watermark) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var b [watermarkSize]byte
+	binary.BigEndian.PutUint64(b[:], w.Height)
+	copy(b[8:], w.BlockID.Bytes())
+	binary.BigEndian.PutUint32(b[40:], crc32.Checksum(b[:40], crcTable))
+
+	tmp := f.name + ".tmp"
+	err := writeFileSync(tmp, b[:])
+	if err != nil {
+		return errors.Wrap(err, "writing watermark file")
+	}
+	err = os.Rename(tmp, f.name)
+	if err != nil {
+		return errors.Wrap(err, "renaming watermark file")
+	}
+	d, err := os.Open(filepath.Dir(f.name))
+	if err != nil {
+		return errors.Wrap(err, "opening watermark directory")
+	}
+	defer d.Close()
+	return errors.Wrap(d.Sync(), "syncing watermark directory")
+}
+
+func writeFileSync(name string, b []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Sync()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,71 @@
+package state
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/chain/txvm/protocol/bc"
+)
+
+// BenchmarkPruneNonces prunes the 10 earliest-expiring nonces from
+// nonce sets of increasing size.
+func BenchmarkPruneNonces(b *testing.B) {
+	for _, n := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("nonces=%d", n), func(b *testing.B) {
+			s := Empty()
+			for i := 0; i < n; i++ {
+				var id [32]byte
+				binary.BigEndian.PutUint64(id[:], uint64(i))
+				s.NonceTree.Insert(bc.NonceCommitment(bc.NewHash(id), uint64(1000+i)))
+			}
+			s = s.PruneNonces(0)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.PruneNonces(1010)
+			}
+		})
+	}
+}
+
+// BenchmarkApplyBlockNonces applies a block that adds one nonce and
+// expires 10 others to states with nonce sets of increasing size.
+func BenchmarkApplyBlockNonces(b *testing.B) {
+	for _, n := range []int{1000, 2000, 10000, 100000} {
+		b.Run(fmt.Sprintf("nonces=%d", n), func(b *testing.B) {
+			s, err := Empty().ApplyBlock(&bc.UnsignedBlock{
+				BlockHeader: &bc.BlockHeader{Height: 1, NextPredicate: &bc.Predicate{}},
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+			tx := &bc.Tx{Finalized: true}
+			for i := 0; i < n; i++ {
+				var id [32]byte
+				binary.BigEndian.PutUint64(id[:], uint64(i))
+				tx.Nonces = append(tx.Nonces, bc.Nonce{ID: bc.NewHash(id), ExpMS: uint64(1000 + i)})
+			}
+			s, err = s.ApplyTx(bc.NewCommitmentsTx(tx))
+			if err != nil {
+				b.Fatal(err)
+			}
+			// Build the expiry index, if the nonce set is large
+			// enough, as for a state that has been pruned before.
+			s = s.PruneNonces(0)
+			block := &bc.UnsignedBlock{
+				BlockHeader: &bc.BlockHeader{Height: 2, TimestampMs: 1010, NextPredicate: &bc.Predicate{}},
+				Transactions: []*bc.Tx{{
+					Nonces:    []bc.Nonce{{ID: bc.NewHash([32]byte{0xff}), ExpMS: 5000}},
+					Finalized: true,
+				}},
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := s.ApplyBlock(block)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
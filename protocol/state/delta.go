@@ -0,0 +1,163 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/patricia"
+)
+
+// Delta is the change made to a Snapshot by a single block. Applying
+// a block's delta to a snapshot with ApplyDelta has the same result
+// as applying the block itself, without running any transactions.
+// A delta is proportional in size to the block, not to the whole
+// state, so storing one per block is much cheaper than storing a
+// full snapshot.
+type Delta struct {
+	Header *bc.BlockHeader
+
+	Contracts TreeDelta
+	Nonces    TreeDelta
+
+	// Outputs, AssetOutputs, and PubkeyOutputs are the changes to
+	// the output index.
+	Outputs       TreeDelta
+	AssetOutputs  TreeDelta
+	PubkeyOutputs TreeDelta
+}
+
+// TreeDelta lists the items inserted into and deleted from a
+// patricia tree.
+type TreeDelta struct {
+	Inserted [][]byte
+	Deleted  [][]byte
+}
+
+// NewDelta returns the delta from prev to next, where next is the
+// result of applying a single block to prev.
+func NewDelta(prev, next *Snapshot) (*Delta, error) {
+	if next.Header == nil || next.Height() != prev.Height()+1 {
+		return nil, fmt.Errorf("cannot make delta from height %d to height %d", prev.Height(), next.Height())
+	}
+	return &Delta{
+		Header:        next.Header,
+		Contracts:     treeDelta(prev.ContractsTree, next.ContractsTree),
+		Nonces:        treeDelta(prev.NonceTree, next.NonceTree),
+		Outputs:       treeDelta(prev.OutputsTree, next.OutputsTree),
+		AssetOutputs:  treeDelta(prev.AssetOutputsTree, next.AssetOutputsTree),
+		PubkeyOutputs: treeDelta(prev.PubkeyOutputsTree, next.PubkeyOutputsTree),
+	}, nil
+}
+
+func treeDelta(prev, next *patricia.Tree) TreeDelta {
+	var d TreeDelta
+	patricia.Diff(copyTree(prev), copyTree(next), func(item []byte) error {
+		d.Deleted = append(d.Deleted, item)
+		return nil
+	}, func(item []byte) error {
+		d.Inserted = append(d.Inserted, item)
+		return nil
+	})
+	return d
+}
+
+// ErrDeltaMismatch means ApplyDelta was called with a delta that
+// does not follow the snapshot's block, or that deletes an item not
+// present in the snapshot.
+var ErrDeltaMismatch = errors.New("delta does not match snapshot")
+
+// ApplyDelta returns the state after applying the change recorded in
+// d to s. The height of s must be one less than the height of d's
+// header, and d's header must name the header of s as its previous
+// block.
+//
+// ApplyDelta does not compare the resulting tree roots with those in
+// d's header. Callers folding a series of deltas onto a snapshot can
+// check the roots once at the end.
+func (s *Snapshot) ApplyDelta(d *Delta) (*Snapshot, error) {
+	if d.Header == nil {
+		return nil, errors.New("delta has no header")
+	}
+	if d.Header.Height != s.Height()+1 {
+		return nil, fmt.Errorf("cannot apply delta for height %d to a snapshot at height %d", d.Header.Height, s.Height())
+	}
+	if s.Header != nil {
+		if prev := d.Header.PreviousBlockId; prev == nil || *prev != s.Header.Hash() {
+			return nil, errors.WithDetailf(ErrDeltaMismatch, "delta for block %d does not follow block %x", d.Header.Height, s.Header.Hash().Bytes())
+		}
+	}
+
+	contractsTree, err := applyTreeDelta(s.ContractsTree, d.Contracts)
+	if err != nil {
+		return nil, errors.Wrap(err, "applying contracts delta")
+	}
+	nonceTree, err := applyTreeDelta(s.NonceTree, d.Nonces)
+	if err != nil {
+		return nil, errors.Wrap(err, "applying nonces delta")
+	}
+	outputsTree, err := applyTreeDelta(s.OutputsTree, d.Outputs)
+	if err != nil {
+		return nil, errors.Wrap(err, "applying outputs delta")
+	}
+	assetOutputsTree, err := applyTreeDelta(s.AssetOutputsTree, d.AssetOutputs)
+	if err != nil {
+		return nil, errors.Wrap(err, "applying asset outputs delta")
+	}
+	pubkeyOutputsTree, err := applyTreeDelta(s.PubkeyOutputsTree, d.PubkeyOutputs)
+	if err != nil {
+		return nil, errors.Wrap(err, "applying pubkey outputs delta")
+	}
+
+	next, err := s.ApplyBlockHeader(d.Header)
+	if err != nil {
+		return nil, errors.Wrap(err, "applying block header")
+	}
+
+	next.ContractsTree = contractsTree
+	next.NonceTree = nonceTree
+	next.setNonceExpiry(applyExpiryDelta(s.validNonceExpiry(), d.Nonces))
+	next.OutputsTree = outputsTree
+	next.AssetOutputsTree = assetOutputsTree
+	next.PubkeyOutputsTree = pubkeyOutputsTree
+	return next, nil
+}
+
+func applyTreeDelta(tree *patricia.Tree, d TreeDelta) (*patricia.Tree, error) {
+	t := copyTree(tree)
+	for _, item := range d.Deleted {
+		if !t.Contains(item) {
+			return nil, errors.Wrapf(ErrDeltaMismatch, "deleting %x", item)
+		}
+		t.Delete(item)
+	}
+	for _, item := range d.Inserted {
+		err := t.Insert(item)
+		if err != nil {
+			return nil, errors.Wrapf(err, "inserting %x", item)
+		}
+	}
+	return t, nil
+}
+
+// applyExpiryDelta returns a copy of the nonce expiry index updated
+// with the nonce changes in d. It returns nil if index is nil or
+// cannot be updated; PruneNonces then rebuilds it if the nonce set
+// is large enough.
+func applyExpiryDelta(index *expiryIndex, d TreeDelta) *expiryIndex {
+	if index == nil {
+		return nil
+	}
+	ix := *index
+	for _, nc := range d.Deleted {
+		if !ix.remove(nc) {
+			return nil
+		}
+	}
+	for _, nc := range d.Inserted {
+		if !ix.add(nc) {
+			return nil
+		}
+	}
+	return &ix
+}
@@ -0,0 +1,113 @@
+package state
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+)
+
+func TestDelta(t *testing.T) {
+	prev := empty(t)
+	spent := bc.NewHash([32]byte{1})
+	prev.ContractsTree.Insert(spent.Bytes())
+	prev.NonceTree.Insert(bc.NonceCommitment(bc.NewHash([32]byte{2}), 5))
+
+	prevID := prev.Header.Hash()
+
+	// The block spends one contract, creates another, adds a nonce,
+	// and expires the existing nonce.
+	block := &bc.UnsignedBlock{
+		BlockHeader: &bc.BlockHeader{
+			Height:          2,
+			PreviousBlockId: &prevID,
+			TimestampMs:     10,
+			NextPredicate:   &bc.Predicate{},
+		},
+		Transactions: []*bc.Tx{{
+			Contracts: []bc.Contract{
+				{Type: bc.InputType, ID: spent},
+				{Type: bc.OutputType, ID: bc.NewHash([32]byte{3})},
+			},
+			Nonces:    []bc.Nonce{{ID: bc.NewHash([32]byte{4}), ExpMS: 20}},
+			Finalized: true,
+		}},
+	}
+	next, err := prev.ApplyBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewDelta(prev, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Contracts.Inserted) != 1 || len(d.Contracts.Deleted) != 1 {
+		t.Errorf("got %d contracts inserted and %d deleted, want 1 and 1", len(d.Contracts.Inserted), len(d.Contracts.Deleted))
+	}
+	if len(d.Nonces.Inserted) != 1 || len(d.Nonces.Deleted) != 1 {
+		t.Errorf("got %d nonces inserted and %d deleted, want 1 and 1", len(d.Nonces.Inserted), len(d.Nonces.Deleted))
+	}
+
+	b, err := d.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d2 Delta
+	err = d2.FromBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := prev.ApplyDelta(&d2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ContractsTree.RootHash() != next.ContractsTree.RootHash() {
+		t.Error("contracts root after ApplyDelta differs from ApplyBlock")
+	}
+	if got.NonceTree.RootHash() != next.NonceTree.RootHash() {
+		t.Error("nonces root after ApplyDelta differs from ApplyBlock")
+	}
+	gotBytes, err := got.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantBytes, err := next.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gotBytes, wantBytes) {
+		t.Error("snapshot after ApplyDelta differs from ApplyBlock")
+	}
+
+	// Applying the delta again fails.
+	_, err = got.ApplyDelta(&d2)
+	if err == nil {
+		t.Error("expected error applying delta at the wrong height")
+	}
+
+	// Deleting an absent item is a mismatch.
+	mismatched := Copy(prev)
+	mismatched.ContractsTree.Delete(spent.Bytes())
+	_, err = mismatched.ApplyDelta(&d2)
+	if errors.Root(err) != ErrDeltaMismatch {
+		t.Errorf("got error %v, want %s", err, ErrDeltaMismatch)
+	}
+
+	// A delta must follow the snapshot's block.
+	_, err = next.ApplyDelta(&Delta{Header: &bc.BlockHeader{Height: 3, PreviousBlockId: &prevID, NextPredicate: &bc.Predicate{}}})
+	if errors.Root(err) != ErrDeltaMismatch {
+		t.Errorf("applying delta for another block's child: got error %v, want %s", err, ErrDeltaMismatch)
+	}
+	_, err = prev.ApplyDelta(&Delta{Header: &bc.BlockHeader{Height: 2, NextPredicate: &bc.Predicate{}}})
+	if errors.Root(err) != ErrDeltaMismatch {
+		t.Errorf("applying delta with no previous block: got error %v, want %s", err, ErrDeltaMismatch)
+	}
+
+	_, err = NewDelta(prev, prev)
+	if err == nil {
+		t.Error("expected error making delta between snapshots at the same height")
+	}
+}
@@ -0,0 +1,136 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/patricia"
+)
+
+func TestPruneNoncesIndex(t *testing.T) {
+	defer func(min int) { nonceExpiryMin = min }(nonceExpiryMin)
+	nonceExpiryMin = 10
+
+	// Nonces are added through ApplyTx, which maintains the expiry
+	// index once PruneNonces has built it, and directly to
+	// NonceTree, which invalidates it.
+	indexed := empty(t)
+	for i := 0; i < 20; i++ {
+		tx := &bc.Tx{
+			Nonces:    []bc.Nonce{{ID: bc.NewHash([32]byte{byte(i)}), ExpMS: uint64(100 - 3*i)}},
+			Finalized: true,
+		}
+		var err error
+		indexed, err = indexed.ApplyTx(bc.NewCommitmentsTx(tx))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == nonceExpiryMin-2 {
+			// Too few nonces for an index.
+			if indexed.PruneNonces(0).validNonceExpiry() != nil {
+				t.Fatalf("PruneNonces built an expiry index for %d nonces", i+1)
+			}
+		}
+	}
+	indexed = indexed.PruneNonces(0)
+	if index := indexed.validNonceExpiry(); index == nil || index.n != 20 {
+		t.Fatal("PruneNonces did not build the expiry index for 20 nonces")
+	}
+	direct := Copy(indexed)
+	direct.NonceTree.Insert(bc.NonceCommitment(bc.NewHash([32]byte{100}), 50))
+	if direct.validNonceExpiry() != nil {
+		t.Fatal("expiry index still valid after inserting into NonceTree")
+	}
+
+	for _, s := range []*Snapshot{indexed, direct} {
+		for _, ts := range []uint64{0, 41, 50, 51, 73, 86, 101} {
+			want := copyTree(s.NonceTree)
+			var remaining int
+			patricia.Walk(s.NonceTree, func(item []byte) error {
+				if _, exp := idTime(item); ts > exp {
+					want.Delete(item)
+				} else {
+					remaining++
+				}
+				return nil
+			})
+
+			got := s.PruneNonces(ts)
+			if got.NonceTree.RootHash() != want.RootHash() {
+				t.Errorf("PruneNonces(%d): got nonces root %x, want %x", ts, got.NonceTree.RootHash(), want.RootHash())
+			}
+
+			// An index is kept while at least half of
+			// nonceExpiryMin nonces remain, and rebuilt for at least
+			// nonceExpiryMin.
+			wantIndex := remaining >= nonceExpiryMin
+			if s == indexed {
+				wantIndex = remaining >= nonceExpiryMin/2
+			}
+			index := got.validNonceExpiry()
+			if (index != nil) != wantIndex {
+				t.Errorf("PruneNonces(%d) with %d nonces remaining: got expiry index %t, want %t", ts, remaining, index != nil, wantIndex)
+			} else if index != nil && (index.keys.RootHash() != expiryRoot(want) || index.n != remaining) {
+				t.Errorf("PruneNonces(%d): expiry index does not match nonce tree", ts)
+			}
+		}
+	}
+
+	// Round trips through Bytes and ApplyDelta keep the index.
+	b, err := indexed.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored Snapshot
+	err = restored.FromBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index := restored.validNonceExpiry(); index == nil || index.keys.RootHash() != expiryRoot(indexed.NonceTree) {
+		t.Error("FromBytes did not build the expiry index")
+	}
+
+	prevID := indexed.Header.Hash()
+	next, err := indexed.ApplyBlock(&bc.UnsignedBlock{
+		BlockHeader: &bc.BlockHeader{Height: 2, PreviousBlockId: &prevID, TimestampMs: 60, NextPredicate: &bc.Predicate{}},
+		Transactions: []*bc.Tx{{
+			Nonces:    []bc.Nonce{{ID: bc.NewHash([32]byte{200}), ExpMS: 1000}},
+			Finalized: true,
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDelta(indexed, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := indexed.ApplyDelta(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index := got.validNonceExpiry(); index == nil || index.keys.RootHash() != expiryRoot(next.NonceTree) || index.n != 15 {
+		t.Error("ApplyDelta did not maintain the expiry index")
+	}
+
+	// A nonce the index cannot hold drops it rather than leaving it
+	// out of date.
+	d.Nonces.Inserted = append(d.Nonces.Inserted[:len(d.Nonces.Inserted):len(d.Nonces.Inserted)], []byte("short"))
+	got, err = indexed.ApplyDelta(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.validNonceExpiry() != nil {
+		t.Error("ApplyDelta kept an expiry index missing an inserted nonce")
+	}
+}
+
+// expiryRoot returns the root hash of the expiry index for the given
+// nonce tree, whatever its size.
+func expiryRoot(nonces *patricia.Tree) [32]byte {
+	var index patricia.Tree
+	patricia.Walk(nonces, func(item []byte) error {
+		return index.Insert(expiryKey(item))
+	})
+	return index.RootHash()
+}
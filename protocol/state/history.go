@@ -0,0 +1,128 @@
+package state
+
+import (
+	"sort"
+	"sync"
+)
+
+// A RetentionPolicy reports whether a History should retain the
+// snapshot at the given height, when the latest height is tip.
+type RetentionPolicy func(height, tip uint64) bool
+
+// KeepAll is a RetentionPolicy that retains every snapshot.
+func KeepAll(height, tip uint64) bool { return true }
+
+// KeepRecent returns a RetentionPolicy that retains the snapshots at
+// the n most recent heights.
+func KeepRecent(n uint64) RetentionPolicy {
+	return func(height, tip uint64) bool {
+		return tip-height < n
+	}
+}
+
+// KeepEvery returns a RetentionPolicy that retains the snapshots at
+// heights that are multiples of n.
+func KeepEvery(n uint64) RetentionPolicy {
+	return func(height, tip uint64) bool {
+		return n > 0 && height%n == 0
+	}
+}
+
+// KeepAny returns a RetentionPolicy that retains the snapshots
+// retained by any of the given policies. For example,
+//
+//	KeepAny(KeepRecent(100), KeepEvery(10000))
+//
+// keeps the last 100 heights plus a checkpoint every 10000 heights.
+func KeepAny(policies ...RetentionPolicy) RetentionPolicy {
+	return func(height, tip uint64) bool {
+		for _, p := range policies {
+			if p(height, tip) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// History holds the states of a blockchain at past heights. Because
+// a Snapshot is immutable and shares the unchanged parts of its
+// trees with the snapshot it was made from, each retained height
+// costs memory in proportion only to what changed at that height.
+// The exception is the list of block IDs in RefIDs, which grows by
+// one at each height; snapshots along a chain share the arrays
+// holding it, so that all of them together take space proportional
+// to the latest height.
+//
+// It is safe to call History's methods concurrently.
+type History struct {
+	mu        sync.Mutex
+	policy    RetentionPolicy
+	tip       uint64
+	snapshots map[uint64]*Snapshot
+}
+
+// NewHistory returns an empty History that retains snapshots
+// according to policy.
+func NewHistory(policy RetentionPolicy) *History {
+	return &History{
+		policy:    policy,
+		snapshots: make(map[uint64]*Snapshot),
+	}
+}
+
+// Add records s as the state at its height, then discards the
+// snapshots that h's policy no longer retains. The snapshot at the
+// greatest height added is always retained. Add takes time
+// proportional to the number of retained snapshots.
+func (h *History) Add(s *Snapshot) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.snapshots[s.Height()] = s
+	if s.Height() > h.tip {
+		h.tip = s.Height()
+	}
+	h.prune()
+}
+
+// SetPolicy replaces h's retention policy and discards the snapshots
+// it does not retain. Snapshots already discarded are not restored.
+func (h *History) SetPolicy(policy RetentionPolicy) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.policy = policy
+	h.prune()
+}
+
+func (h *History) prune() {
+	for height := range h.snapshots {
+		if height != h.tip && !h.policy(height, h.tip) {
+			delete(h.snapshots, height)
+		}
+	}
+}
+
+// At returns the state at the given height, if h retains it.
+func (h *History) At(height uint64) (*Snapshot, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.snapshots[height]
+	return s, ok
+}
+
+// Heights returns the heights of the snapshots h retains, in
+// increasing order.
+func (h *History) Heights() []uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	heights := make([]uint64, 0, len(h.snapshots))
+	for height := range h.snapshots {
+		heights = append(heights, height)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	return heights
+}
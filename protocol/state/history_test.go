@@ -0,0 +1,98 @@
+package state
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chain/txvm/protocol/bc"
+)
+
+func TestHistory(t *testing.T) {
+	h := NewHistory(KeepAny(KeepRecent(3), KeepEvery(4)))
+
+	// Each block adds one contract, so the state at each height can
+	// be told apart.
+	s := empty(t)
+	h.Add(s)
+	for height := uint64(2); height <= 10; height++ {
+		next, err := s.ApplyBlock(&bc.UnsignedBlock{
+			BlockHeader: &bc.BlockHeader{Height: height, TimestampMs: height, NextPredicate: &bc.Predicate{}},
+			Transactions: []*bc.Tx{{
+				Contracts: []bc.Contract{{Type: bc.OutputType, ID: bc.NewHash([32]byte{byte(height)})}},
+				Finalized: true,
+			}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s = next
+		h.Add(s)
+	}
+
+	if got, want := h.Heights(), []uint64{4, 8, 9, 10}; !reflect.DeepEqual(got, want) {
+		t.Errorf("retained heights %v, want %v", got, want)
+	}
+	s4, ok := h.At(4)
+	if !ok {
+		t.Fatal("no snapshot at height 4")
+	}
+	if s4.Height() != 4 {
+		t.Errorf("snapshot at height 4 has height %d", s4.Height())
+	}
+	if !s4.ContractsTree.Contains(bc.NewHash([32]byte{4}).Bytes()) || s4.ContractsTree.Contains(bc.NewHash([32]byte{5}).Bytes()) {
+		t.Error("snapshot at height 4 has the wrong contracts")
+	}
+	if _, ok := h.At(5); ok {
+		t.Error("got pruned snapshot at height 5")
+	}
+
+	// Adding an older snapshot does not move the tip.
+	h.Add(s4)
+	h.SetPolicy(KeepRecent(1))
+	if got, want := h.Heights(), []uint64{10}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after SetPolicy, retained heights %v, want %v", got, want)
+	}
+
+	// The tip is retained even if the policy would discard it.
+	h.SetPolicy(func(height, tip uint64) bool { return false })
+	if got, want := h.Heights(), []uint64{10}; !reflect.DeepEqual(got, want) {
+		t.Errorf("with empty policy, retained heights %v, want %v", got, want)
+	}
+}
+
+func TestHistoryRefIDsShared(t *testing.T) {
+	const tip = 1000
+	h := NewHistory(KeepAll)
+	s := empty(t)
+	h.Add(s)
+	for height := uint64(2); height <= tip; height++ {
+		next, err := s.ApplyBlockHeader(&bc.BlockHeader{Height: height, TimestampMs: height, NextPredicate: &bc.Predicate{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s = next
+		h.Add(s)
+	}
+
+	// Each retained snapshot has its own RefIDs, but they are backed
+	// by a few arrays whose total size is proportional to the tip
+	// height, rather than by one array per snapshot.
+	arrays := make(map[*bc.Hash]int)
+	for _, height := range h.Heights() {
+		s, _ := h.At(height)
+		if uint64(len(s.RefIDs)) != height {
+			t.Fatalf("snapshot at height %d has %d RefIDs", height, len(s.RefIDs))
+		}
+		if s.RefIDs[height-1] != s.Header.Hash() {
+			t.Fatalf("snapshot at height %d has last RefID %x, want its own header", height, s.RefIDs[height-1].Bytes())
+		}
+		arrays[&s.RefIDs[0]] = cap(s.RefIDs)
+	}
+	var total int
+	for _, n := range arrays {
+		total += n
+	}
+	if total > 4*tip {
+		t.Errorf("%d retained snapshots use %d arrays of %d RefIDs in all, want at most %d", tip, len(arrays), total, 4*tip)
+	}
+}
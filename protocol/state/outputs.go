@@ -0,0 +1,209 @@
+package state
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/patricia"
+	"github.com/chain/txvm/protocol/txvm"
+)
+
+// The output index consists of three trees, each a set of keys
+// beginning with a 32-byte lookup key:
+//
+//	OutputsTree        output ID || encoded snapshot
+//	AssetOutputsTree   asset ID  || output ID
+//	PubkeyOutputsTree  pubkey    || output ID
+//
+// so a lookup is a walk of the items with the lookup key as prefix.
+// Unlike ContractsTree, the index is not part of the blockchain
+// state commitment.
+
+// OutputSnapshot returns the encoded snapshot of the unspent output
+// with the given ID (see bc.Output.Snapshot), if it is in the output
+// index. An output is in the index if it was added to s by ApplyTx.
+func (s *Snapshot) OutputSnapshot(id bc.Hash) ([]byte, bool) {
+	var snapshot []byte
+	walkIndex(s.OutputsTree, id.Bytes(), func(suffix []byte) {
+		snapshot = suffix
+	})
+	return snapshot, snapshot != nil
+}
+
+// OutputsByAsset returns the IDs of the unspent outputs in the
+// output index holding values of the given asset.
+func (s *Snapshot) OutputsByAsset(assetID bc.Hash) []bc.Hash {
+	return indexIDs(s.AssetOutputsTree, assetID.Bytes())
+}
+
+// OutputsByPubkey returns the IDs of the unspent outputs in the
+// output index that are standard pay-to-multisig contracts with the
+// given public key among their signers.
+func (s *Snapshot) OutputsByPubkey(pubkey ed25519.PublicKey) []bc.Hash {
+	return indexIDs(s.PubkeyOutputsTree, pubkey)
+}
+
+func indexIDs(tree *patricia.Tree, key []byte) []bc.Hash {
+	var ids []bc.Hash
+	walkIndex(tree, key, func(suffix []byte) {
+		ids = append(ids, bc.HashFromBytes(suffix))
+	})
+	return ids
+}
+
+// walkIndex calls f with the rest of each item in tree that begins
+// with key.
+func walkIndex(tree *patricia.Tree, key []byte, f func(suffix []byte)) {
+	if tree == nil {
+		return
+	}
+	patricia.WalkPrefix(tree, key, func(item []byte) error {
+		f(item[len(key):])
+		return nil
+	})
+}
+
+// indexOutput adds out to the output index trees.
+func indexOutput(outputs, assets, pubkeys *patricia.Tree, out *bc.Output) error {
+	id := out.ID.Bytes()
+	err := outputs.Insert(append(id, out.Snapshot()...))
+	if err != nil {
+		return errors.Wrap(err, "indexing output snapshot")
+	}
+	assetIDs, keys := outputKeys(out.Seed, out.Stack)
+	for _, assetID := range assetIDs {
+		err = assets.Insert(append(assetID, id...))
+		if err != nil {
+			return errors.Wrap(err, "indexing output asset")
+		}
+	}
+	for _, key := range keys {
+		err = pubkeys.Insert(append(key, id...))
+		if err != nil {
+			return errors.Wrap(err, "indexing output pubkey")
+		}
+	}
+	return nil
+}
+
+// unindexOutput removes the output spent by in from the output index
+// trees.
+func unindexOutput(outputs, assets, pubkeys *patricia.Tree, in *bc.Input) {
+	id := in.ID.Bytes()
+	var items [][]byte
+	patricia.WalkPrefix(outputs, id, func(item []byte) error {
+		items = append(items, item)
+		return nil
+	})
+	for _, item := range items {
+		outputs.Delete(item)
+	}
+	assetIDs, keys := outputKeys(in.Seed, in.Stack)
+	for _, assetID := range assetIDs {
+		assets.Delete(append(assetID, id...))
+	}
+	for _, key := range keys {
+		pubkeys.Delete(append(key, id...))
+	}
+}
+
+// multisigSeeds are the seeds of the standard pay-to-multisig
+// contracts, versions 1 and 2, from package txbuilder/standard. They
+// are repeated here (and checked in the tests) so that this package
+// does not depend on the packages that build transactions.
+var multisigSeeds = map[[32]byte]bool{
+	mustDecodeSeed("7b4f536b0aee69d8711a05361a7f1e75de68ed1b27271fb9d7e7dd5400af95a7"): true,
+	mustDecodeSeed("47bb956c9e8844bf5d3cc3ed93d01e275353523142b6fb3999b5d0e11a958ffa"): true,
+}
+
+func mustDecodeSeed(s string) (seed [32]byte) {
+	n, err := hex.Decode(seed[:], []byte(s))
+	if err != nil || n != len(seed) {
+		panic(fmt.Sprintf("bad seed %q", s))
+	}
+	return seed
+}
+
+// outputKeys returns the asset IDs of the values on the stack of a
+// contract, and its public keys if it is a standard pay-to-multisig
+// contract. The stack items are inspected, as in bc.Output. The
+// results do not share memory with the stack, so callers may append
+// to them.
+func outputKeys(seed bc.Hash, stack []txvm.Data) (assetIDs, pubkeys [][]byte) {
+	seen := make(map[string]bool)
+	for _, item := range stack {
+		assetID, ok := inspectedAssetID(item)
+		if !ok || seen[string(assetID)] {
+			continue
+		}
+		seen[string(assetID)] = true
+		assetIDs = append(assetIDs, append([]byte(nil), assetID...))
+	}
+
+	if !multisigSeeds[seed.Byte32()] || len(stack) < 2 {
+		return assetIDs, nil
+	}
+	keys, ok := inspected(stack[1], txvm.TupleCode, 2)
+	if !ok {
+		return assetIDs, nil
+	}
+	keyTuple, ok := keys[1].(txvm.Tuple)
+	if !ok {
+		return assetIDs, nil
+	}
+	for _, k := range keyTuple {
+		key, ok := k.(txvm.Bytes)
+		if !ok || len(key) != ed25519.PublicKeySize {
+			return assetIDs, nil
+		}
+		pubkeys = append(pubkeys, append([]byte(nil), key...))
+	}
+	return assetIDs, pubkeys
+}
+
+// inspectedAssetID returns the asset ID of item, if it is an
+// inspected value: {'V', amount, assetID, anchor}.
+func inspectedAssetID(item txvm.Data) ([]byte, bool) {
+	t, ok := inspected(item, txvm.ValueCode, 4)
+	if !ok {
+		return nil, false
+	}
+	if _, ok := t[1].(txvm.Int); !ok {
+		return nil, false
+	}
+	assetID, ok := t[2].(txvm.Bytes)
+	if !ok || len(assetID) != 32 {
+		return nil, false
+	}
+	if _, ok := t[3].(txvm.Bytes); !ok {
+		return nil, false
+	}
+	return assetID, true
+}
+
+// inspected returns item as a tuple, if it is one of length n whose
+// first element is the one-byte type code.
+func inspected(item txvm.Data, code byte, n int) (txvm.Tuple, bool) {
+	t, ok := item.(txvm.Tuple)
+	if !ok || len(t) != n {
+		return nil, false
+	}
+	c, ok := t[0].(txvm.Bytes)
+	if !ok || len(c) != 1 || c[0] != code {
+		return nil, false
+	}
+	return t, true
+}
+
+// copyTree returns a new tree with the contents of t, which may be
+// nil.
+func copyTree(t *patricia.Tree) *patricia.Tree {
+	c := new(patricia.Tree)
+	if t != nil {
+		*c = *t
+	}
+	return c
+}
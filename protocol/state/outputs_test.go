@@ -0,0 +1,125 @@
+package state
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/txbuilder"
+	"github.com/chain/txvm/protocol/txbuilder/standard"
+	"github.com/chain/txvm/protocol/txvm"
+)
+
+func TestOutputIndex(t *testing.T) {
+	snap := empty(t)
+
+	var (
+		pubkeys []ed25519.PublicKey
+		prvkeys []ed25519.PrivateKey
+	)
+	for i := 0; i < 3; i++ {
+		pub, prv, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubkeys = append(pubkeys, pub)
+		prvkeys = append(prvkeys, prv)
+	}
+	sign := func(tpl *txbuilder.Template) *bc.Tx {
+		err := tpl.Sign(context.Background(), func(_ context.Context, msg, keyID []byte, _ [][]byte) ([]byte, error) {
+			return ed25519.Sign(prvkeys[keyID[0]], msg), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx, err := tpl.Tx()
+		if err != nil {
+			t.Fatal(err)
+		}
+		snap, err = snap.ApplyTx(bc.NewCommitmentsTx(tx))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+
+	// Issue to a 2-of-2 output.
+	assetID := bc.NewHash(standard.AssetID(2, 1, pubkeys[:1], nil))
+	tpl := &txbuilder.Template{MaxTimeMS: 100}
+	tpl.AddIssuance(2, snap.InitialBlockID.Bytes(), nil, 1, [][]byte{{0}}, nil, pubkeys[:1], 10, nil, nil)
+	tpl.AddOutput(2, pubkeys[1:3], 10, assetID, nil, nil)
+	tx1 := sign(tpl)
+	out1 := tx1.Outputs[0]
+
+	snapshot, ok := snap.OutputSnapshot(out1.ID)
+	if !ok {
+		t.Fatal("issued output not in index")
+	}
+	if got := bc.NewHash(txvm.VMHash("SnapshotID", snapshot)); got != out1.ID {
+		t.Errorf("indexed snapshot has ID %x, want %x", got.Bytes(), out1.ID.Bytes())
+	}
+	if got := snap.OutputsByAsset(assetID); !reflect.DeepEqual(got, []bc.Hash{out1.ID}) {
+		t.Errorf("OutputsByAsset got %v, want [%x]", got, out1.ID.Bytes())
+	}
+	for i, want := range [][]bc.Hash{nil, {out1.ID}, {out1.ID}} {
+		if got := snap.OutputsByPubkey(pubkeys[i]); !reflect.DeepEqual(got, want) {
+			t.Errorf("OutputsByPubkey(key %d) got %v, want %v", i, got, want)
+		}
+	}
+
+	// Spend it to a 1-of-1 output.
+	decoded, err := txvm.Decode(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anchor := decoded.(txvm.Tuple)[5].(txvm.Tuple)[3].(txvm.Bytes)
+	tpl = &txbuilder.Template{MaxTimeMS: 100}
+	tpl.AddInput(2, [][]byte{{1}, {2}}, nil, pubkeys[1:3], 10, assetID, anchor, nil, 2)
+	tpl.AddOutput(1, pubkeys[:1], 10, assetID, nil, nil)
+	tx2 := sign(tpl)
+	out2 := tx2.Outputs[0]
+
+	if _, ok := snap.OutputSnapshot(out1.ID); ok {
+		t.Error("spent output still in index")
+	}
+	if _, ok := snap.OutputSnapshot(out2.ID); !ok {
+		t.Error("new output not in index")
+	}
+	if got := snap.OutputsByAsset(assetID); !reflect.DeepEqual(got, []bc.Hash{out2.ID}) {
+		t.Errorf("OutputsByAsset got %v, want [%x]", got, out2.ID.Bytes())
+	}
+	for i, want := range [][]bc.Hash{{out2.ID}, nil, nil} {
+		if got := snap.OutputsByPubkey(pubkeys[i]); !reflect.DeepEqual(got, want) {
+			t.Errorf("OutputsByPubkey(key %d) got %v, want %v", i, got, want)
+		}
+	}
+
+	b, err := snap.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snap2 Snapshot
+	err = snap2.FromBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := snap2.OutputSnapshot(out2.ID); !reflect.DeepEqual(got, out2.Snapshot()) {
+		t.Error("output index not preserved by Bytes and FromBytes")
+	}
+	if got := snap2.OutputsByPubkey(pubkeys[0]); !reflect.DeepEqual(got, []bc.Hash{out2.ID}) {
+		t.Errorf("after FromBytes, OutputsByPubkey got %v, want [%x]", got, out2.ID.Bytes())
+	}
+}
+
+func TestMultisigSeeds(t *testing.T) {
+	for _, seed := range [][32]byte{standard.PayToMultisigSeed1, standard.PayToMultisigSeed2} {
+		if !multisigSeeds[seed] {
+			t.Errorf("standard pay-to-multisig seed %x missing from multisigSeeds", seed[:])
+		}
+	}
+	if len(multisigSeeds) != 2 {
+		t.Errorf("got %d multisig seeds, want 2", len(multisigSeeds))
+	}
+}
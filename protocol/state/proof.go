@@ -0,0 +1,71 @@
+package state
+
+import (
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/patricia"
+)
+
+// ErrBadProof is returned by ContractProof.Verify when the proof
+// does not match the block header.
+var ErrBadProof = errors.New("invalid contract proof")
+
+// ContractProof proves whether a contract ID is in the contracts
+// tree committed to by the ContractsRoot of the block header at
+// Height, i.e. whether the contract is unspent at that height.
+// Exactly one of Inclusion and NonInclusion is set.
+type ContractProof struct {
+	ID           bc.Hash
+	Height       uint64
+	Inclusion    *patricia.Proof
+	NonInclusion *patricia.NonInclusionProof
+}
+
+// ProveContract returns a proof of whether the contract with the
+// given ID is in s's contracts tree.
+func (s *Snapshot) ProveContract(id bc.Hash) (*ContractProof, error) {
+	if s.Header == nil {
+		return nil, ErrEmptyState
+	}
+	p := &ContractProof{ID: id, Height: s.Height()}
+	if s.ContractsTree.Contains(id.Bytes()) {
+		incl, err := s.ContractsTree.ProveInclusion(id.Bytes())
+		if err != nil {
+			return nil, errors.Wrapf(err, "proving inclusion of %x", id.Bytes())
+		}
+		p.Inclusion = incl
+		return p, nil
+	}
+	nonIncl, err := s.ContractsTree.ProveNonInclusion(id.Bytes())
+	if err != nil {
+		return nil, errors.Wrapf(err, "proving non-inclusion of %x", id.Bytes())
+	}
+	p.NonInclusion = nonIncl
+	return p, nil
+}
+
+// Verify checks p against the block header h, which must be at
+// p.Height. It reports whether the proof shows the contract to be in
+// the contracts tree.
+func (p *ContractProof) Verify(h *bc.BlockHeader) (unspent bool, err error) {
+	if h.Height != p.Height {
+		return false, errors.WithDetailf(ErrBadProof, "proof height %d, header height %d", p.Height, h.Height)
+	}
+	if h.ContractsRoot == nil {
+		return false, errors.WithDetail(ErrBadProof, "header has no contracts root")
+	}
+	root := h.ContractsRoot.Byte32()
+	switch {
+	case p.Inclusion != nil && p.NonInclusion == nil:
+		if !patricia.VerifyInclusion(root, p.ID.Bytes(), p.Inclusion) {
+			return false, errors.WithDetailf(ErrBadProof, "inclusion of %x", p.ID.Bytes())
+		}
+		return true, nil
+	case p.NonInclusion != nil && p.Inclusion == nil:
+		if !patricia.VerifyNonInclusion(root, p.ID.Bytes(), p.NonInclusion) {
+			return false, errors.WithDetailf(ErrBadProof, "non-inclusion of %x", p.ID.Bytes())
+		}
+		return false, nil
+	}
+	return false, errors.WithDetail(ErrBadProof, "need exactly one of inclusion and non-inclusion proofs")
+}
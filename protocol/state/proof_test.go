@@ -0,0 +1,62 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+)
+
+func TestContractProof(t *testing.T) {
+	snap := empty(t)
+	for i := byte(1); i <= 5; i++ {
+		id := bc.NewHash([32]byte{i * 2})
+		err := snap.ContractsTree.Insert(id.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	root := bc.NewHash(snap.ContractsTree.RootHash())
+	header := *snap.Header
+	header.ContractsRoot = &root
+
+	cases := []struct {
+		id      bc.Hash
+		unspent bool
+	}{
+		{bc.NewHash([32]byte{4}), true},
+		{bc.NewHash([32]byte{5}), false},
+		{bc.NewHash([32]byte{0}), false},
+		{bc.NewHash([32]byte{0xff}), false},
+	}
+	for _, c := range cases {
+		p, err := snap.ProveContract(c.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		unspent, err := p.Verify(&header)
+		if err != nil {
+			t.Errorf("verifying proof for %x: %v", c.id.Bytes(), err)
+		}
+		if unspent != c.unspent {
+			t.Errorf("proof for %x: unspent = %v, want %v", c.id.Bytes(), unspent, c.unspent)
+		}
+	}
+
+	p, err := snap.ProveContract(bc.NewHash([32]byte{4}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.ID = bc.NewHash([32]byte{6})
+	_, err = p.Verify(&header)
+	if errors.Root(err) != ErrBadProof {
+		t.Errorf("verifying proof with altered ID: got error %v, want %v", err, ErrBadProof)
+	}
+
+	p.ID = bc.NewHash([32]byte{4})
+	header.Height++
+	_, err = p.Verify(&header)
+	if errors.Root(err) != ErrBadProof {
+		t.Errorf("verifying proof against wrong height: got error %v, want %v", err, ErrBadProof)
+	}
+}
@@ -9,6 +9,8 @@ It is generated from these files:
 
 It has these top-level messages:
 	RawSnapshot
+	RawDelta
+	RawTreeDelta
 */
 package state
 
@@ -38,6 +40,12 @@ type RawSnapshot struct {
 	Header         *bc.BlockHeader `protobuf:"bytes,3,opt,name=header" json:"header,omitempty"`
 	InitialBlockId *bc.Hash        `protobuf:"bytes,4,opt,name=initial_block_id,json=initialBlockId" json:"initial_block_id,omitempty"`
 	RefIds         []*bc.Hash      `protobuf:"bytes,5,rep,name=ref_ids,json=refIds" json:"ref_ids,omitempty"`
+	// OutputNodes, AssetOutputNodes, and PubkeyOutputNodes contain
+	// every leaf node within the output index trees, in the same order
+	// as ContractNodes.
+	OutputNodes       [][]byte `protobuf:"bytes,6,rep,name=output_nodes,json=outputNodes,proto3" json:"output_nodes,omitempty"`
+	AssetOutputNodes  [][]byte `protobuf:"bytes,7,rep,name=asset_output_nodes,json=assetOutputNodes,proto3" json:"asset_output_nodes,omitempty"`
+	PubkeyOutputNodes [][]byte `protobuf:"bytes,8,rep,name=pubkey_output_nodes,json=pubkeyOutputNodes,proto3" json:"pubkey_output_nodes,omitempty"`
 }
 
 func (m *RawSnapshot) Reset()                    { *m = RawSnapshot{} }
@@ -80,27 +88,145 @@ func (m *RawSnapshot) GetRefIds() []*bc.Hash {
 	return nil
 }
 
+func (m *RawSnapshot) GetOutputNodes() [][]byte {
+	if m != nil {
+		return m.OutputNodes
+	}
+	return nil
+}
+
+func (m *RawSnapshot) GetAssetOutputNodes() [][]byte {
+	if m != nil {
+		return m.AssetOutputNodes
+	}
+	return nil
+}
+
+func (m *RawSnapshot) GetPubkeyOutputNodes() [][]byte {
+	if m != nil {
+		return m.PubkeyOutputNodes
+	}
+	return nil
+}
+
+// RawDelta represents the change made to the blockchain state by a
+// single block.
+type RawDelta struct {
+	Header        *bc.BlockHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	Contracts     *RawTreeDelta   `protobuf:"bytes,2,opt,name=contracts" json:"contracts,omitempty"`
+	Nonces        *RawTreeDelta   `protobuf:"bytes,3,opt,name=nonces" json:"nonces,omitempty"`
+	Outputs       *RawTreeDelta   `protobuf:"bytes,4,opt,name=outputs" json:"outputs,omitempty"`
+	AssetOutputs  *RawTreeDelta   `protobuf:"bytes,5,opt,name=asset_outputs,json=assetOutputs" json:"asset_outputs,omitempty"`
+	PubkeyOutputs *RawTreeDelta   `protobuf:"bytes,6,opt,name=pubkey_outputs,json=pubkeyOutputs" json:"pubkey_outputs,omitempty"`
+}
+
+func (m *RawDelta) Reset()                    { *m = RawDelta{} }
+func (m *RawDelta) String() string            { return proto.CompactTextString(m) }
+func (*RawDelta) ProtoMessage()               {}
+func (*RawDelta) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *RawDelta) GetHeader() *bc.BlockHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+func (m *RawDelta) GetContracts() *RawTreeDelta {
+	if m != nil {
+		return m.Contracts
+	}
+	return nil
+}
+
+func (m *RawDelta) GetNonces() *RawTreeDelta {
+	if m != nil {
+		return m.Nonces
+	}
+	return nil
+}
+
+func (m *RawDelta) GetOutputs() *RawTreeDelta {
+	if m != nil {
+		return m.Outputs
+	}
+	return nil
+}
+
+func (m *RawDelta) GetAssetOutputs() *RawTreeDelta {
+	if m != nil {
+		return m.AssetOutputs
+	}
+	return nil
+}
+
+func (m *RawDelta) GetPubkeyOutputs() *RawTreeDelta {
+	if m != nil {
+		return m.PubkeyOutputs
+	}
+	return nil
+}
+
+// RawTreeDelta contains the leaf nodes inserted into and deleted
+// from a tree.
+type RawTreeDelta struct {
+	Inserted [][]byte `protobuf:"bytes,1,rep,name=inserted,proto3" json:"inserted,omitempty"`
+	Deleted  [][]byte `protobuf:"bytes,2,rep,name=deleted,proto3" json:"deleted,omitempty"`
+}
+
+func (m *RawTreeDelta) Reset()                    { *m = RawTreeDelta{} }
+func (m *RawTreeDelta) String() string            { return proto.CompactTextString(m) }
+func (*RawTreeDelta) ProtoMessage()               {}
+func (*RawTreeDelta) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *RawTreeDelta) GetInserted() [][]byte {
+	if m != nil {
+		return m.Inserted
+	}
+	return nil
+}
+
+func (m *RawTreeDelta) GetDeleted() [][]byte {
+	if m != nil {
+		return m.Deleted
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*RawSnapshot)(nil), "chain.protocol.state.RawSnapshot")
+	proto.RegisterType((*RawDelta)(nil), "chain.protocol.state.RawDelta")
+	proto.RegisterType((*RawTreeDelta)(nil), "chain.protocol.state.RawTreeDelta")
 }
 
 func init() { proto.RegisterFile("rawsnapshot.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 237 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x54, 0x8f, 0xc1, 0x4a, 0xc4, 0x30,
-	0x10, 0x86, 0xa9, 0x75, 0xbb, 0x92, 0xea, 0xaa, 0xc1, 0x43, 0x11, 0xc1, 0x2a, 0x88, 0x7b, 0x4a,
-	0x75, 0x7d, 0x83, 0x3d, 0xed, 0x5e, 0x3c, 0xd4, 0x9b, 0x97, 0x32, 0x99, 0x64, 0x69, 0xb0, 0x64,
-	0x96, 0x24, 0xb0, 0x4f, 0xea, 0xfb, 0x48, 0xd3, 0xf4, 0xe0, 0x71, 0xbe, 0xff, 0xfb, 0x07, 0x7e,
-	0x76, 0xeb, 0xe0, 0xe4, 0x2d, 0x1c, 0x7d, 0x4f, 0x41, 0x1c, 0x1d, 0x05, 0xe2, 0x77, 0xd8, 0x83,
-	0xb1, 0xd3, 0x81, 0x34, 0x08, 0x1f, 0x20, 0xe8, 0xfb, 0x07, 0xf3, 0xfe, 0xe6, 0x84, 0xa1, 0x66,
-	0xe6, 0x8d, 0xc4, 0x46, 0xe2, 0xa4, 0x3d, 0xff, 0x66, 0xac, 0x6c, 0xe1, 0xf4, 0x95, 0x3e, 0xf1,
-	0x17, 0xb6, 0x42, 0xb2, 0xc1, 0x01, 0x86, 0xce, 0x92, 0xd2, 0xbe, 0xca, 0xea, 0x7c, 0x7d, 0xd9,
-	0x5e, 0xcd, 0xf4, 0x73, 0x84, 0xfc, 0x91, 0x95, 0x96, 0x2c, 0xea, 0xe4, 0x9c, 0x45, 0x87, 0x45,
-	0x34, 0x09, 0xaf, 0xac, 0xe8, 0x35, 0x28, 0xed, 0xaa, 0xbc, 0xce, 0xd6, 0xe5, 0xe6, 0x5a, 0x48,
-	0x14, 0xdb, 0x81, 0xf0, 0x67, 0x17, 0x71, 0x9b, 0x62, 0xbe, 0x61, 0x37, 0xc6, 0x9a, 0x60, 0x60,
-	0xe8, 0xe4, 0x18, 0x77, 0x46, 0x55, 0xe7, 0xb1, 0x72, 0x31, 0x56, 0x76, 0xe0, 0xfb, 0x76, 0x95,
-	0x8c, 0xd8, 0xdf, 0x2b, 0xfe, 0xc4, 0x96, 0x4e, 0x1f, 0x3a, 0xa3, 0x7c, 0xb5, 0xa8, 0xf3, 0x7f,
-	0x6a, 0xe1, 0xf4, 0x61, 0xaf, 0xfc, 0x76, 0xf9, 0xbd, 0x88, 0xf3, 0x65, 0x11, 0x77, 0x7e, 0xfc,
-	0x05, 0x00, 0x00, 0xff, 0xff, 0xf3, 0xf6, 0x71, 0x84, 0x30, 0x01, 0x00, 0x00,
+	// 412 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x92, 0xcf, 0x6b, 0x14, 0x31,
+	0x14, 0xc7, 0xd9, 0x4e, 0x3b, 0xb3, 0xbe, 0xfd, 0x61, 0x1b, 0x3d, 0x0c, 0x45, 0x70, 0xbb, 0x20,
+	0xf6, 0x20, 0x59, 0xad, 0x37, 0xf1, 0x20, 0xa5, 0x60, 0xf7, 0xa2, 0x30, 0x7a, 0xf2, 0x32, 0x64,
+	0x92, 0x57, 0x36, 0xec, 0x90, 0x2c, 0x49, 0x96, 0xc1, 0xb3, 0xff, 0xa3, 0x7f, 0x8f, 0x24, 0x99,
+	0xd1, 0x19, 0x90, 0x32, 0xc7, 0xf7, 0xbe, 0x9f, 0xef, 0x4b, 0xf2, 0x7d, 0x81, 0x0b, 0xc3, 0x1a,
+	0xab, 0xd8, 0xc1, 0xee, 0xb4, 0xa3, 0x07, 0xa3, 0x9d, 0x26, 0xcf, 0xf9, 0x8e, 0x49, 0x15, 0x0b,
+	0xae, 0x6b, 0x6a, 0x1d, 0x73, 0x78, 0xf9, 0x42, 0xbe, 0x7b, 0x6b, 0xa8, 0xd4, 0x9b, 0xae, 0xbf,
+	0xa9, 0xf8, 0xa6, 0xe2, 0x11, 0x5b, 0xff, 0x3e, 0x81, 0x59, 0xc1, 0x9a, 0x6f, 0xed, 0x24, 0xf2,
+	0x0a, 0x96, 0x5c, 0x2b, 0x67, 0x18, 0x77, 0xa5, 0xd2, 0x02, 0x6d, 0x3e, 0x59, 0x25, 0xd7, 0xf3,
+	0x62, 0xd1, 0x75, 0xbf, 0xf8, 0x26, 0x79, 0x09, 0x33, 0xa5, 0x15, 0xc7, 0x96, 0x39, 0x09, 0x0c,
+	0x84, 0x56, 0x04, 0x5e, 0x43, 0xba, 0x43, 0x26, 0xd0, 0xe4, 0xc9, 0x6a, 0x72, 0x3d, 0xbb, 0x79,
+	0x4a, 0x2b, 0x4e, 0x6f, 0x6b, 0xcd, 0xf7, 0xf7, 0xa1, 0x5d, 0xb4, 0x32, 0xb9, 0x81, 0x73, 0xa9,
+	0xa4, 0x93, 0xac, 0x2e, 0x2b, 0x2f, 0x97, 0x52, 0xe4, 0xa7, 0xc1, 0x32, 0xf5, 0x96, 0x7b, 0x66,
+	0x77, 0xc5, 0xb2, 0x25, 0x82, 0x7f, 0x2b, 0xc8, 0x15, 0x64, 0x06, 0x1f, 0x4a, 0x29, 0x6c, 0x7e,
+	0xb6, 0x4a, 0x06, 0x68, 0x6a, 0xf0, 0x61, 0x2b, 0x2c, 0xb9, 0x82, 0xb9, 0x3e, 0xba, 0xc3, 0xb1,
+	0x7b, 0x45, 0x1a, 0x6e, 0x38, 0x8b, 0xbd, 0x78, 0xc5, 0x37, 0x40, 0x98, 0xb5, 0xe8, 0xca, 0x01,
+	0x98, 0x05, 0xf0, 0x3c, 0x28, 0x5f, 0x7b, 0x34, 0x85, 0x67, 0x87, 0x63, 0xb5, 0xc7, 0x9f, 0x43,
+	0x7c, 0x1a, 0xf0, 0x8b, 0x28, 0xf5, 0xf8, 0xf5, 0xaf, 0x04, 0xa6, 0x05, 0x6b, 0xee, 0xb0, 0x76,
+	0xac, 0x97, 0xc6, 0xe4, 0xf1, 0x34, 0x3e, 0xc1, 0x93, 0x2e, 0x68, 0x9f, 0xaa, 0x67, 0xd7, 0xf4,
+	0x7f, 0x6b, 0xa5, 0x05, 0x6b, 0xbe, 0x1b, 0xc4, 0x30, 0xbf, 0xf8, 0x67, 0x22, 0x1f, 0x20, 0x0d,
+	0x6b, 0xb0, 0x79, 0x32, 0xda, 0xde, 0x3a, 0xc8, 0x47, 0xc8, 0xe2, 0xe3, 0x6c, 0x7e, 0x3a, 0xda,
+	0xdc, 0x59, 0xc8, 0x67, 0x58, 0xf4, 0xf3, 0xf4, 0xbb, 0x19, 0x3b, 0x63, 0xde, 0x8b, 0xdb, 0x92,
+	0x2d, 0x2c, 0x07, 0x51, 0xfb, 0xed, 0x8d, 0x9d, 0xb4, 0xe8, 0x6f, 0xc2, 0xae, 0xef, 0x60, 0xde,
+	0x97, 0xc9, 0x25, 0x4c, 0xa5, 0xb2, 0x68, 0x1c, 0x8a, 0xf6, 0x63, 0xff, 0xad, 0x49, 0x0e, 0x99,
+	0xc0, 0x1a, 0xbd, 0x14, 0xff, 0x73, 0x57, 0xde, 0x66, 0x3f, 0xce, 0xc2, 0x51, 0x55, 0x1a, 0x8e,
+	0x7e, 0xff, 0x67, 0x00, 0x86, 0x78, 0xab, 0xac, 0x7d, 0x03, 0x00, 0x00,
 }
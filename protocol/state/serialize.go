@@ -21,6 +21,19 @@ func (s *Snapshot) FromBytes(b []byte) error {
 	if err != nil {
 		return errors.Wrap(err, "reconstructing nonce tree")
 	}
+	s.setNonceExpiry(buildNonceExpiry(s.NonceTree))
+	s.OutputsTree, err = treeFromBytes(rs.OutputNodes)
+	if err != nil {
+		return errors.Wrap(err, "reconstructing outputs tree")
+	}
+	s.AssetOutputsTree, err = treeFromBytes(rs.AssetOutputNodes)
+	if err != nil {
+		return errors.Wrap(err, "reconstructing asset outputs tree")
+	}
+	s.PubkeyOutputsTree, err = treeFromBytes(rs.PubkeyOutputNodes)
+	if err != nil {
+		return errors.Wrap(err, "reconstructing pubkey outputs tree")
+	}
 	if rs.Header != nil {
 		s.Header = rs.Header
 	}
@@ -37,6 +50,10 @@ func (s *Snapshot) Bytes() ([]byte, error) {
 	rs := RawSnapshot{
 		ContractNodes: treeToBytes(s.ContractsTree),
 		NonceNodes:    treeToBytes(s.NonceTree),
+
+		OutputNodes:       treeToBytes(s.OutputsTree),
+		AssetOutputNodes:  treeToBytes(s.AssetOutputsTree),
+		PubkeyOutputNodes: treeToBytes(s.PubkeyOutputsTree),
 	}
 	if s.Header != nil {
 		rs.Header = s.Header
@@ -44,12 +61,20 @@ func (s *Snapshot) Bytes() ([]byte, error) {
 	if !s.InitialBlockID.IsZero() {
 		rs.InitialBlockId = &s.InitialBlockID
 	}
+	for i := range s.RefIDs {
+		rs.RefIds = append(rs.RefIds, &s.RefIDs[i])
+	}
 	b, err := proto.Marshal(&rs)
 	return b, errors.Wrap(err, "marshaling state snapshot")
 }
 
 func treeToBytes(tree *patricia.Tree) [][]byte {
 	var nodes [][]byte
+	if tree == nil {
+		// The output index trees are nil in snapshots made without
+		// Empty.
+		return nil
+	}
 	patricia.Walk(tree, func(item []byte) error {
 		nodes = append(nodes, item)
 		return nil
@@ -67,3 +92,41 @@ func treeFromBytes(keys [][]byte) (*patricia.Tree, error) {
 	}
 	return tree, nil
 }
+
+// FromBytes sets d from its serialized form, as produced by Bytes.
+func (d *Delta) FromBytes(b []byte) error {
+	var rd RawDelta
+	err := proto.Unmarshal(b, &rd)
+	if err != nil {
+		return errors.Wrap(err, "unmarshaling state delta proto")
+	}
+	d.Header = rd.Header
+	d.Contracts = treeDeltaFromRaw(rd.Contracts)
+	d.Nonces = treeDeltaFromRaw(rd.Nonces)
+	d.Outputs = treeDeltaFromRaw(rd.Outputs)
+	d.AssetOutputs = treeDeltaFromRaw(rd.AssetOutputs)
+	d.PubkeyOutputs = treeDeltaFromRaw(rd.PubkeyOutputs)
+	return nil
+}
+
+// Bytes returns the serialized form of d.
+func (d *Delta) Bytes() ([]byte, error) {
+	rd := RawDelta{
+		Header:        d.Header,
+		Contracts:     treeDeltaToRaw(d.Contracts),
+		Nonces:        treeDeltaToRaw(d.Nonces),
+		Outputs:       treeDeltaToRaw(d.Outputs),
+		AssetOutputs:  treeDeltaToRaw(d.AssetOutputs),
+		PubkeyOutputs: treeDeltaToRaw(d.PubkeyOutputs),
+	}
+	b, err := proto.Marshal(&rd)
+	return b, errors.Wrap(err, "marshaling state delta")
+}
+
+func treeDeltaToRaw(d TreeDelta) *RawTreeDelta {
+	return &RawTreeDelta{Inserted: d.Inserted, Deleted: d.Deleted}
+}
+
+func treeDeltaFromRaw(rd *RawTreeDelta) TreeDelta {
+	return TreeDelta{Inserted: rd.GetInserted(), Deleted: rd.GetDeleted()}
+}
@@ -7,6 +7,7 @@ package state
 import (
 	"encoding/binary"
 	"fmt"
+	"sync/atomic"
 
 	"github.com/chain/txvm/errors"
 	"github.com/chain/txvm/protocol/bc"
@@ -15,49 +16,138 @@ import (
 
 // Snapshot contains a blockchain's state.
 //
-// TODO: consider making type Snapshot truly immutable.  We already
-// handle it that way in many places (with explicit calls to Copy to
-// get the right behavior).  PruneNonces and the Apply functions would
-// have to produce new Snapshots rather than updating Snapshots in
-// place.
+// A Snapshot is immutable. PruneNonces and the Apply functions return
+// a new Snapshot, leaving the original unchanged; the two share the
+// parts of their trees that did not change. So it is safe to hand a
+// Snapshot to concurrent readers, and cheap to keep old ones.
+//
+// Code that builds a Snapshot by hand, setting its fields or
+// inserting into its trees directly, must do so before sharing it,
+// and should start from Empty or Copy.
 type Snapshot struct {
 	ContractsTree *patricia.Tree
 	NonceTree     *patricia.Tree
 
+	// OutputsTree, AssetOutputsTree, and PubkeyOutputsTree make up
+	// the output index, which holds the contents of the unspent
+	// outputs added by ApplyTx. See OutputSnapshot, OutputsByAsset,
+	// and OutputsByPubkey.
+	OutputsTree       *patricia.Tree
+	AssetOutputsTree  *patricia.Tree
+	PubkeyOutputsTree *patricia.Tree
+
 	Header         *bc.BlockHeader
 	InitialBlockID bc.Hash
-	RefIDs         []bc.Hash
-}
 
-// PruneNonces modifies a Snapshot, removing all nonce IDs with
-// expiration times earlier than the provided timestamp.
-func (s *Snapshot) PruneNonces(timestampMS uint64) {
-	newTree := new(patricia.Tree)
-	*newTree = *s.NonceTree
+	// RefIDs holds the IDs of the blocks applied so far. Snapshots
+	// made from one another by ApplyBlockHeader share the array
+	// behind it (see appendRefID), so it must not be modified in
+	// place.
+	RefIDs []bc.Hash
+
+	refIDsClaim *refIDsClaim
+
+	// nonceExpiry, if not nil, indexes NonceTree by expiration time
+	// (see expiry.go). It is valid only while NonceTree equals
+	// nonceExpiryOf.
+	nonceExpiry   *expiryIndex
+	nonceExpiryOf patricia.Tree
+}
 
-	patricia.Walk(s.NonceTree, func(item []byte) error {
-		_, t := idTime(item)
-		if timestampMS > t {
-			newTree.Delete(item)
+// PruneNonces returns a copy of s without the nonce IDs with
+// expiration times earlier than the provided timestamp. For large
+// nonce sets it takes time proportional to the number of nonces
+// pruned, using an expiry index; otherwise, and when the index has
+// been discarded, it walks the whole nonce tree.
+func (s *Snapshot) PruneNonces(timestampMS uint64) *Snapshot {
+	newTree := copyTree(s.NonceTree)
+
+	var index *expiryIndex
+	if old := s.validNonceExpiry(); old != nil {
+		ix := *old
+		index = &ix
+		patricia.Walk(&old.keys, func(k []byte) error {
+			nc, t := expiryNonce(k)
+			if timestampMS <= t {
+				return errStopWalk
+			}
+			newTree.Delete(nc)
+			index.remove(nc)
+			return nil
+		})
+		if index.n < nonceExpiryMin/2 {
+			index = nil
 		}
-		return nil
-	})
+	} else {
+		patricia.Walk(s.NonceTree, func(item []byte) error {
+			if _, t := idTime(item); timestampMS > t {
+				newTree.Delete(item)
+			}
+			return nil
+		})
+		index = buildNonceExpiry(newTree)
+	}
 
-	s.NonceTree = newTree
+	next := s.next()
+	next.NonceTree = newTree
+	next.setNonceExpiry(index)
+	return next
 }
 
-// Copy makes a copy of provided snapshot. Copying a snapshot is an
-// O(n) operation where n is the number of nonces in the snapshot's
-// nonce set.
+// next returns a shallow copy of s, to be updated by the caller with
+// new trees.
+func (s *Snapshot) next() *Snapshot {
+	next := *s
+	return &next
+}
+
+// A refIDsClaim is shared by the snapshots whose RefIDs are backed
+// by the same array. Its n is the length of the longest of them.
+type refIDsClaim struct {
+	base *bc.Hash // first element of the array
+	n    int64
+}
+
+// appendRefID returns s.RefIDs with id appended, and the claim for
+// the result. If no other snapshot has yet appended to s.RefIDs, and
+// its array has room, id is written into the array in place, so that
+// a chain of snapshots retained at many heights shares one copy of
+// their common block IDs. Otherwise the IDs are copied into a new,
+// larger array.
+func (s *Snapshot) appendRefID(id bc.Hash) ([]bc.Hash, *refIDsClaim) {
+	ids := s.RefIDs
+	n := len(ids)
+	c := s.refIDsClaim
+	if c != nil && n < cap(ids) && &ids[:cap(ids)][0] == c.base && atomic.CompareAndSwapInt64(&c.n, int64(n), int64(n+1)) {
+		ids = ids[:n+1]
+		ids[n] = id
+		return ids, c
+	}
+	ids = append(ids[:n:n], id)
+	return ids, &refIDsClaim{base: &ids[:cap(ids)][0], n: int64(n + 1)}
+}
+
+// Copy makes a copy of provided snapshot that does not share any
+// Tree values with it, for callers that want to modify the copy's
+// trees in place. Copying a snapshot takes time proportional to the
+// number of its RefIDs; the trees' nodes are shared.
 func Copy(original *Snapshot) *Snapshot {
 	c := &Snapshot{
-		ContractsTree:  new(patricia.Tree),
-		NonceTree:      new(patricia.Tree),
-		InitialBlockID: original.InitialBlockID,
-		RefIDs:         append([]bc.Hash{}, original.RefIDs...),
+		ContractsTree:     new(patricia.Tree),
+		NonceTree:         new(patricia.Tree),
+		OutputsTree:       copyTree(original.OutputsTree),
+		AssetOutputsTree:  copyTree(original.AssetOutputsTree),
+		PubkeyOutputsTree: copyTree(original.PubkeyOutputsTree),
+		InitialBlockID:    original.InitialBlockID,
+		RefIDs:            append([]bc.Hash{}, original.RefIDs...),
+
+		// The claim applies only to the array it names, so the copy
+		// can keep it and still never append in place.
+		refIDsClaim: original.refIDsClaim,
 	}
 	*c.ContractsTree = *original.ContractsTree
 	*c.NonceTree = *original.NonceTree
+	c.setNonceExpiry(original.validNonceExpiry())
 	if original.Header != nil {
 		c.Header = new(bc.BlockHeader)
 		*c.Header = *original.Header
@@ -68,51 +158,55 @@ func Copy(original *Snapshot) *Snapshot {
 // Empty returns an empty state snapshot.
 func Empty() *Snapshot {
 	return &Snapshot{
-		ContractsTree: new(patricia.Tree),
-		NonceTree:     new(patricia.Tree),
+		ContractsTree:     new(patricia.Tree),
+		NonceTree:         new(patricia.Tree),
+		OutputsTree:       new(patricia.Tree),
+		AssetOutputsTree:  new(patricia.Tree),
+		PubkeyOutputsTree: new(patricia.Tree),
 	}
 }
 
-// ApplyBlock updates s in place. It runs in three phases:
-// PruneNonces, ApplyBlockHeader, and ApplyTx
+// ApplyBlock returns the state after applying block to s. It runs in
+// three phases: PruneNonces, ApplyBlockHeader, and ApplyTx
 // (the latter called in a loop for each transaction). Callers
 // are free to invoke those phases separately.
-func (s *Snapshot) ApplyBlock(block *bc.UnsignedBlock) error {
-	s.PruneNonces(block.TimestampMs)
-
-	err := s.ApplyBlockHeader(block.BlockHeader)
+func (s *Snapshot) ApplyBlock(block *bc.UnsignedBlock) (*Snapshot, error) {
+	next, err := s.PruneNonces(block.TimestampMs).ApplyBlockHeader(block.BlockHeader)
 	if err != nil {
-		return errors.Wrap(err, "applying block header")
+		return nil, errors.Wrap(err, "applying block header")
 	}
 
-	for i, tx := range block.Transactions {
-		err = s.ApplyTx(bc.NewCommitmentsTx(tx))
+	// Computing the commitments is the expensive part, and does not
+	// depend on the state, so do it for all the transactions up front.
+	for i, ctx := range bc.NewCommitmentsTxs(block.Transactions) {
+		next, err = next.ApplyTx(ctx)
 		if err != nil {
-			return errors.Wrapf(err, "applying block transaction %d", i)
+			return nil, errors.Wrapf(err, "applying block transaction %d", i)
 		}
 	}
 
-	return nil
+	return next, nil
 }
 
 // ApplyBlockHeader is the header-specific phase of applying a block
 // to the blockchain state. (See ApplyBlock.)
-func (s *Snapshot) ApplyBlockHeader(bh *bc.BlockHeader) error {
+func (s *Snapshot) ApplyBlockHeader(bh *bc.BlockHeader) (*Snapshot, error) {
 	bHash := bh.Hash()
 
+	next := s.next()
 	if s.InitialBlockID.IsZero() {
 		if bh.Height != 1 {
-			return fmt.Errorf("cannot apply block with height %d to an empty state", bh.Height)
+			return nil, fmt.Errorf("cannot apply block with height %d to an empty state", bh.Height)
 		}
-		s.InitialBlockID = bHash
+		next.InitialBlockID = bHash
 	} else if bh.Height == 1 {
-		return fmt.Errorf("cannot apply block with height = 1 to an initialized state")
+		return nil, fmt.Errorf("cannot apply block with height = 1 to an initialized state")
 	}
 
-	s.Header = bh
-	s.RefIDs = append(s.RefIDs, bHash)
+	next.Header = bh
+	next.RefIDs, next.refIDsClaim = s.appendRefID(bHash)
 
-	return nil
+	return next, nil
 }
 
 var (
@@ -132,25 +226,29 @@ var (
 	ErrPrevout = errors.New("invalid prevout")
 )
 
-// ApplyTx updates s in place.
-func (s *Snapshot) ApplyTx(p *bc.CommitmentsTx) error {
+// ApplyTx returns the state after applying p to s.
+func (s *Snapshot) ApplyTx(p *bc.CommitmentsTx) (*Snapshot, error) {
 	if s.InitialBlockID.IsZero() {
-		return ErrEmptyState
+		return nil, ErrEmptyState
 	}
 
 	if !p.Tx.Finalized {
-		return ErrUnfinalized
+		return nil, ErrUnfinalized
 	}
 
-	nonceTree := new(patricia.Tree)
-	*nonceTree = *s.NonceTree
+	nonceTree := copyTree(s.NonceTree)
+	expiryIndex := s.validNonceExpiry()
+	if expiryIndex != nil {
+		ix := *expiryIndex
+		expiryIndex = &ix
+	}
 
 	for _, n := range p.Tx.Nonces {
 		// Add new nonces. They must not conflict with nonces already
 		// present.
 		nc, _ := p.NonceCommitments[n.ID]
 		if nonceTree.Contains(nc) {
-			return errors.Wrapf(ErrConflictingNonce, "nonce %x", n.ID.Bytes())
+			return nil, errors.Wrapf(ErrConflictingNonce, "nonce %x", n.ID.Bytes())
 		}
 
 		if n.BlockID.IsZero() || n.BlockID == s.InitialBlockID {
@@ -164,36 +262,63 @@ func (s *Snapshot) ApplyTx(p *bc.CommitmentsTx) error {
 				}
 			}
 			if !found {
-				return ErrNonceReference
+				return nil, ErrNonceReference
 			}
 		}
 		nonceTree.Insert(nc)
+		if expiryIndex != nil && !expiryIndex.add(nc) {
+			expiryIndex = nil
+		}
 	}
 
-	conTree := new(patricia.Tree)
-	*conTree = *s.ContractsTree
+	conTree := copyTree(s.ContractsTree)
+
+	var (
+		outputsTree       = copyTree(s.OutputsTree)
+		assetOutputsTree  = copyTree(s.AssetOutputsTree)
+		pubkeyOutputsTree = copyTree(s.PubkeyOutputsTree)
+		inputIdx          int
+		outputIdx         int
+	)
 
-	// Add or remove contracts, depending on if it is an input or output
+	// Add or remove contracts, depending on if it is an input or output.
+	// Tx.Inputs and Tx.Outputs are in the same order as Tx.Contracts.
 	for _, con := range p.Tx.Contracts {
 		switch con.Type {
 		case bc.InputType:
 			if !conTree.Contains(con.ID.Bytes()) {
-				return errors.Wrapf(ErrPrevout, "ID %x", con.ID.Bytes())
+				return nil, errors.Wrapf(ErrPrevout, "ID %x", con.ID.Bytes())
 			}
 			conTree.Delete(con.ID.Bytes())
+			if inputIdx < len(p.Tx.Inputs) {
+				unindexOutput(outputsTree, assetOutputsTree, pubkeyOutputsTree, &p.Tx.Inputs[inputIdx])
+			}
+			inputIdx++
 
 		case bc.OutputType:
 			err := conTree.Insert(con.ID.Bytes())
 			if err != nil {
-				return errors.Wrapf(err, "inserting output %x", con.ID.Bytes())
+				return nil, errors.Wrapf(err, "inserting output %x", con.ID.Bytes())
+			}
+			if outputIdx < len(p.Tx.Outputs) {
+				err = indexOutput(outputsTree, assetOutputsTree, pubkeyOutputsTree, &p.Tx.Outputs[outputIdx])
+				if err != nil {
+					return nil, errors.Wrapf(err, "output %x", con.ID.Bytes())
+				}
 			}
+			outputIdx++
 		}
 	}
 
-	s.NonceTree = nonceTree
-	s.ContractsTree = conTree
+	next := s.next()
+	next.NonceTree = nonceTree
+	next.setNonceExpiry(expiryIndex)
+	next.ContractsTree = conTree
+	next.OutputsTree = outputsTree
+	next.AssetOutputsTree = assetOutputsTree
+	next.PubkeyOutputsTree = pubkeyOutputsTree
 
-	return nil
+	return next, nil
 }
 
 // Height returns the height from the stored latest header.
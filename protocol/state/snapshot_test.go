@@ -9,7 +9,6 @@ import (
 )
 
 func empty(t *testing.T) *Snapshot {
-	s := Empty()
 	b1 := &bc.UnsignedBlock{
 		BlockHeader: &bc.BlockHeader{
 			Version:       3,
@@ -18,7 +17,7 @@ func empty(t *testing.T) *Snapshot {
 			NextPredicate: &bc.Predicate{},
 		},
 	}
-	err := s.ApplyBlock(b1)
+	s, err := Empty().ApplyBlock(b1)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -36,14 +35,14 @@ func TestApplyTxSpend(t *testing.T) {
 	}
 
 	// Apply the spend transaction.
-	err := snap.ApplyTx(bc.NewCommitmentsTx(tx))
+	snap, err := snap.ApplyTx(bc.NewCommitmentsTx(tx))
 	if err != nil {
 		t.Fatal(err)
 	}
 	if snap.ContractsTree.Contains(spentOutputID.Bytes()) {
 		t.Error("snapshot contains spent prevout")
 	}
-	err = snap.ApplyTx(bc.NewCommitmentsTx(tx))
+	_, err = snap.ApplyTx(bc.NewCommitmentsTx(tx))
 	if err == nil {
 		t.Error("expected error applying spend twice, got nil")
 	}
@@ -55,11 +54,11 @@ func TestApplyIssuanceTwice(t *testing.T) {
 		Nonces:    []bc.Nonce{{ID: bc.NewHash([32]byte{2}), ExpMS: 5}},
 		Finalized: true,
 	}
-	err := snap.ApplyTx(bc.NewCommitmentsTx(issuance))
+	snap, err := snap.ApplyTx(bc.NewCommitmentsTx(issuance))
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = snap.ApplyTx(bc.NewCommitmentsTx(issuance))
+	_, err = snap.ApplyTx(bc.NewCommitmentsTx(issuance))
 	if err == nil {
 		t.Errorf("expected error for duplicate nonce, got %s", err)
 	}
@@ -70,8 +69,12 @@ func TestCopySnapshot(t *testing.T) {
 	tx := &bc.Tx{
 		Contracts: []bc.Contract{{Type: bc.OutputType, ID: bc.NewHash([32]byte{1})}},
 		Nonces:    []bc.Nonce{{ID: bc.NewHash([32]byte{2}), ExpMS: 5}},
+		Finalized: true,
+	}
+	snap, err := snap.ApplyTx(bc.NewCommitmentsTx(tx))
+	if err != nil {
+		t.Fatal(err)
 	}
-	snap.ApplyTx(bc.NewCommitmentsTx(tx))
 	dupe := Copy(snap)
 	if !reflect.DeepEqual(dupe, snap) {
 		t.Errorf("got %#v, want %#v", dupe, snap)
@@ -92,7 +95,7 @@ func TestApplyBlock(t *testing.T) {
 			NextPredicate: &bc.Predicate{},
 		},
 	}
-	err := snap.ApplyBlock(block)
+	snap, err := snap.ApplyBlock(block)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -101,7 +104,7 @@ func TestApplyBlock(t *testing.T) {
 	}
 
 	snap = Empty()
-	err = snap.ApplyBlock(block)
+	_, err = snap.ApplyBlock(block)
 	if err == nil {
 		t.Error("expected error for uninitialized state")
 	}
@@ -113,7 +116,7 @@ func TestApplyBlock(t *testing.T) {
 			NextPredicate: &bc.Predicate{},
 		},
 	}
-	err = snap.ApplyBlock(block)
+	_, err = snap.ApplyBlock(block)
 	if err == nil {
 		t.Error("expected error for initialized state")
 	}
@@ -131,7 +134,7 @@ func TestApplyBlock(t *testing.T) {
 			}},
 		}},
 	}
-	err = snap.ApplyBlock(block)
+	_, err = snap.ApplyBlock(block)
 	if err == nil {
 		t.Error("expected error for transaction")
 	}
@@ -141,19 +144,19 @@ func TestApplyTx(t *testing.T) {
 	tx := &bc.Tx{}
 	snap := Empty()
 
-	err := snap.ApplyTx(bc.NewCommitmentsTx(tx))
+	_, err := snap.ApplyTx(bc.NewCommitmentsTx(tx))
 	if errors.Root(err) != ErrEmptyState {
 		t.Errorf("got %v, want %s", err, ErrEmptyState)
 	}
 
 	snap = empty(t)
-	err = snap.ApplyTx(bc.NewCommitmentsTx(tx))
+	_, err = snap.ApplyTx(bc.NewCommitmentsTx(tx))
 	if errors.Root(err) != ErrUnfinalized {
 		t.Errorf("got %v, want %s", err, ErrUnfinalized)
 	}
 
 	tx.Finalized = true // lies
-	err = snap.ApplyTx(bc.NewCommitmentsTx(tx))
+	_, err = snap.ApplyTx(bc.NewCommitmentsTx(tx))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -167,7 +170,7 @@ func TestRefIDNonce(t *testing.T) {
 			NextPredicate: &bc.Predicate{},
 		},
 	}
-	err := snap.ApplyBlock(b1)
+	snap, err := snap.ApplyBlock(b1)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -179,7 +182,7 @@ func TestRefIDNonce(t *testing.T) {
 		}},
 		Finalized: true,
 	}
-	err = snap.ApplyTx(bc.NewCommitmentsTx(tx))
+	snap, err = snap.ApplyTx(bc.NewCommitmentsTx(tx))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -192,7 +195,7 @@ func TestRefIDNonce(t *testing.T) {
 		}},
 		Finalized: true,
 	}
-	err = snap.ApplyTx(bc.NewCommitmentsTx(tx))
+	_, err = snap.ApplyTx(bc.NewCommitmentsTx(tx))
 	if err == nil {
 		t.Error("expected error for applying tx with invalid block id")
 	}
@@ -218,7 +221,7 @@ func TestAtomicApplyTx(t *testing.T) {
 	wantCSRoot := snap.ContractsTree.RootHash()
 	wantNonceRoot := snap.NonceTree.RootHash()
 
-	err := snap.ApplyTx(bc.NewCommitmentsTx(missingSpend))
+	_, err := snap.ApplyTx(bc.NewCommitmentsTx(missingSpend))
 	if err == nil {
 		t.Fatal("expected err")
 	}
@@ -235,6 +238,67 @@ func TestAtomicApplyTx(t *testing.T) {
 	}
 }
 
+func TestSnapshotImmutable(t *testing.T) {
+	base := Copy(empty(t))
+	spent := bc.NewHash([32]byte{1})
+	base.ContractsTree.Insert(spent.Bytes())
+	for h := uint64(2); h <= 3; h++ {
+		var err error
+		base, err = base.ApplyBlock(&bc.UnsignedBlock{
+			BlockHeader: &bc.BlockHeader{Height: h, TimestampMs: h, NextPredicate: &bc.Predicate{}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := base.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := &bc.Tx{
+		Contracts: []bc.Contract{{Type: bc.InputType, ID: spent}, {Type: bc.OutputType, ID: bc.NewHash([32]byte{2})}},
+		Nonces:    []bc.Nonce{{ID: bc.NewHash([32]byte{3}), ExpMS: 100}},
+		Finalized: true,
+	}
+	spend, err := base.ApplyTx(bc.NewCommitmentsTx(tx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spend.ContractsTree.Contains(spent.Bytes()) {
+		t.Error("new snapshot contains spent contract")
+	}
+	if !base.ContractsTree.Contains(spent.Bytes()) {
+		t.Error("old snapshot lost spent contract")
+	}
+
+	// Two different blocks at the same height, applied to the same
+	// snapshot, must not interfere with each other or with it.
+	var children []*Snapshot
+	for ts := uint64(10); ts <= 11; ts++ {
+		child, err := base.ApplyBlock(&bc.UnsignedBlock{
+			BlockHeader: &bc.BlockHeader{Height: 4, TimestampMs: ts, NextPredicate: &bc.Predicate{}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		children = append(children, child)
+	}
+	for i, child := range children {
+		if got := child.RefIDs[len(child.RefIDs)-1]; got != child.Header.Hash() {
+			t.Errorf("child %d has last RefID %x, want its own header %x", i, got.Bytes(), child.Header.Hash().Bytes())
+		}
+	}
+
+	got, err := base.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("applying a tx and blocks changed the original snapshot")
+	}
+}
+
 func TestHeaderAccessors(t *testing.T) {
 	cases := []struct {
 		snap          *Snapshot
@@ -25,7 +25,7 @@ var assetSrcFmt = map[int]string{
                   # []                                                      [refdata pubkeys quorum tag amount (zeroval 0)|(blockid maxms)]
 get               # [(0|maxms)]                                             [refdata pubkeys quorum tag amount (zeroval|blockid)]
 dup not           # [(0|maxms) ((0|maxms)==0)]                              [refdata pubkeys quorum tag amount (zeroval|blockid)]
-jumpif:$havezero  # [maxms]                                                 [refdata pubkeys quorum tag amount blockid minms]
+jumpif:$havezero  # [maxms]                                                 [refdata pubkeys quorum tag amount blockid]
     get           # [maxms blockid]                                         [refdata pubkeys quorum tag amount]
     swap          # [blockid maxms]                                         [refdata pubkeys quorum tag amount]
     nonce         # [zeroval]                                               [refdata pubkeys quorum tag amount]                                   [{"N", <caller>, <cseed>, bid, exp} {"R", minms, maxms}]
@@ -38,9 +38,9 @@ get               # [zeroval amount tag]                                    [ref
 get               # [zeroval amount tag quorum]                             [refdata pubkeys]                                                     [({"N", ...} {"R", ...})]
 dup 4 bury        # [quorum zeroval amount tag quorum]                      [refdata pubkeys]                                                     [({"N", ...} {"R", ...})]
 get               # [quorum zeroval amount tag quorum pubkeys]              [refdata]                                                             [({"N", ...} {"R", ...})]
-dup 5 bury        # [quorum pubkeys zeroval amount tag quorum pubkeys]      []                                                                    [({"N", ...} {"R", ...})]
-3 tuple           # [quorum pubkeys zeroval amount {tag, quorum, pubkeys}]  []                                                                    [({"N", ...} {"R", ...})]
-encode            # [quorum pubkeys zeroval amount tag']                    []                                                                    [({"N", ...} {"R", ...})]
+dup 5 bury        # [quorum pubkeys zeroval amount tag quorum pubkeys]      [refdata]                                                             [({"N", ...} {"R", ...})]
+3 tuple           # [quorum pubkeys zeroval amount {tag, quorum, pubkeys}]  [refdata]                                                             [({"N", ...} {"R", ...})]
+encode            # [quorum pubkeys zeroval amount tag']                    [refdata]                                                             [({"N", ...} {"R", ...})]
 issue             # [quorum pubkeys issuedval]                              [refdata]                                                             [({"N", ...} {"R", ...}) {"A", <caller>, amount, assetID, zeroval.anchor}]
 get log           # [quorum pubkeys issuedval]                              []                                                                    [({"N", ...} {"R", ...}) {"A", ...} {"L", <cseed>, refdata}]
 anchor            # [quorum pubkeys issuedval anchor]                       []                                                                    [({"N", ...} {"R", ...}) {"A", ...} {"L", <cseed>, refdata}]
@@ -71,9 +71,9 @@ get               # [zeroval amount tag]                                    [ref
 get               # [zeroval amount tag quorum]                             [refdata pubkeys]                                                     [({"N", ...} {"R", ...})]
 dup 4 bury        # [quorum zeroval amount tag quorum]                      [refdata pubkeys]                                                     [({"N", ...} {"R", ...})]
 get               # [quorum zeroval amount tag quorum pubkeys]              [refdata]                                                             [({"N", ...} {"R", ...})]
-dup 5 bury        # [quorum pubkeys zeroval amount tag quorum pubkeys]      []                                                                    [({"N", ...} {"R", ...})]
-3 tuple           # [quorum pubkeys zeroval amount {tag, quorum, pubkeys}]  []                                                                    [({"N", ...} {"R", ...})]
-encode            # [quorum pubkeys zeroval amount tag']                    []                                                                    [({"N", ...} {"R", ...})]
+dup 5 bury        # [quorum pubkeys zeroval amount tag quorum pubkeys]      [refdata]                                                             [({"N", ...} {"R", ...})]
+3 tuple           # [quorum pubkeys zeroval amount {tag, quorum, pubkeys}]  [refdata]                                                             [({"N", ...} {"R", ...})]
+encode            # [quorum pubkeys zeroval amount tag']                    [refdata]                                                             [({"N", ...} {"R", ...})]
 issue             # [quorum pubkeys issuedval]                              [refdata]                                                             [({"N", ...} {"R", ...}) {"A", <caller>, amount, assetID, zeroval.anchor}]
 get log           # [quorum pubkeys issuedval]                              []                                                                    [({"N", ...} {"R", ...}) {"A", ...} {"L", <cseed>, refdata}]
 anchor            # [quorum pubkeys issuedval anchor]                       []                                                                    [({"N", ...} {"R", ...}) {"A", ...} {"L", <cseed>, refdata}]
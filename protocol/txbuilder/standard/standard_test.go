@@ -3,10 +3,14 @@ package standard
 import (
 	"bytes"
 	"encoding/hex"
+	"strings"
 	"testing"
 
 	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/errors"
 	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/txvm/analyzer"
+	"github.com/chain/txvm/protocol/txvm/asm"
 	"github.com/chain/txvm/protocol/txvm/txvmutil"
 	"github.com/chain/txvm/testutil"
 )
@@ -132,6 +136,59 @@ func TestProgCreation(t *testing.T) {
 	}
 }
 
+// TestDiagrams checks the stack diagrams in the comments of the
+// standard contracts against what the contracts do.
+func TestDiagrams(t *testing.T) {
+	srcs := map[string]string{
+		"pay to multisig 1": payToMultisigProgSrc1,
+		"pay to multisig 2": payToMultisigProgSrc2,
+		"asset 1":           assetSrc[1],
+		"asset 2":           assetSrc[2],
+		"retire":            retireSrc,
+	}
+	for name, src := range srcs {
+		m, err := asm.AssembleWithSourceMap(src)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if len(m.Diagrams) == 0 {
+			t.Errorf("%s: no diagrams found", name)
+		}
+		r := analyzer.AnalyzeContract(m.Prog, analyzer.Diagrams(m))
+		for _, p := range r.Problems {
+			t.Errorf("%s: %s", name, p)
+		}
+	}
+}
+
+// TestDiagramsArgs checks that the analyzer catches argument
+// columns in the diagrams of a standard contract that have been
+// rewritten to show the wrong number of items.
+func TestDiagramsArgs(t *testing.T) {
+	srcs := map[string]string{
+		"refdata dropped": strings.NewReplacer("[refdata pubkeys", "[pubkeys", "[refdata]", "[]").Replace(assetSrc[2]),
+		"extra item":      strings.Replace(assetSrc[2], "[issuedval]", "[x issuedval]", -1),
+	}
+	for name, src := range srcs {
+		if src == assetSrc[2] {
+			t.Fatalf("%s: source not rewritten", name)
+		}
+		m, err := asm.AssembleWithSourceMap(src)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		r := analyzer.AnalyzeContract(m.Prog, analyzer.Diagrams(m))
+		if len(r.Problems) == 0 {
+			t.Errorf("%s: got no problems", name)
+		}
+		for _, p := range r.Problems {
+			if errors.Root(p.Err) != analyzer.ErrDiagram {
+				t.Errorf("%s: got problem %s, want only %s", name, p, analyzer.ErrDiagram)
+			}
+		}
+	}
+}
+
 func mustDecodeHex(s string) [32]byte {
 	var result [32]byte
 	_, err := hex.Decode(result[:], []byte(s))
@@ -404,7 +404,7 @@ var (
 type materialization struct {
 	tx       *bc.Tx
 	resumer  func([]byte) error
-	runlimit int64
+	estimate txvm.RunlimitEstimate
 	stack    []stackItem // stack at op.Finalize
 	done     bool
 }
@@ -593,7 +593,7 @@ func (tpl *Template) materializeTx() (*materialization, error) {
 	}
 
 	// Run the finalized but not-yet-signed tx to get the txid
-	tx, err := bc.NewTx(b.Build(), 3, math.MaxInt64, txvm.Resumer(&m.resumer), txvm.GetRunlimit(&m.runlimit))
+	tx, err := bc.NewTx(b.Build(), 3, math.MaxInt64, txvm.Resumer(&m.resumer), txvm.GetRunlimitEstimate(&m.estimate))
 	if err != nil {
 		return nil, errors.Wrap(err, "computing transaction ID")
 	}
@@ -653,7 +653,14 @@ func (tpl *Template) Tx() (tx *bc.Tx, err error) {
 		return m.tx, err
 	}
 	m.tx.Program = append(m.tx.Program, b.Build()...)
-	m.tx.Runlimit = math.MaxInt64 - m.runlimit
+
+	// Set the runlimit to exactly what the transaction needs. (The
+	// estimate accounts only for the length of the program before
+	// the signatures.)
+	m.tx.Runlimit = m.estimate.Runlimit
+	if n := int64(len(m.tx.Program)); n > m.tx.Runlimit {
+		m.tx.Runlimit = n
+	}
 	m.done = true
 	return m.tx, nil
 }
@@ -440,9 +440,19 @@ func TestMultisig(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, err = tpl.Tx()
+	tx, err := tpl.Tx()
 	if err != nil {
-		t.Errorf("got error %s with 2 signatures for 2-of-3 issuance, want no error", err)
+		t.Fatalf("got error %s with 2 signatures for 2-of-3 issuance, want no error", err)
+	}
+
+	// The runlimit is exactly what the transaction needs.
+	_, err = txvm.Validate(tx.Program, tx.Version, tx.Runlimit)
+	if err != nil {
+		t.Errorf("validating with runlimit %d: %s", tx.Runlimit, err)
+	}
+	_, err = txvm.Validate(tx.Program, tx.Version, tx.Runlimit-1)
+	if errors.Root(err) != txvm.ErrRunlimit {
+		t.Errorf("validating with runlimit %d: got error %v, want ErrRunlimit", tx.Runlimit-1, err)
 	}
 }
 
@@ -0,0 +1,217 @@
+/*
+Package analyzer statically checks txvm programs for stack errors.
+
+The analyzer walks a program symbolically, following every path
+through it, and tracks the contract stack and the argument stack as
+sequences of items of known type (Int, Bytes, Tuple, Value,
+Contract, or WrappedContract, or a combination when the type is
+not determined). Where an item's value is determined by the program
+itself — a small integer, the data of a pushdata instruction, or
+simple arithmetic on those — it is tracked too. This lets the
+analyzer resolve the operands of roll, bury, peek, tuple, and
+jumpif, and follow quoted programs into exec and call.
+
+It reports stack underflows, items of the wrong type, and items
+left on the stacks at the end of a transaction or contract: errors
+that txvm.Validate would otherwise detect only when the program
+runs.
+
+The analysis is conservative in one direction only. A conditional
+jump whose condition is not a constant is assumed to be able to go
+either way, so a problem may be reported on a path that cannot
+actually be taken. On the other hand, when the analyzer cannot
+determine the stacks — for instance after roll with a computed
+operand, or after calling a contract whose program is not known —
+it stops checking what it cannot see, and records a Note saying so.
+
+Quoted programs passed to contract, output, yield, and wrap are
+analyzed too, as contract programs in their own right.
+*/
+package analyzer
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/txvm/asm"
+)
+
+// Errors reported in Problems.
+var (
+	ErrUnderflow = errors.New("stack underflow")
+	ErrType      = errors.New("wrong item type")
+	ErrResidue   = errors.New("residue on stack at end of transaction")
+	ErrNonEmpty  = errors.New("contract ends with non-empty stack")
+	ErrJump      = errors.New("jump out of range")
+	ErrOpcode    = errors.New("invalid instruction")
+	ErrFail      = errors.New("instruction always fails")
+	ErrDiagram   = errors.New("stack diagram disagrees with program")
+)
+
+// Type is a set of possible types for a stack item.
+type Type uint8
+
+// The types of stack items.
+const (
+	Int Type = 1 << iota
+	Bytes
+	Tuple
+	Value
+	Contract
+	WrappedContract
+
+	// Data is any plain-data item.
+	Data = Int | Bytes | Tuple
+
+	// Any is any item at all.
+	Any = Data | Value | Contract | WrappedContract
+)
+
+var typeNames = []string{"Int", "Bytes", "Tuple", "Value", "Contract", "WrappedContract"}
+
+func (t Type) String() string {
+	switch t {
+	case Data:
+		return "Data"
+	case Any:
+		return "Item"
+	}
+	var names []string
+	for i, name := range typeNames {
+		if t&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// Problem is an error found by the analyzer, or (in Report.Notes) a
+// place where it lost track of the stacks.
+type Problem struct {
+	// Prog is the program containing the instruction: either the
+	// program being analyzed or a program quoted in it.
+	Prog []byte
+
+	// PC is the position of the instruction in Prog.
+	PC int64
+
+	// Err describes the problem. For errors, its root is one of the
+	// Err values in this package.
+	Err error
+
+	// Diagram is the stack diagram that disagrees with the program,
+	// for an ErrDiagram problem.
+	Diagram *asm.StackDiagram
+}
+
+func (p *Problem) Error() string {
+	return fmt.Sprintf("pc %d: %s", p.PC, p.Err)
+}
+
+// Effect describes what a program does to the stacks.
+type Effect struct {
+	// StackIn and ArgsIn are the inferred types of the items a
+	// contract program takes from its initial contract and argument
+	// stacks, top first. They are empty for a transaction program,
+	// whose stacks start empty.
+	StackIn, ArgsIn []Type
+
+	// StackOut and ArgsOut are the types of the items the program
+	// leaves on the stacks (above any initial items it does not
+	// reach), bottom first.
+	StackOut, ArgsOut []Type
+
+	// OutKnown tells whether StackOut and ArgsOut are set. They are
+	// only if every path through the program leaves the same number
+	// of items on each stack, and the analyzer did not lose track of
+	// the stacks on any of them.
+	OutKnown bool
+}
+
+// Report is the result of analyzing a program.
+type Report struct {
+	// Problems are the errors found, ordered by program and pc.
+	Problems []*Problem
+
+	// Notes are the places where the analyzer lost track of the
+	// stacks and stopped checking some or all of the program paths
+	// through them.
+	Notes []*Problem
+
+	// Effect is the inferred effect of the program.
+	Effect Effect
+}
+
+// Option is an option for AnalyzeTx or AnalyzeContract.
+type Option struct {
+	apply func(*config)
+}
+
+type config struct {
+	diagrams map[diagramKey][]*asm.StackDiagram
+}
+
+// AnalyzeTx analyzes prog as a transaction program, which starts
+// with empty stacks and must leave them empty.
+func AnalyzeTx(prog []byte, opts ...Option) *Report {
+	return analyze(prog, closed, closed, opts)
+}
+
+// AnalyzeContract analyzes prog as a contract program that starts with
+// unknown items on its contract stack and on the argument stack, as
+// when it is the program saved by output, yield, or wrap. Unless it
+// ends with one of those instructions, it must leave its contract
+// stack empty.
+func AnalyzeContract(prog []byte, opts ...Option) *Report {
+	return analyze(prog, inputs, inputs, opts)
+}
+
+func analyze(prog []byte, stackBase, argsBase baseKind, opts []Option) *Report {
+	cfg := new(config)
+	for _, o := range opts {
+		o.apply(cfg)
+	}
+	r := new(Report)
+	done := map[string]bool{string(prog): true}
+	found := make(map[string]bool)
+	a := newAnalysis(r, cfg, found, prog, stackBase, argsBase)
+	a.run()
+	r.Effect = a.effect()
+
+	// Analyze the quoted programs found along the way, and the ones
+	// quoted in those.
+	for len(a.quoted) > 0 {
+		q := a.quoted[0]
+		a.quoted = a.quoted[1:]
+		if done[string(q.prog)] {
+			continue
+		}
+		done[string(q.prog)] = true
+		sub := newAnalysis(r, cfg, found, q.prog, q.stackBase, inputs)
+		sub.run()
+		a.quoted = append(a.quoted, sub.quoted...)
+	}
+
+	sortProblems(r.Problems)
+	sortProblems(r.Notes)
+	return r
+}
+
+func sortProblems(ps []*Problem) {
+	sort.SliceStable(ps, func(i, j int) bool {
+		if c := bytes.Compare(ps[i].Prog, ps[j].Prog); c != 0 {
+			// Longer programs (which contain the shorter ones) first.
+			if len(ps[i].Prog) != len(ps[j].Prog) {
+				return len(ps[i].Prog) > len(ps[j].Prog)
+			}
+			return c < 0
+		}
+		return ps[i].PC < ps[j].PC
+	})
+}
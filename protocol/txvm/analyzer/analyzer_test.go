@@ -0,0 +1,263 @@
+package analyzer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/txbuilder/standard"
+	"github.com/chain/txvm/protocol/txvm/asm"
+)
+
+func TestAnalyzeTx(t *testing.T) {
+	cases := []struct {
+		src  string
+		want []error // roots of the problems, in order
+		pc   int64   // pc of the first problem
+	}{
+		{src: "1 2 add verify"},
+		{src: "1 2 add", want: []error{ErrResidue}, pc: 3},
+		{src: "add", want: []error{ErrUnderflow}},
+		{src: "get", want: []error{ErrUnderflow}},
+		{src: "'abc' 2 add verify", want: []error{ErrType}, pc: 5},
+		{src: "'abc' 1 put get 2 roll drop drop", want: []error{ErrUnderflow}, pc: 8},
+		{src: "'abc' 1 put get 1 roll drop drop"},
+		{src: "0 verify", want: []error{ErrFail}, pc: 1},
+		{src: "jump:$x 'a' $x"},
+		{src: "{1, 'a', {2}} untuple drop drop drop drop"},
+		{src: "{1, 'a'} 0 field 2 add verify"},
+		{src: "{'a', 1} 0 field 2 add verify", want: []error{ErrType}, pc: 8},
+		{src: "[1 2 add] exec verify"},
+		{src: "[1 'a' add] exec verify", want: []error{ErrType}, pc: 3},
+		{src: "[get verify] contract 1 put call"},
+		{src: "[get verify] contract call", want: []error{ErrUnderflow}},
+		{src: "[1] contract call", want: []error{ErrNonEmpty}, pc: 1},
+		{src: "[2 put 3 put [get get add verify] yield] contract call get call"},
+		{src: "[1 [drop] output] contract call"},
+		{src: "prv", want: []error{ErrFail}},
+		{src: "3 1 jumpif", want: []error{ErrJump}, pc: 2},
+		{src: "1 2 3 reverse", want: []error{ErrUnderflow}, pc: 3},
+	}
+	for _, c := range cases {
+		prog, err := asm.Assemble(c.src)
+		if err != nil {
+			t.Fatalf("%s: %s", c.src, err)
+		}
+		r := AnalyzeTx(prog)
+		var got []error
+		for _, p := range r.Problems {
+			got = append(got, errors.Root(p.Err))
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got problems %v, want %v", c.src, r.Problems, c.want)
+			continue
+		}
+		if len(got) > 0 && r.Problems[0].PC != c.pc {
+			t.Errorf("%s: got first problem at pc %d, want %d", c.src, r.Problems[0].PC, c.pc)
+		}
+		if len(r.Notes) > 0 {
+			t.Errorf("%s: got notes %v", c.src, r.Notes)
+		}
+	}
+}
+
+func TestQuoted(t *testing.T) {
+	// The quoted program, saved by output, is analyzed as a contract
+	// on its own, even though it never runs here.
+	prog, err := asm.Assemble("[[1 2] output] contract call")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := AnalyzeTx(prog)
+	if len(r.Problems) != 1 || errors.Root(r.Problems[0].Err) != ErrNonEmpty {
+		t.Fatalf("got problems %v, want one ErrNonEmpty", r.Problems)
+	}
+	if p := r.Problems[0]; len(p.Prog) != 2 || p.PC != 2 {
+		t.Errorf("got problem at %x pc %d, want end of [1 2]", p.Prog, p.PC)
+	}
+}
+
+func TestBranches(t *testing.T) {
+	// The condition comes from the argument stack, so both paths are
+	// followed, and one of them leaves residue.
+	prog, err := asm.Assemble("get jumpif:$x 1 $x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := AnalyzeContract(prog)
+	if len(r.Problems) != 1 || errors.Root(r.Problems[0].Err) != ErrNonEmpty {
+		t.Errorf("got problems %v, want one ErrNonEmpty", r.Problems)
+	}
+	if r.Effect.OutKnown {
+		t.Errorf("got known stack output %v, want unknown", r.Effect.StackOut)
+	}
+
+	// A loop that counts down terminates in the analysis.
+	prog, err = asm.Assemble("get $top 1 sub dup jumpif:$top drop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = AnalyzeContract(prog)
+	if len(r.Problems) != 0 {
+		t.Errorf("loop: got problems %v", r.Problems)
+	}
+}
+
+func TestEffect(t *testing.T) {
+	prog, err := asm.Assemble("get get add 'x' put split put put")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := AnalyzeContract(prog)
+	if len(r.Problems) > 0 {
+		t.Fatalf("got problems %v", r.Problems)
+	}
+	want := Effect{
+		StackIn:  []Type{Value},
+		ArgsIn:   []Type{Int, Int},
+		StackOut: []Type{},
+		ArgsOut:  []Type{Bytes, Value, Value},
+		OutKnown: true,
+	}
+	if !reflect.DeepEqual(r.Effect, want) {
+		t.Errorf("got effect %+v, want %+v", r.Effect, want)
+	}
+}
+
+func TestLostTrack(t *testing.T) {
+	prog, err := asm.Assemble("get roll 'x' add")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := AnalyzeContract(prog)
+	if len(r.Notes) != 1 || !strings.Contains(r.Notes[0].Err.Error(), "roll") {
+		t.Errorf("got notes %v, want one for roll", r.Notes)
+	}
+	// The type error in add is still found.
+	if len(r.Problems) != 1 || errors.Root(r.Problems[0].Err) != ErrType {
+		t.Errorf("got problems %v, want one ErrType", r.Problems)
+	}
+}
+
+func TestStandard(t *testing.T) {
+	progs := map[string][]byte{
+		"pay to multisig 1": standard.PayToMultisigProg1,
+		"pay to multisig 2": standard.PayToMultisigProg2,
+		"retire":            standard.RetireContract,
+	}
+	for name, prog := range progs {
+		r := AnalyzeContract(prog)
+		if len(r.Problems) > 0 {
+			t.Errorf("%s: got problems %v", name, r.Problems)
+		}
+	}
+}
+
+func TestDiagrams(t *testing.T) {
+	cases := []struct {
+		src  string
+		line int // line of the disagreeing diagram, or 0 for none
+	}{
+		{src: `
+			        # Contract stack  Argument stack
+			        # []              [a b]
+			get     # [b]             [a]
+			get add # [(a+b)]         []
+			verify  # []              []`,
+		},
+		{src: `
+			        # Contract stack  Argument stack
+			get     # [b]             [a]
+			get     # [b]             []
+			add verify`,
+			line: 4,
+		},
+		{src: `
+			        # Contract stack  Argument stack
+			        # []              [a b]
+			get     # [b]             [a]
+			get get # [b a c]         []
+			drop drop drop`,
+			line: 5,
+		},
+		{src: `
+			        # Contract stack  Argument stack
+			        # []              [a]
+			get     # [a]             []
+			put     # []              [x a]`,
+			line: 5,
+		},
+		{src: `
+			        # Contract stack  Argument stack
+			3 4     # [3 5]           []
+			add verify`,
+			line: 3,
+		},
+		{src: `
+			          # Contract stack  Argument stack
+			1         # [x]             []
+			drop 'a'  # [x]             []
+			drop`,
+			line: 4,
+		},
+		{src: `
+			                  # Contract stack  Argument stack
+			get dup not       # [n (n==0)]      []
+			jumpif:$zero      # [n]             []
+			    drop 1        # [1]             []
+			$zero             # [(0|1)]         []
+			drop`,
+		},
+		{src: `
+			               # Contract stack
+			get untuple    # [p1 ... p_n n]
+			$loop          # [p1 ... p_n n]
+			    dup 0 eq   # [p1 ... p_n n (n==0)]
+			    jumpif:$end
+			    swap drop  # [p1 ... p_n-1 n]
+			    1 sub      # [p1 ... p_n-1 (n-1)]
+			    jump:$loop
+			$end           # [0]
+			drop`,
+		},
+	}
+	for _, c := range cases {
+		m, err := asm.AssembleWithSourceMap(c.src)
+		if err != nil {
+			t.Fatalf("%s: %s", c.src, err)
+		}
+		r := AnalyzeContract(m.Prog, Diagrams(m))
+		if c.line == 0 {
+			if len(r.Problems) > 0 {
+				t.Errorf("%s: got problems %v", c.src, r.Problems)
+			}
+			continue
+		}
+		if len(r.Problems) != 1 || errors.Root(r.Problems[0].Err) != ErrDiagram {
+			t.Errorf("%s: got problems %v, want one ErrDiagram", c.src, r.Problems)
+			continue
+		}
+		if d := r.Problems[0].Diagram; d == nil || d.Line != c.line {
+			t.Errorf("%s: got diagram %+v, want one on line %d", c.src, d, c.line)
+		}
+	}
+}
+
+func TestTypeString(t *testing.T) {
+	cases := []struct {
+		t    Type
+		want string
+	}{
+		{Int, "Int"},
+		{Int | Bytes, "Int|Bytes"},
+		{Data, "Data"},
+		{Contract | WrappedContract, "Contract|WrappedContract"},
+		{Any, "Item"},
+	}
+	for _, c := range cases {
+		if got := c.t.String(); got != c.want {
+			t.Errorf("%d: got %q, want %q", c.t, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package analyzer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/txvm/asm"
+)
+
+type diagramKey struct {
+	prog  string
+	pc    int64
+	after bool
+}
+
+// Diagrams makes the analyzer check the program against the stack
+// diagrams in the comments of its source, described by m (which
+// must be the SourceMap of the program being analyzed). After each
+// line with a diagram, the stacks must have the number of items the
+// diagram shows, and literals, tuples, and quoted programs in the
+// diagram must match items of the right type. A name in a diagram
+// must be on items of the same type wherever it appears in the same
+// program.
+//
+// The argument stack is shared, so the argument column of a
+// contract's diagram shows only the contract's own part of it, at the
+// top. The first diagram that shows the same number of items in
+// each of its alternatives fixes where that part begins, and the
+// later ones must agree.
+//
+// Where the analyzer knows less than a diagram shows — for instance
+// about the initial stacks of a contract, or after it loses track of
+// a stack — it assumes the diagram is right, and carries on from
+// there.
+//
+// Disagreements are reported as problems with root ErrDiagram.
+func Diagrams(m *asm.SourceMap) Option {
+	return Option{
+		apply: func(cfg *config) {
+			cfg.diagrams = make(map[diagramKey][]*asm.StackDiagram)
+			addDiagrams(cfg.diagrams, m)
+		},
+	}
+}
+
+func addDiagrams(diagrams map[diagramKey][]*asm.StackDiagram, m *asm.SourceMap) {
+	for i := range m.Diagrams {
+		d := &m.Diagrams[i]
+		k := diagramKey{prog: string(m.Prog), pc: d.PC, after: d.AfterCode}
+		diagrams[k] = append(diagrams[k], d)
+	}
+	for _, inst := range m.Insts {
+		if inst.Sub != nil {
+			addDiagrams(diagrams, inst.Sub)
+		}
+	}
+}
+
+// checkDiagrams checks the diagrams at pc in prog against the
+// current state. If after is true, it checks those that follow the
+// instruction ending at pc, otherwise those on lines of their own.
+func (a *analysis) checkDiagrams(prog []byte, pc int64, after bool) {
+	if a.cfg.diagrams == nil {
+		return
+	}
+	for _, d := range a.cfg.diagrams[diagramKey{prog: string(prog), pc: pc, after: after}] {
+		if d.Stack != nil {
+			a.checkColumn(prog, d, "contract", a.cur(), d.Stack, false)
+		}
+		if d.Args != nil {
+			a.checkArgs(prog, d)
+		}
+	}
+}
+
+// checkArgs checks the argument column of a diagram. The argument
+// stack is shared, and a contract's diagram shows only its own part,
+// at the top. Where that part begins is not known at the start of a
+// contract, so the column is matched against the top of the stack
+// until a diagram fixes it, by showing the same number of items in
+// each of its alternatives. After that, each column must show
+// exactly the items above the same point.
+func (a *analysis) checkArgs(prog []byte, d *asm.StackDiagram) {
+	args := &a.s.args
+	f := a.curCall()
+	if args.base == unknown {
+		a.checkColumn(prog, d, "argument", args, d.Args, true)
+		return
+	}
+	if !f.argFloorSet {
+		a.checkColumn(prog, d, "argument", args, d.Args, true)
+		if n, ok := columnLen(d.Args); ok {
+			f.argFloor = a.argLevel() - n
+			f.argFloorSet = true
+		}
+		return
+	}
+
+	n := a.argLevel() - f.argFloor
+	if n < 0 {
+		a.diagramProblem(prog, d, "argument", d.Args, fmt.Sprintf("but the contract has taken %d items from below the part of the stack shown earlier", -n))
+		return
+	}
+	a.fill(args, n)
+	below := args.items[:len(args.items)-n]
+	part := stack{base: closed, items: args.items[len(args.items)-n:]}
+	a.checkColumn(prog, d, "argument", &part, d.Args, false)
+	args.items = append(below, part.items...)
+}
+
+// columnLen returns the number of items shown by col, if it is the
+// same in each of its alternatives, and none of them leaves the
+// number open with "...".
+func columnLen(col *asm.DiagramColumn) (int, bool) {
+	n := -1
+	for _, alt := range col.Alternatives {
+		alt = collapseRuns(alt)
+		for _, it := range alt {
+			if it == "..." {
+				return 0, false
+			}
+		}
+		if n >= 0 && len(alt) != n {
+			return 0, false
+		}
+		n = len(alt)
+	}
+	return n, n >= 0
+}
+
+// checkColumn checks a diagram column against st. If one of the
+// column's alternatives matches, the stack and the types of its
+// items are updated with what the diagram shows. If open is true,
+// the column shows only the top of the stack, as if it began with
+// "...".
+func (a *analysis) checkColumn(prog []byte, d *asm.StackDiagram, which string, st *stack, col *asm.DiagramColumn, open bool) {
+	var firstErr string
+	for _, alt := range col.Alternatives {
+		trial := st.copy()
+		names := make(map[string]Type, len(a.s.names))
+		for k, v := range a.s.names {
+			names[k] = v
+		}
+		if open {
+			alt = append([]string{"..."}, alt...)
+		}
+		msg := a.match(prog, &trial, names, alt)
+		if msg == "" {
+			*st = trial
+			a.s.names = names
+			return
+		}
+		if firstErr == "" {
+			firstErr = msg
+		}
+	}
+	a.diagramProblem(prog, d, which, col, firstErr)
+}
+
+// diagramProblem records that a column of d disagrees with the
+// program, as described by msg.
+func (a *analysis) diagramProblem(prog []byte, d *asm.StackDiagram, which string, col *asm.DiagramColumn, msg string) {
+	err := errors.WithDetailf(ErrDiagram, "line %d: %s stack: diagram shows %s, %s", d.Line, which, col.Text, msg)
+	if a.record("P", err.Error()) {
+		a.r.Problems = append(a.r.Problems, &Problem{Prog: prog, PC: d.PC, Err: err, Diagram: d})
+	}
+}
+
+// match matches the items of a diagram column against st, returning
+// a description of the mismatch if there is one.
+func (a *analysis) match(prog []byte, st *stack, names map[string]Type, items []string) string {
+	items = collapseRuns(items)
+	first, last := -1, -1
+	for i, it := range items {
+		if it == "..." {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	top, bottom := items, []string(nil)
+	if first >= 0 {
+		top, bottom = items[last+1:], items[:first]
+	}
+
+	n := len(st.items)
+	switch {
+	case first < 0 && st.base == closed && n != len(items):
+		return fmt.Sprintf("stack has %s", describe(st.items))
+	case first < 0 && n > len(items):
+		return fmt.Sprintf("stack has at least %s", describe(st.items))
+	case first >= 0 && st.base == closed && n < len(top)+len(bottom):
+		return fmt.Sprintf("stack has %s", describe(st.items))
+	}
+	if st.base != closed {
+		a.fill(st, len(top))
+		if first < 0 {
+			// The diagram shows the whole stack.
+			st.base = closed
+		}
+	}
+
+	offset := len(st.items) - len(top)
+	for i, name := range top {
+		if msg := a.matchItem(prog, names, name, &st.items[offset+i]); msg != "" {
+			return msg
+		}
+	}
+	if st.base == closed {
+		for i, name := range bottom {
+			if msg := a.matchItem(prog, names, name, &st.items[i]); msg != "" {
+				return msg
+			}
+		}
+	}
+	return ""
+}
+
+// matchItem matches one item of a diagram against it.
+func (a *analysis) matchItem(prog []byte, names map[string]Type, name string, it *item) string {
+	want := Any
+	switch {
+	case name[0] == '{':
+		want = Tuple
+	case name[0] == '[' || name[0] == '"' || name[0] == '\'' || strings.HasPrefix(name, "x'"):
+		want = Bytes
+	case isName(name):
+		k := fmt.Sprintf("%d/%s", a.progID(prog), name)
+		t, ok := names[k]
+		if !ok {
+			if it.typ != Any {
+				names[k] = it.typ
+			}
+			return ""
+		}
+		if it.typ&t == 0 {
+			return fmt.Sprintf("but %s is %s here and %s elsewhere", name, it.typ, t)
+		}
+		want = t
+	default:
+		n, err := strconv.ParseInt(name, 10, 64)
+		if err != nil {
+			return "" // an expression
+		}
+		if v, ok := it.intVal(); ok && v != n {
+			return fmt.Sprintf("but %s is %d", name, v)
+		}
+		want = Int
+	}
+	if it.typ&want == 0 {
+		return fmt.Sprintf("but %s is %s", name, it.typ)
+	}
+	it.typ &= want
+	if it.in != nil && *it.in&want != 0 {
+		*it.in &= want
+	}
+	return ""
+}
+
+// collapseRuns replaces each run such as p1 ... p_n in items, which
+// may stand for no items at all, with a plain "...".
+func collapseRuns(items []string) []string {
+	var result []string
+	for i := 0; i < len(items); i++ {
+		if i+2 < len(items) && items[i+1] == "..." && runStem(items[i]) != "" && runStem(items[i]) == runStem(items[i+2]) {
+			result = append(result, "...")
+			i += 2
+			continue
+		}
+		result = append(result, items[i])
+	}
+	return result
+}
+
+// runStem returns the name p of an item p1, p_n, p_n-1, and so on,
+// or "" if the item is not one of a numbered run.
+func runStem(item string) string {
+	i := strings.IndexFunc(item, func(r rune) bool { return r == '_' || unicode.IsDigit(r) })
+	if i <= 0 || !isName(item[:i]) {
+		return ""
+	}
+	return item[:i]
+}
+
+func isName(s string) bool {
+	for i, r := range s {
+		if !(unicode.IsLetter(r) || r == '_' || (i > 0 && (unicode.IsDigit(r) || r == '\'' || r == '’'))) {
+			return false
+		}
+	}
+	return true
+}
+
+// describe describes the known items of a stack, bottom first.
+func describe(items []item) string {
+	var parts []string
+	for _, it := range items {
+		switch v := it.val.(type) {
+		case int64:
+			parts = append(parts, strconv.FormatInt(v, 10))
+		default:
+			parts = append(parts, it.typ.String())
+		}
+	}
+	return fmt.Sprintf("%d items [%s]", len(items), strings.Join(parts, " "))
+}
@@ -0,0 +1,592 @@
+package analyzer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/txvm/op"
+)
+
+// Limits on the work done analyzing one program. Past them, the
+// analyzer gives up on the paths it has not yet followed, and says
+// so in a Note.
+const (
+	maxSteps  = 1 << 20 // instructions interpreted
+	maxVisits = 64      // distinct states arriving at one jump target
+	widenAt   = 8       // states at one jump target before widening
+)
+
+type baseKind int
+
+const (
+	closed  baseKind = iota // nothing below the known items
+	inputs                  // the program's inputs, of unknown number
+	unknown                 // the analyzer has lost track
+)
+
+// item is a symbolic stack item.
+type item struct {
+	typ Type
+
+	// val is the item's value, int64 for an Int or string for Bytes,
+	// if it is a constant.
+	val interface{}
+
+	// elems are the elements of a Tuple whose length is known.
+	elems []item
+
+	// prog and cstack are the program and stack of a contract, when
+	// they are known. Neither is modified once set.
+	prog    string
+	hasProg bool
+	cstack  *stack
+
+	// in is the type of the input this item was taken from, if any.
+	in *Type
+}
+
+func (it item) intVal() (int64, bool) {
+	n, ok := it.val.(int64)
+	return n, ok
+}
+
+func (it item) bytesVal() ([]byte, bool) {
+	s, ok := it.val.(string)
+	return []byte(s), ok
+}
+
+func (it item) key(b *strings.Builder) {
+	fmt.Fprintf(b, "%d", it.typ)
+	switch v := it.val.(type) {
+	case int64:
+		fmt.Fprintf(b, "=%d", v)
+	case string:
+		fmt.Fprintf(b, "=%q", v)
+	}
+	if it.elems != nil {
+		b.WriteByte('{')
+		for _, e := range it.elems {
+			e.key(b)
+			b.WriteByte(',')
+		}
+		b.WriteByte('}')
+	}
+	if it.hasProg {
+		fmt.Fprintf(b, "[%q]", it.prog)
+	}
+	if it.cstack != nil {
+		it.cstack.key(b)
+	}
+}
+
+// stack is a symbolic stack. Its items, bottom first, are the ones
+// the analyzer knows about; below them is whatever its base says.
+type stack struct {
+	base  baseKind
+	items []item
+
+	// For a stack of inputs, side is 0 for the contract stack and 1
+	// for the argument stack, and taken is the number of inputs
+	// already among the items.
+	side  int
+	taken int
+}
+
+func (st *stack) copy() stack {
+	c := *st
+	c.items = append([]item(nil), st.items...)
+	return c
+}
+
+// key writes a description of st to b, for detecting repeated
+// states. It omits the number of inputs taken, so that a loop
+// consuming inputs reaches a fixed point.
+func (st *stack) key(b *strings.Builder) {
+	fmt.Fprintf(b, "<%d:", st.base)
+	for _, it := range st.items {
+		it.key(b)
+		b.WriteByte(' ')
+	}
+	b.WriteByte('>')
+}
+
+// widen forgets the values of the Ints on st.
+func (st *stack) widen() {
+	for i := range st.items {
+		if _, ok := st.items[i].intVal(); ok {
+			st.items[i].val = nil
+		}
+	}
+}
+
+// frame is a program being run, either the program being analyzed,
+// or one started by exec or call.
+type frame struct {
+	prog []byte
+	pc   int64
+	call bool // has its own contract stack
+
+	// pending is set when the frame is suspended by exec or call
+	// just after an instruction followed by a stack diagram, to check
+	// the diagram when the frame resumes.
+	pending bool
+
+	// For a frame with call set, argFloor is the level (see
+	// argLevel) of the argument stack below the contract's own part
+	// of it, once argFloorSet. (See checkArgs.)
+	argFloor    int
+	argFloorSet bool
+}
+
+// state is the state of the VM at some point on a path through the
+// program.
+type state struct {
+	runs   []frame
+	stacks []stack // one for each frame with call set
+	args   stack
+
+	// names maps the names in stack diagrams (qualified by program)
+	// to the types of the items they were first seen on.
+	names map[string]Type
+}
+
+func (s *state) clone() *state {
+	c := &state{
+		runs:   append([]frame(nil), s.runs...),
+		stacks: make([]stack, len(s.stacks)),
+		args:   s.args.copy(),
+		names:  make(map[string]Type, len(s.names)),
+	}
+	for i := range s.stacks {
+		c.stacks[i] = s.stacks[i].copy()
+	}
+	for k, v := range s.names {
+		c.names[k] = v
+	}
+	return c
+}
+
+// end is the state of the stacks at the end of a path through the
+// program.
+type end struct {
+	stack, args []item
+	known       bool
+}
+
+type quote struct {
+	prog      []byte
+	stackBase baseKind
+}
+
+// stopPath is panicked to abandon the current path.
+type stopPath struct{}
+
+// analysis is the analysis of one program.
+type analysis struct {
+	r    *Report
+	cfg  *config
+	prog []byte
+	tx   bool // analyzing a transaction program
+
+	init    *state
+	work    []*state
+	ins     [2][]*Type // input types of the contract and argument stacks
+	ends    []end
+	quoted  []quote
+	seen    map[string]bool
+	visits  map[string]int
+	progIDs map[string]int
+	steps   int
+	found   map[string]bool // problems and notes recorded, shared with other analyses
+
+	// The path being followed, and the instruction being interpreted.
+	s      *state
+	inProg []byte
+	pc     int64
+	end    int64 // pc of the next instruction
+	name   string
+}
+
+func newAnalysis(r *Report, cfg *config, found map[string]bool, prog []byte, stackBase, argsBase baseKind) *analysis {
+	a := &analysis{
+		r:       r,
+		cfg:     cfg,
+		prog:    prog,
+		tx:      stackBase == closed && argsBase == closed,
+		seen:    make(map[string]bool),
+		visits:  make(map[string]int),
+		progIDs: make(map[string]int),
+		found:   found,
+	}
+	a.init = &state{
+		// The whole argument stack of a transaction is its own.
+		runs:   []frame{{prog: prog, call: true, argFloorSet: argsBase == closed}},
+		stacks: []stack{{base: stackBase}},
+		args:   stack{base: argsBase, side: 1},
+		names:  make(map[string]Type),
+	}
+	return a
+}
+
+func (a *analysis) run() {
+	a.work = []*state{a.init}
+	for len(a.work) > 0 {
+		s := a.work[len(a.work)-1]
+		a.work = a.work[:len(a.work)-1]
+		a.follow(s)
+	}
+}
+
+// follow interprets instructions on one path until it ends.
+func (a *analysis) follow(s *state) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(stopPath); !ok {
+				panic(r)
+			}
+		}
+	}()
+	a.s = s
+	for {
+		f := &s.runs[len(s.runs)-1]
+		a.checkDiagrams(f.prog, f.pc, false)
+		if f.pc >= int64(len(f.prog)) {
+			a.endFrame()
+			continue
+		}
+		a.inProg, a.pc = f.prog, f.pc
+		if a.steps++; a.steps > maxSteps {
+			a.note("analysis stopped after %d instructions", maxSteps)
+		}
+		opcode, data, n, err := op.DecodeInst(f.prog[f.pc:])
+		if err != nil {
+			a.name = "decode"
+			a.fail(errors.WithDetail(ErrOpcode, err.Error()))
+		}
+		f.pc += n
+		a.end = f.pc
+		switch {
+		case op.IsSmallIntOp(opcode):
+			a.name = strconv.Itoa(int(opcode - op.MinSmallInt))
+		case op.IsPushdataOp(opcode):
+			a.name = "pushdata"
+		default:
+			a.name = op.Name(opcode)
+		}
+		depth := len(s.runs)
+		a.step(opcode, data)
+		if len(s.runs) >= depth {
+			if f := &s.runs[depth-1]; f.pc == a.end {
+				if len(s.runs) == depth {
+					a.checkDiagrams(f.prog, f.pc, true)
+				} else {
+					f.pending = true
+				}
+			}
+		}
+	}
+}
+
+// endFrame handles reaching the end of the current frame's program.
+func (a *analysis) endFrame() {
+	s := a.s
+	f := s.runs[len(s.runs)-1]
+	s.runs = s.runs[:len(s.runs)-1]
+	if len(s.runs) == 0 {
+		a.finish(false)
+	}
+	if f.call {
+		a.inProg, a.pc = f.prog, int64(len(f.prog))
+		if n := len(a.cur().items); n > 0 {
+			a.name = "call"
+			a.fail(errors.WithDetailf(ErrNonEmpty, "%d items left", n))
+		}
+		s.stacks = s.stacks[:len(s.stacks)-1]
+	}
+	a.resume()
+}
+
+// unwind ends the frames up to and including the innermost call, as
+// output, yield, and wrap do.
+func (a *analysis) unwind() {
+	s := a.s
+	for {
+		f := s.runs[len(s.runs)-1]
+		s.runs = s.runs[:len(s.runs)-1]
+		if len(s.runs) == 0 {
+			a.finish(true)
+		}
+		if f.call {
+			s.stacks = s.stacks[:len(s.stacks)-1]
+			a.resume()
+			return
+		}
+	}
+}
+
+// resume checks the diagrams pending in the frame returned to at
+// the end of a call or exec.
+func (a *analysis) resume() {
+	f := &a.s.runs[len(a.s.runs)-1]
+	if f.pending {
+		f.pending = false
+		a.checkDiagrams(f.prog, f.pc, true)
+	}
+}
+
+// finish ends the path at the end of the program being analyzed, and
+// records its end state.
+func (a *analysis) finish(unwound bool) {
+	s := a.s
+	st, args := &s.stacks[0], &s.args
+	a.inProg, a.pc = a.prog, int64(len(a.prog))
+	a.ends = append(a.ends, end{
+		stack: st.items,
+		args:  args.items,
+		known: st.base != unknown && args.base != unknown,
+	})
+	switch {
+	case a.tx && (len(st.items) > 0 || len(args.items) > 0):
+		a.problem(errors.WithDetailf(ErrResidue, "%d items on contract stack, %d on argument stack", len(st.items), len(args.items)))
+	case !a.tx && !unwound && len(st.items) > 0:
+		a.problem(errors.WithDetailf(ErrNonEmpty, "%d items left", len(st.items)))
+	}
+	panic(stopPath{})
+}
+
+func (a *analysis) cur() *stack {
+	return &a.s.stacks[len(a.s.stacks)-1]
+}
+
+// curCall returns the innermost frame with its own contract stack.
+func (a *analysis) curCall() *frame {
+	for i := len(a.s.runs) - 1; ; i-- {
+		if a.s.runs[i].call {
+			return &a.s.runs[i]
+		}
+	}
+}
+
+// argLevel returns the depth of the argument stack relative to its
+// depth at the start of the analysis, which may be unknown.
+func (a *analysis) argLevel() int {
+	return len(a.s.args.items) - a.s.args.taken
+}
+
+// fill makes sure st has at least n known items.
+func (a *analysis) fill(st *stack, n int) {
+	missing := n - len(st.items)
+	if missing <= 0 {
+		return
+	}
+	more := make([]item, missing)
+	for i := range more {
+		more[i].typ = Any
+	}
+	switch st.base {
+	case closed:
+		which := "contract"
+		if st == &a.s.args {
+			which = "argument"
+		}
+		a.fail(errors.WithDetailf(ErrUnderflow, "%s: %s stack has %d items, want %d", a.name, which, len(st.items), n))
+	case inputs:
+		// Inputs are numbered from the top of the initial stack.
+		for i := range more {
+			more[i].in = a.input(st.side, st.taken+missing-1-i)
+		}
+		st.taken += missing
+	}
+	st.items = append(more, st.items...)
+}
+
+func (a *analysis) input(side, i int) *Type {
+	for len(a.ins[side]) <= i {
+		t := Any
+		a.ins[side] = append(a.ins[side], &t)
+	}
+	return a.ins[side][i]
+}
+
+// check checks that it can have type want, and narrows its type.
+func (a *analysis) check(it *item, want Type) {
+	if it.typ&want == 0 {
+		a.fail(errors.WithDetailf(ErrType, "%s: want %s, got %s", a.name, want, it.typ))
+	}
+	it.typ &= want
+	if it.in != nil && *it.in&want != 0 {
+		*it.in &= want
+	}
+}
+
+// peek returns the item n places from the top of the contract stack,
+// checking its type.
+func (a *analysis) peek(n int, want Type) item {
+	st := a.cur()
+	a.fill(st, n+1)
+	it := &st.items[len(st.items)-1-n]
+	a.check(it, want)
+	return *it
+}
+
+func (a *analysis) pop(want Type) item {
+	it := a.peek(0, want)
+	st := a.cur()
+	st.items = st.items[:len(st.items)-1]
+	return it
+}
+
+func (a *analysis) push(it item) {
+	st := a.cur()
+	st.items = append(st.items, it)
+}
+
+// lose records that the analyzer has lost track of the current
+// contract stack.
+func (a *analysis) lose(format string, args ...interface{}) {
+	a.addNote(fmt.Sprintf(format, args...))
+	st := a.cur()
+	st.base = unknown
+	st.items = nil
+}
+
+// loseArgs is like lose for the argument stack.
+func (a *analysis) loseArgs(format string, args ...interface{}) {
+	a.addNote(fmt.Sprintf(format, args...))
+	a.s.args.base = unknown
+	a.s.args.items = nil
+}
+
+// fork queues a copy of the current state, continuing at pc in the
+// current program.
+func (a *analysis) fork(pc int64) {
+	s := a.s.clone()
+	s.runs[len(s.runs)-1].pc = pc
+	if a.visit(s) {
+		a.work = append(a.work, s)
+	}
+}
+
+// visit reports whether a state arriving at a jump target should be
+// followed: it has not been seen before, and the limit on states at
+// that target has not been reached.
+func (a *analysis) visit(s *state) bool {
+	var b strings.Builder
+	for _, f := range s.runs {
+		fmt.Fprintf(&b, "%d:%d:%t", a.progID(f.prog), f.pc, f.call)
+		if f.argFloorSet {
+			fmt.Fprintf(&b, ":%d", f.argFloor)
+		}
+		b.WriteByte(' ')
+	}
+	target := b.String()
+	if a.visits[target] >= widenAt {
+		// Perhaps a loop is counting. Forget the values of Ints, so
+		// that its states repeat.
+		for i := range s.stacks {
+			s.stacks[i].widen()
+		}
+		s.args.widen()
+	}
+	for i := range s.stacks {
+		s.stacks[i].key(&b)
+	}
+	s.args.key(&b)
+	k := b.String()
+	if a.seen[k] {
+		return false
+	}
+	a.seen[k] = true
+	if a.visits[target]++; a.visits[target] > maxVisits {
+		a.addNote(fmt.Sprintf("too many distinct paths to jump target (more than %d)", maxVisits))
+		return false
+	}
+	return true
+}
+
+func (a *analysis) progID(prog []byte) int {
+	id, ok := a.progIDs[string(prog)]
+	if !ok {
+		id = len(a.progIDs)
+		a.progIDs[string(prog)] = id
+	}
+	return id
+}
+
+func (a *analysis) quote(prog []byte, stackBase baseKind) {
+	a.quoted = append(a.quoted, quote{prog: prog, stackBase: stackBase})
+}
+
+// fail records a problem and abandons the current path.
+func (a *analysis) fail(err error) {
+	a.problem(err)
+	panic(stopPath{})
+}
+
+// note records a note and abandons the current path.
+func (a *analysis) note(format string, args ...interface{}) {
+	a.addNote(fmt.Sprintf(format, args...))
+	panic(stopPath{})
+}
+
+func (a *analysis) problem(err error) {
+	if a.record("P", err.Error()) {
+		a.r.Problems = append(a.r.Problems, &Problem{Prog: a.inProg, PC: a.pc, Err: err})
+	}
+}
+
+func (a *analysis) addNote(msg string) {
+	msg = a.name + ": " + msg
+	if a.record("N", msg) {
+		a.r.Notes = append(a.r.Notes, &Problem{Prog: a.inProg, PC: a.pc, Err: errors.New(msg)})
+	}
+}
+
+// record reports whether a problem or note is new, remembering it if
+// so.
+func (a *analysis) record(kind, msg string) bool {
+	k := fmt.Sprintf("%s %x %d %s", kind, a.inProg, a.pc, msg)
+	if a.found[k] {
+		return false
+	}
+	a.found[k] = true
+	return true
+}
+
+func (a *analysis) effect() Effect {
+	var e Effect
+	for _, t := range a.ins[0] {
+		e.StackIn = append(e.StackIn, *t)
+	}
+	for _, t := range a.ins[1] {
+		e.ArgsIn = append(e.ArgsIn, *t)
+	}
+	if len(a.ends) == 0 {
+		return e
+	}
+	e.OutKnown = true
+	for i, end := range a.ends {
+		if !end.known || len(end.stack) != len(a.ends[0].stack) || len(end.args) != len(a.ends[0].args) {
+			return Effect{StackIn: e.StackIn, ArgsIn: e.ArgsIn}
+		}
+		e.StackOut = union(e.StackOut, end.stack, i == 0)
+		e.ArgsOut = union(e.ArgsOut, end.args, i == 0)
+	}
+	return e
+}
+
+func union(types []Type, items []item, first bool) []Type {
+	if first {
+		types = []Type{}
+	}
+	for i, it := range items {
+		if first {
+			types = append(types, it.typ)
+		} else {
+			types[i] |= it.typ
+		}
+	}
+	return types
+}
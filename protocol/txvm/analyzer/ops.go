@@ -0,0 +1,464 @@
+package analyzer
+
+import (
+	"encoding/binary"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/math/checked"
+	"github.com/chain/txvm/protocol/txvm/op"
+)
+
+func intItem(n int64) item    { return item{typ: Int, val: n} }
+func bytesItem(b []byte) item { return item{typ: Bytes, val: string(b)} }
+func typed(t Type) item       { return item{typ: t} }
+
+func boolItem(b bool) item {
+	if b {
+		return intItem(1)
+	}
+	return intItem(0)
+}
+
+func (it item) isConst() bool {
+	return it.val != nil
+}
+
+// knownBool reports whether the truth value of it is known: it is
+// a constant, or it cannot be an Int (and so is true).
+func (it item) knownBool() bool {
+	return it.isConst() || it.typ&Int == 0
+}
+
+// boolVal is the truth value of an item for which knownBool is true.
+func (it item) boolVal() bool {
+	n, ok := it.intVal()
+	return !ok || n != 0
+}
+
+// step interprets one instruction.
+func (a *analysis) step(opcode byte, data []byte) {
+	switch {
+	case op.IsSmallIntOp(opcode):
+		a.push(intItem(int64(opcode - op.MinSmallInt)))
+		return
+	case op.IsPushdataOp(opcode):
+		a.push(bytesItem(data))
+		return
+	}
+
+	switch opcode {
+	case op.Int:
+		b := a.pop(Bytes)
+		res := typed(Int)
+		if s, ok := b.bytesVal(); ok {
+			n, m := binary.Uvarint(s)
+			if m <= 0 {
+				a.fail(errors.WithDetailf(ErrFail, "int: invalid varint %x", s))
+			}
+			res = intItem(int64(n))
+		}
+		a.push(res)
+
+	case op.Add:
+		a.binOp(checked.AddInt64)
+	case op.Mul:
+		a.binOp(checked.MulInt64)
+	case op.Div:
+		a.binOp(checked.DivInt64)
+	case op.Mod:
+		a.binOp(checked.ModInt64)
+	case op.Neg:
+		x := a.pop(Int)
+		res := typed(Int)
+		if n, ok := x.intVal(); ok {
+			if neg, ok := checked.NegateInt64(n); ok {
+				res = intItem(neg)
+			}
+		}
+		a.push(res)
+	case op.GT:
+		y, x := a.pop(Int), a.pop(Int)
+		res := typed(Int)
+		if n, ok := x.intVal(); ok {
+			if m, ok := y.intVal(); ok {
+				res = boolItem(n > m)
+			}
+		}
+		a.push(res)
+	case op.Not:
+		x := a.pop(Data)
+		res := typed(Int)
+		if x.knownBool() {
+			res = boolItem(!x.boolVal())
+		}
+		a.push(res)
+	case op.And, op.Or:
+		y, x := a.pop(Data), a.pop(Data)
+		res := typed(Int)
+		if x.knownBool() && y.knownBool() {
+			if opcode == op.And {
+				res = boolItem(x.boolVal() && y.boolVal())
+			} else {
+				res = boolItem(x.boolVal() || y.boolVal())
+			}
+		}
+		a.push(res)
+
+	case op.Roll, op.Bury, op.Reverse:
+		n, ok := a.pop(Int).intVal()
+		if !ok {
+			a.lose("operand is not a constant; contract stack unknown after this point")
+			return
+		}
+		if n < 0 {
+			a.fail(errors.WithDetailf(ErrUnderflow, "%s: negative operand %d", a.name, n))
+		}
+		st := a.cur()
+		switch opcode {
+		case op.Roll:
+			a.fill(st, int(n)+1)
+			i := len(st.items) - 1 - int(n)
+			it := st.items[i]
+			st.items = append(append(st.items[:i:i], st.items[i+1:]...), it)
+		case op.Bury:
+			a.fill(st, int(n)+1)
+			i := len(st.items) - 1 - int(n)
+			it := st.items[len(st.items)-1]
+			copy(st.items[i+1:], st.items[i:len(st.items)-1])
+			st.items[i] = it
+		case op.Reverse:
+			a.fill(st, int(n))
+			top := st.items[len(st.items)-int(n):]
+			for i, j := 0, len(top)-1; i < j; i, j = i+1, j-1 {
+				top[i], top[j] = top[j], top[i]
+			}
+		}
+	case op.Get:
+		a.fill(&a.s.args, 1)
+		args := &a.s.args
+		a.push(args.items[len(args.items)-1])
+		args.items = args.items[:len(args.items)-1]
+	case op.Put:
+		a.s.args.items = append(a.s.args.items, a.pop(Any))
+	case op.Depth:
+		res := typed(Int)
+		if a.s.args.base == closed {
+			res = intItem(int64(len(a.s.args.items)))
+		}
+		a.push(res)
+
+	case op.Nonce:
+		a.pop(Int)
+		a.pop(Bytes)
+		a.push(typed(Value))
+	case op.Merge:
+		a.pop(Value)
+		a.pop(Value)
+		a.push(typed(Value))
+	case op.Split:
+		a.pop(Int)
+		a.pop(Value)
+		a.push(typed(Value))
+		a.push(typed(Value))
+	case op.Issue:
+		a.pop(Bytes)
+		a.pop(Int)
+		a.pop(Value)
+		a.push(typed(Value))
+	case op.Retire:
+		a.pop(Value)
+	case op.Amount:
+		a.peek(0, Value)
+		a.push(typed(Int))
+	case op.AssetID, op.Anchor:
+		a.peek(0, Value)
+		a.push(typed(Bytes))
+
+	case op.VMHash:
+		a.pop(Bytes)
+		a.pop(Bytes)
+		a.push(typed(Bytes))
+	case op.SHA256, op.SHA3:
+		a.pop(Bytes)
+		a.push(typed(Bytes))
+	case op.CheckSig:
+		a.pop(Data)
+		a.pop(Bytes)
+		a.pop(Bytes)
+		a.pop(Bytes)
+		a.push(typed(Int))
+
+	case op.Log:
+		a.pop(Data)
+	case op.PeekLog:
+		a.pop(Int)
+		a.push(typed(Tuple))
+	case op.TxID:
+		a.push(typed(Bytes))
+	case op.Finalize:
+		a.pop(Value)
+
+	case op.Verify:
+		x := a.pop(Data)
+		if x.knownBool() && !x.boolVal() {
+			a.fail(errors.WithDetail(ErrFail, "verify: condition is always false"))
+		}
+	case op.JumpIf:
+		offset, ok := a.pop(Int).intVal()
+		cond := a.pop(Data)
+		if cond.knownBool() && !cond.boolVal() {
+			return
+		}
+		if !ok {
+			a.note("jump offset is not a constant")
+		}
+		f := &a.s.runs[len(a.s.runs)-1]
+		dest, ok := checked.AddInt64(f.pc, offset)
+		if !ok || dest < 0 || dest > int64(len(f.prog)) {
+			a.fail(errors.WithDetailf(ErrJump, "jumpif: destination %d, program length %d", f.pc+offset, len(f.prog)))
+		}
+		if !cond.knownBool() {
+			a.fork(dest)
+			return
+		}
+		f.pc = dest
+		if !a.visit(a.s) {
+			panic(stopPath{})
+		}
+	case op.Exec:
+		prog, ok := a.pop(Bytes).bytesVal()
+		if !ok {
+			a.note("program is not a constant")
+		}
+		a.s.runs = append(a.s.runs, frame{prog: prog})
+	case op.Call:
+		con := a.pop(Contract | WrappedContract)
+		if !con.hasProg || con.cstack == nil {
+			a.loseArgs("contract program is not known; argument stack unknown after this point")
+			return
+		}
+		a.s.stacks = append(a.s.stacks, con.cstack.copy())
+		a.s.runs = append(a.s.runs, frame{prog: []byte(con.prog), call: true})
+	case op.Yield, op.Wrap, op.Output:
+		prog, ok := a.pop(Bytes).bytesVal()
+		if ok {
+			a.quote(prog, inputs)
+		}
+		if opcode != op.Yield {
+			for _, it := range a.cur().items {
+				if it.typ == Contract {
+					a.fail(errors.WithDetailf(ErrType, "%s: contract stack holds an unwrapped contract", a.name))
+				}
+			}
+		}
+		// The diagram after this instruction describes the stacks
+		// as the contract leaves them.
+		a.checkDiagrams(a.inProg, a.end, true)
+		if opcode != op.Output {
+			con := item{typ: Contract, prog: string(prog), hasProg: ok}
+			if opcode == op.Wrap {
+				con.typ = WrappedContract
+			}
+			st := a.cur().copy()
+			con.cstack = &st
+			a.s.args.items = append(a.s.args.items, con)
+		}
+		a.unwind()
+	case op.Input:
+		a.push(inputContract(a.pop(Tuple)))
+	case op.Contract:
+		prog, ok := a.pop(Bytes).bytesVal()
+		con := typed(Contract)
+		if ok {
+			a.quote(prog, closed)
+			con.prog, con.hasProg, con.cstack = string(prog), true, &stack{}
+		}
+		a.push(con)
+	case op.Seed:
+		a.peek(0, Contract|WrappedContract)
+		a.push(typed(Bytes))
+	case op.Self, op.Caller, op.ContractProgram:
+		a.push(typed(Bytes))
+	case op.TimeRange:
+		a.pop(Int)
+		a.pop(Int)
+
+	case op.Prv:
+		a.fail(errors.WithDetail(ErrFail, "prv"))
+	case op.Ext:
+		a.pop(Data)
+		a.lose("effect of ext is not known; contract stack unknown after this point")
+
+	case op.Eq:
+		y, x := a.pop(Data), a.pop(Data)
+		res := typed(Int)
+		if x.isConst() && y.isConst() {
+			res = boolItem(x.val == y.val)
+		}
+		a.push(res)
+	case op.Dup:
+		a.push(a.peek(0, Data))
+	case op.Drop:
+		a.pop(Data | Value)
+	case op.Peek:
+		n, ok := a.pop(Int).intVal()
+		if !ok {
+			a.push(typed(Data))
+			return
+		}
+		if n < 0 {
+			a.fail(errors.WithDetailf(ErrUnderflow, "peek: negative operand %d", n))
+		}
+		a.push(a.peek(int(n), Data))
+	case op.Tuple:
+		n, ok := a.pop(Int).intVal()
+		if !ok {
+			a.lose("operand is not a constant; contract stack unknown after this point")
+			a.push(typed(Tuple))
+			return
+		}
+		if n < 0 {
+			a.fail(errors.WithDetailf(ErrUnderflow, "tuple: negative operand %d", n))
+		}
+		a.fill(a.cur(), int(n))
+		elems := make([]item, n)
+		for i := n - 1; i >= 0; i-- {
+			elems[i] = a.pop(Data)
+		}
+		a.push(item{typ: Tuple, elems: elems})
+	case op.Untuple:
+		t := a.pop(Tuple)
+		if t.elems == nil {
+			a.lose("tuple length is not known; contract stack unknown after this point")
+			return
+		}
+		for _, e := range t.elems {
+			a.push(e)
+		}
+		a.push(intItem(int64(len(t.elems))))
+	case op.Len:
+		x := a.pop(Bytes | Tuple)
+		res := typed(Int)
+		if b, ok := x.bytesVal(); ok {
+			res = intItem(int64(len(b)))
+		} else if x.elems != nil {
+			res = intItem(int64(len(x.elems)))
+		}
+		a.push(res)
+	case op.Field:
+		n, ok := a.pop(Int).intVal()
+		t := a.pop(Tuple)
+		res := typed(Data)
+		if ok && t.elems != nil {
+			if n < 0 || n >= int64(len(t.elems)) {
+				a.fail(errors.WithDetailf(ErrFail, "field: index %d out of range for tuple of length %d", n, len(t.elems)))
+			}
+			res = t.elems[n]
+		}
+		a.push(res)
+	case op.Encode:
+		a.pop(Data)
+		a.push(typed(Bytes))
+	case op.Cat:
+		y, x := a.pop(Bytes), a.pop(Bytes)
+		res := typed(Bytes)
+		if b, ok := x.bytesVal(); ok {
+			if c, ok := y.bytesVal(); ok {
+				res = bytesItem(append(b, c...))
+			}
+		}
+		a.push(res)
+	case op.Slice:
+		end, ok1 := a.pop(Int).intVal()
+		start, ok2 := a.pop(Int).intVal()
+		b, ok3 := a.pop(Bytes).bytesVal()
+		res := typed(Bytes)
+		if ok1 && ok2 && ok3 {
+			if start < 0 || end < start || end > int64(len(b)) {
+				a.fail(errors.WithDetailf(ErrFail, "slice: range [%d:%d] out of range for length %d", start, end, len(b)))
+			}
+			res = bytesItem(b[start:end])
+		}
+		a.push(res)
+	case op.BitNot:
+		a.pop(Bytes)
+		a.push(typed(Bytes))
+	case op.BitAnd, op.BitOr, op.BitXor:
+		a.pop(Bytes)
+		a.pop(Bytes)
+		a.push(typed(Bytes))
+
+	default:
+		a.fail(errors.WithDetailf(ErrOpcode, "opcode %d", opcode))
+	}
+}
+
+func (a *analysis) binOp(f func(x, y int64) (int64, bool)) {
+	y, x := a.pop(Int), a.pop(Int)
+	res := typed(Int)
+	if n, ok := x.intVal(); ok {
+		if m, ok := y.intVal(); ok {
+			if r, ok := f(n, m); ok {
+				res = intItem(r)
+			}
+		}
+	}
+	a.push(res)
+}
+
+// inputContract returns the contract created by input from the tuple
+// t. If t's contents are known, so is the contract.
+func inputContract(t item) item {
+	con := typed(Contract | WrappedContract)
+	if len(t.elems) < 3 {
+		return con
+	}
+	switch code, _ := t.elems[0].bytesVal(); string(code) {
+	case "C":
+		con.typ = Contract
+	case "W":
+		con.typ = WrappedContract
+	}
+	prog, ok := t.elems[2].bytesVal()
+	if !ok {
+		return con
+	}
+	st := &stack{}
+	for _, e := range t.elems[3:] {
+		st.items = append(st.items, uninspect(e))
+	}
+	con.prog, con.hasProg, con.cstack = string(prog), true, st
+	return con
+}
+
+// uninspect returns the stack item described by the tuple t, a field
+// of an input contract.
+func uninspect(t item) item {
+	if len(t.elems) < 1 {
+		return typed(Any)
+	}
+	code, _ := t.elems[0].bytesVal()
+	switch string(code) {
+	case "Z":
+		if len(t.elems) == 2 {
+			if n, ok := t.elems[1].intVal(); ok {
+				return intItem(n)
+			}
+		}
+		return typed(Int)
+	case "S":
+		if len(t.elems) == 2 {
+			if b, ok := t.elems[1].bytesVal(); ok {
+				return bytesItem(b)
+			}
+		}
+		return typed(Bytes)
+	case "T":
+		return typed(Tuple)
+	case "V":
+		return typed(Value)
+	case "C", "W":
+		return inputContract(t)
+	}
+	return typed(Any)
+}
@@ -54,9 +54,21 @@ var composite map[string][]byte
 // Assemble converts a string containing an assembly language txvm
 // program into the corresponding bytecode.
 func Assemble(s string) ([]byte, error) {
+	m, err := AssembleWithSourceMap(s)
+	if err != nil {
+		return nil, err
+	}
+	return m.Prog, nil
+}
+
+// AssembleWithSourceMap is like Assemble but also returns a
+// SourceMap relating each instruction in the resulting program to
+// the source that produced it. The program itself is in the
+// SourceMap's Prog field.
+func AssembleWithSourceMap(s string) (*SourceMap, error) {
 	scan := new(scanner)
 	scan.initString(s)
-	bytecode, err := assemble(scan, tokEOF)
+	m, err := assemble(scan, tokEOF)
 
 	// prefer the scanner's errors over the assemblers.
 	if len(scan.errs) > 0 {
@@ -65,7 +77,11 @@ func Assemble(s string) ([]byte, error) {
 			"errors",
 			scan.errs)
 	}
-	return bytecode, err
+	if err != nil {
+		return nil, err
+	}
+	m.setPositions(newLineTable(s), nil)
+	return m, nil
 }
 
 // MustAssemble calls Assemble and panics on error.
@@ -77,7 +93,7 @@ func MustAssemble(s string) []byte {
 	return result
 }
 
-func assemble(s *scanner, stoptok token) ([]byte, error) {
+func assemble(s *scanner, stoptok token) (*SourceMap, error) {
 	// First construct a list of assembler "items," then "resolve" those
 	// into bytecode.
 	//
@@ -87,14 +103,19 @@ func assemble(s *scanner, stoptok token) ([]byte, error) {
 	//   - symbolic jumptargets, and
 	//   - (other) instruction sequences.
 	a := &assembler{
-		stoptok: stoptok,
-		scanner: s,
+		stoptok:  stoptok,
+		scanner:  s,
+		codeLine: -1,
 	}
 	err := a.assembleItems()
 	if err != nil {
 		return nil, err
 	}
-	return resolve(a.items)
+	prog, starts, err := resolve(a.items)
+	if err != nil {
+		return nil, err
+	}
+	return a.sourceMap(prog, starts)
 }
 
 type assembler struct {
@@ -106,11 +127,41 @@ type assembler struct {
 
 	items []interface{}
 	buf   bytes.Buffer // current item
+	marks []mark
+
+	// For stack diagrams: the column titles of the current diagram
+	// header, the start of the line holding the last instruction
+	// marked, and the diagrams found.
+	titles   []string
+	codeLine int
+	dmarks   []dmark
+}
+
+// mark records the source of the bytecode beginning at offset off
+// within items[item].
+type mark struct {
+	item, off int
+	src       int        // offset of the source token
+	sub       *SourceMap // for quoted programs
+}
+
+// mark notes that the bytecode about to be written to a.buf (or, if
+// a.buf is empty, appended as the next item) comes from the source
+// token at offset src.
+func (a *assembler) mark(src int, sub *SourceMap) {
+	a.marks = append(a.marks, mark{
+		item: len(a.items),
+		off:  a.buf.Len(),
+		src:  src,
+		sub:  sub,
+	})
+	a.codeLine = a.scanner.lineOffset
 }
 
 func (a *assembler) next() token {
 	a.off, a.tok, a.lit = a.scanner.scan()
 	for a.tok == tokComment {
+		a.comment()
 		a.off, a.tok, a.lit = a.scanner.scan()
 	}
 	return a.tok
@@ -135,14 +186,17 @@ func (a *assembler) assembleItems() error {
 		case tokJump, tokJumpIf:
 			a.flush()
 			jmp := jump{isJumpIf: a.tok == tokJumpIf}
+			jmpOff := a.off
 
 			// must be followed with a label
 			if a.next() != tokLabel {
 				return fmt.Errorf("expected label at offset %d", a.off)
 			}
 			jmp.label = a.lit[1:]
+			a.mark(jmpOff, nil)
 			a.items = append(a.items, &jmp)
 		case tokIdent:
+			a.mark(a.off, nil)
 			if preassembled, ok := composite[a.lit]; ok {
 				a.buf.Write(preassembled)
 			} else if o, ok := op.Code(a.lit); ok {
@@ -163,8 +217,10 @@ func (a *assembler) assembleItems() error {
 }
 
 func (a *assembler) assembleValue() error {
+	start := a.off
 	switch a.tok {
 	case tokString:
+		a.mark(start, nil)
 		data := a.lit[1 : len(a.lit)-1]
 
 		op := uint64(len(data) + int(op.MinPushdata))
@@ -176,12 +232,14 @@ func (a *assembler) assembleValue() error {
 		if err != nil {
 			return errors.Wrapf(err, "offset %d", a.off)
 		}
+		a.mark(start, nil)
 		writePushdata(&a.buf, data)
 	case tokNumber:
 		signed, err := strconv.ParseInt(a.lit, 10, 64)
 		if err != nil {
 			return err
 		}
+		a.mark(start, nil)
 		writePushint64(&a.buf, signed)
 	case tokLeftBrace:
 		// assemble values until we see a right brace
@@ -200,14 +258,16 @@ func (a *assembler) assembleValue() error {
 				return err
 			}
 		}
+		a.mark(start, nil)
 		writePushint64(&a.buf, count)
 		a.buf.WriteByte(op.Tuple)
 	case tokLeftBracket:
-		prog, err := assemble(a.scanner, tokRightBracket)
+		sub, err := assemble(a.scanner, tokRightBracket)
 		if err != nil {
 			return err
 		}
-		writePushdata(&a.buf, prog)
+		a.mark(start, sub)
+		writePushdata(&a.buf, sub.Prog)
 	default:
 		return fmt.Errorf("unexpected token %q at offset %d", a.lit, a.off)
 	}
@@ -241,7 +301,9 @@ func writeVarint(buf *bytes.Buffer, v uint64) {
 	buf.Write(tmp[:n])
 }
 
-func resolve(items []interface{}) ([]byte, error) {
+// resolve returns the bytecode for items, together with the offset
+// within it of each item.
+func resolve(items []interface{}) ([]byte, []int, error) {
 	labelIdxs := make(map[string]int) // index within items of each jump label
 	for i, item := range items {
 		if l, ok := item.(string); ok {
@@ -262,7 +324,7 @@ func resolve(items []interface{}) ([]byte, error) {
 			if j, ok := item.(*jump); ok {
 				labelIdx, ok := labelIdxs[j.label]
 				if !ok {
-					return nil, fmt.Errorf("jump to unknown label $%s", j.label)
+					return nil, nil, fmt.Errorf("jump to unknown label $%s", j.label)
 				}
 				// Count the bytes of the intervening items between i and labelIdx
 				var (
@@ -316,8 +378,12 @@ func resolve(items []interface{}) ([]byte, error) {
 			}
 		}
 	}
-	var buf bytes.Buffer
-	for _, item := range items {
+	var (
+		buf    bytes.Buffer
+		starts = make([]int, len(items))
+	)
+	for i, item := range items {
+		starts[i] = buf.Len()
 		switch ii := item.(type) {
 		case []byte:
 			buf.Write(ii)
@@ -325,7 +391,7 @@ func resolve(items []interface{}) ([]byte, error) {
 			buf.Write(ii.opcodes)
 		}
 	}
-	return buf.Bytes(), nil
+	return buf.Bytes(), starts, nil
 }
 
 func pushint64(num int64) []byte {
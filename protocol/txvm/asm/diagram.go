@@ -0,0 +1,283 @@
+package asm
+
+import (
+	"regexp"
+	"strings"
+)
+
+// StackDiagram is a stack diagram written in a comment. Diagrams are
+// laid out in columns under a header comment naming them:
+//
+//	                 # Contract stack      Argument stack   Log
+//	                 # []                  [refdata v]      []
+//	get retire       # []                  [refdata]        [{"X", ...}]
+//	get              # [refdata]           []               [{"X", ...}]
+//
+// Each column after the header is a bracketed list of the items on
+// that stack, bottom first. The items are names, such as refdata;
+// literals, such as 0 or "L"; tuples, such as {p1,...,p_n}; or
+// other expressions, such as (n+3) or <prog>. The item ... stands for
+// any number of items. An item containing alternatives separated by
+// |, such as (0|maxms) or (zeroval|blockid nonce), may stand for
+// different items, or different numbers of items, at different
+// times.
+//
+// A header applies to the comments after it in the same program (not
+// including quoted programs, which have headers of their own).
+// Comments with no bracketed columns are ignored.
+type StackDiagram struct {
+	// PC is the position in the program of the state the diagram
+	// describes. If AfterCode is true, the comment follows
+	// instructions on the same line, and describes the state just
+	// after the last of them executes (so if that instruction is a
+	// jump, the diagram describes the state only when the jump is
+	// not taken). Otherwise the comment is on a line of its own (or
+	// follows only a label), and describes the state whenever
+	// execution reaches PC.
+	PC        int64
+	AfterCode bool
+
+	// Offset is the byte offset in the source of the comment. Line
+	// and Col are the same position as 1-based line and column (in
+	// bytes) numbers.
+	Offset, Line, Col int
+
+	// Stack and Args are the contract stack and argument stack
+	// columns of the diagram, or nil if it has no such column.
+	Stack, Args *DiagramColumn
+}
+
+// DiagramColumn is one column of a StackDiagram.
+type DiagramColumn struct {
+	// Text is the column as written, including its brackets.
+	Text string
+
+	// Alternatives lists the sequences of items, bottom first, that
+	// the column can stand for. There is more than one when an item
+	// contains alternatives.
+	Alternatives [][]string
+}
+
+// maxAlternatives limits the expansion of items containing
+// alternatives.
+const maxAlternatives = 64
+
+// dmark records a diagram found at offset off within items[item].
+type dmark struct {
+	item, off int
+	d         StackDiagram
+}
+
+var titleSep = regexp.MustCompile(`\s\s+|\t`)
+
+// comment handles a comment found while assembling, recording it if
+// it is a stack diagram.
+func (a *assembler) comment() {
+	text := a.lit[1:] // strip #
+	if titles := diagramTitles(text); titles != nil {
+		a.titles = titles
+		return
+	}
+	if a.titles == nil {
+		return
+	}
+	d := StackDiagram{
+		Offset:    a.off,
+		AfterCode: a.codeLine == a.scanner.lineOffset,
+	}
+	for i, col := range diagramColumns(text) {
+		if i >= len(a.titles) {
+			break
+		}
+		switch a.titles[i] {
+		case "Contract stack":
+			d.Stack = col
+		case "Argument stack":
+			d.Args = col
+		}
+	}
+	if d.Stack == nil && d.Args == nil {
+		return
+	}
+	a.dmarks = append(a.dmarks, dmark{item: len(a.items), off: a.buf.Len(), d: d})
+}
+
+// diagramTitles returns the column titles in text if it is the
+// header of a stack diagram, and nil otherwise.
+func diagramTitles(text string) []string {
+	titles := titleSep.Split(strings.TrimSpace(text), -1)
+	for _, t := range titles {
+		if t == "Contract stack" || t == "Argument stack" {
+			return titles
+		}
+	}
+	return nil
+}
+
+// diagramColumns returns the bracketed columns in text.
+func diagramColumns(text string) []*DiagramColumn {
+	var (
+		cols  []*DiagramColumn
+		depth int
+		start int
+	)
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; c {
+		case '"':
+			if j := strings.IndexByte(text[i+1:], '"'); j >= 0 {
+				i += j + 1
+			}
+		case '[', '{', '(', '<':
+			if depth == 0 {
+				if c != '[' {
+					continue // not a column
+				}
+				start = i
+			}
+			depth++
+		case ']', '}', ')', '>':
+			if depth == 0 {
+				continue
+			}
+			depth--
+			if depth == 0 {
+				col := &DiagramColumn{Text: text[start : i+1]}
+				col.Alternatives = expand(splitItems(text[start+1 : i]))
+				cols = append(cols, col)
+			}
+		}
+	}
+	return cols
+}
+
+// splitItems splits s at the spaces outside brackets and quotes.
+func splitItems(s string) []string {
+	var (
+		items []string
+		depth int
+		start = -1
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if depth == 0 && (c == ' ' || c == '\t') {
+			if start >= 0 {
+				items = append(items, s[start:i])
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+		switch c {
+		case '"':
+			if j := strings.IndexByte(s[i+1:], '"'); j >= 0 {
+				i += j + 1
+			}
+		case '\'':
+			// A quote begins a string only at the start of an item:
+			// tag' is a name.
+			if i == start {
+				if j := strings.IndexByte(s[i+1:], '\''); j >= 0 {
+					i += j + 1
+				}
+			}
+		case '[', '{', '(', '<':
+			depth++
+		case ']', '}', ')', '>':
+			if depth > 0 {
+				depth--
+			}
+		}
+	}
+	if start >= 0 {
+		items = append(items, s[start:])
+	}
+	return items
+}
+
+// expand returns the item sequences that items can stand for.
+func expand(items []string) [][]string {
+	result := [][]string{{}}
+	for _, item := range items {
+		var next [][]string
+		for _, alt := range itemAlternatives(item) {
+			for _, prefix := range result {
+				if len(next) == maxAlternatives {
+					break
+				}
+				seq := append(append([]string(nil), prefix...), alt...)
+				next = append(next, seq)
+			}
+		}
+		result = next
+	}
+	return result
+}
+
+// itemAlternatives returns the item sequences a single item can
+// stand for: only itself, unless it contains alternatives.
+func itemAlternatives(item string) [][]string {
+	parts := splitAlternatives(item)
+	if len(parts) == 1 && parenthesized(item) {
+		parts = splitAlternatives(item[1 : len(item)-1])
+	}
+	if len(parts) == 1 {
+		return [][]string{{item}}
+	}
+	var result [][]string
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if parenthesized(p) {
+			p = p[1 : len(p)-1]
+		}
+		result = append(result, expand(splitItems(p))...)
+	}
+	return result
+}
+
+// splitAlternatives splits s at the | characters outside brackets.
+func splitAlternatives(s string) []string {
+	var (
+		parts []string
+		depth int
+		start int
+	)
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[', '{', '(', '<':
+			depth++
+		case ']', '}', ')', '>':
+			if depth > 0 {
+				depth--
+			}
+		case '|':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parenthesized tells whether s is enclosed in a matching pair of
+// parentheses.
+func parenthesized(s string) bool {
+	if len(s) < 2 || s[0] != '(' || s[len(s)-1] != ')' {
+		return false
+	}
+	depth := 0
+	for i := 0; i < len(s)-1; i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
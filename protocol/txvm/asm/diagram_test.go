@@ -0,0 +1,90 @@
+package asm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiagrams(t *testing.T) {
+	const src = `# not a diagram
+            # Contract stack   Argument stack   Log
+            # []               [a b]            []
+get         # [b]              [a]
+get add     # [(a+b)]          []               [{"X", ...}]
+$x          # [(a+b)]          []
+# a remark, not a diagram
+[
+	     # Contract stack
+	     # [v]
+	drop # []
+] drop`
+
+	m, err := AssembleWithSourceMap(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type diag struct {
+		pc         int64
+		after      bool
+		line, col  int
+		stack, arg string
+	}
+	text := func(c *DiagramColumn) string {
+		if c == nil {
+			return ""
+		}
+		return c.Text
+	}
+	var got []diag
+	for _, d := range m.Diagrams {
+		got = append(got, diag{d.PC, d.AfterCode, d.Line, d.Col, text(d.Stack), text(d.Args)})
+	}
+	want := []diag{
+		{0, false, 3, 13, "[]", "[a b]"},
+		{1, true, 4, 13, "[b]", "[a]"},
+		{3, true, 5, 13, "[(a+b)]", "[]"},
+		{3, false, 6, 13, "[(a+b)]", "[]"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got diagrams:\n%v\nwant:\n%v", got, want)
+	}
+
+	sub := m.Insts[3].Sub
+	got = nil
+	for _, d := range sub.Diagrams {
+		got = append(got, diag{d.PC, d.AfterCode, d.Line, d.Col, text(d.Stack), text(d.Args)})
+	}
+	want = []diag{
+		{0, false, 10, 7, "[v]", ""},
+		{1, true, 11, 7, "[]", ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got quoted program diagrams:\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestDiagramAlternatives(t *testing.T) {
+	cases := []struct {
+		col  string
+		want [][]string
+	}{
+		{"[]", [][]string{{}}},
+		{"[a {b, c} 'x y' tag']", [][]string{{"a", "{b, c}", "'x y'", "tag'"}}},
+		{"[quorum p1 ... p_n (n+3)]", [][]string{{"quorum", "p1", "...", "p_n", "(n+3)"}}},
+		{"[a (0|maxms)]", [][]string{{"a", "0"}, {"a", "maxms"}}},
+		{"[a (zeroval|blockid nonce)]", [][]string{{"a", "zeroval"}, {"a", "blockid", "nonce"}}},
+		{"[a (zeroval 0)|(blockid maxms)]", [][]string{{"a", "zeroval", "0"}, {"a", "blockid", "maxms"}}},
+		{"[((0|maxms)==0)]", [][]string{{"((0|maxms)==0)"}}},
+	}
+	for _, c := range cases {
+		cols := diagramColumns(" " + c.col + "  [x]")
+		if len(cols) != 2 || cols[0].Text != c.col {
+			t.Errorf("%s: got columns %v", c.col, cols)
+			continue
+		}
+		if !reflect.DeepEqual(cols[0].Alternatives, c.want) {
+			t.Errorf("%s: got alternatives %q, want %q", c.col, cols[0].Alternatives, c.want)
+		}
+	}
+}
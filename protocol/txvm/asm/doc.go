@@ -30,5 +30,17 @@ that expand to longer sequences of instructions:
 Whitespace between tokens in assembler input is insignificant.
 Comments are introduced by # and continue to the end of line.
 
+AssembleWithSourceMap additionally reports the source position of
+each instruction in the assembled program, including those in quoted
+programs and macro expansions, so that a pc reported by the virtual
+machine can be traced back to a line of assembly code.
+
+Comments laid out in columns under a header naming the contract
+stack and argument stack are stack diagrams, describing the stacks
+after each line of code. AssembleWithSourceMap reports these too (see
+StackDiagram), and package
+github.com/chain/txvm/protocol/txvm/analyzer can check them against
+what the program actually does.
+
 */
 package asm
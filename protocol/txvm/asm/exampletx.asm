@@ -17,9 +17,9 @@ get               # [zeroval amount tag]                                    [ref
 get               # [zeroval amount tag quorum]                             [refdata pubkeys]                                                     [({"N", ...} {"R", ...})]
 dup 4 bury        # [quorum zeroval amount tag quorum]                      [refdata pubkeys]                                                     [({"N", ...} {"R", ...})]
 get               # [quorum zeroval amount tag quorum pubkeys]              [refdata]                                                             [({"N", ...} {"R", ...})]
-dup 5 bury        # [quorum pubkeys zeroval amount tag quorum pubkeys]      []                                                                    [({"N", ...} {"R", ...})]
-3 tuple           # [quorum pubkeys zeroval amount {tag, quorum, pubkeys}]  []                                                                    [({"N", ...} {"R", ...})]
-encode            # [quorum pubkeys zeroval amount tag']                    []                                                                    [({"N", ...} {"R", ...})]
+dup 5 bury        # [quorum pubkeys zeroval amount tag quorum pubkeys]      [refdata]                                                             [({"N", ...} {"R", ...})]
+3 tuple           # [quorum pubkeys zeroval amount {tag, quorum, pubkeys}]  [refdata]                                                             [({"N", ...} {"R", ...})]
+encode            # [quorum pubkeys zeroval amount tag']                    [refdata]                                                             [({"N", ...} {"R", ...})]
 issue             # [quorum pubkeys issuedval]                              [refdata]                                                             [({"N", ...} {"R", ...}) {"A", <caller>, amount, assetID, zeroval.anchor}]
 get log           # [quorum pubkeys issuedval]                              []                                                                    [({"N", ...} {"R", ...}) {"A", ...} {"L", <cseed>, refdata}]
 anchor            # [quorum pubkeys issuedval anchor]                       []                                                                    [({"N", ...} {"R", ...}) {"A", ...} {"L", <cseed>, refdata}]
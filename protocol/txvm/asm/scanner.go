@@ -125,7 +125,7 @@ func (s *scanner) skipWhitespace() {
 
 func (s *scanner) scanComment() string {
 	offs := s.offset - 1 // '#' already consumed
-	for s.ch != '\n' {
+	for s.ch != '\n' && s.ch >= 0 {
 		s.next()
 	}
 	return s.srcstr[offs:s.offset]
@@ -0,0 +1,158 @@
+package asm
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/chain/txvm/protocol/txvm/op"
+)
+
+// SourceMap relates the instructions of an assembled program to the
+// assembly-language source they came from.
+type SourceMap struct {
+	// Prog is the assembled program.
+	Prog []byte
+
+	// Insts has one entry for each instruction in Prog, in order.
+	Insts []SourcePos
+
+	// Diagrams are the stack diagrams in the comments of Prog's
+	// source, in order.
+	Diagrams []StackDiagram
+}
+
+// SourcePos gives the source of one instruction in an assembled
+// program.
+//
+// Every instruction produced by a single source token has that
+// token's position. So the instructions of a macro such as jump or
+// sub, and the pushdata and int instructions of a large number, all
+// have the position of the macro name or number. The count and tuple
+// instructions that end a tuple have the position of its opening
+// brace, and those of a symbolic jump have the position of the
+// jump:$label or jumpif:$label.
+type SourcePos struct {
+	// PC is the position of the instruction in its program.
+	PC int64
+
+	// Offset is the byte offset in the source of the token that
+	// produced the instruction. Line and Col are the same position
+	// as 1-based line and column (in bytes) numbers.
+	Offset, Line, Col int
+
+	// Path locates the instruction's program within quoted programs.
+	// It is empty for instructions in the top-level program.
+	// Otherwise Path[0] is the PC, in the top-level program, of the
+	// pushdata instruction that pushes the quoted program containing
+	// the instruction (or containing the quoted program containing
+	// the instruction, and so on down through Path[1] and beyond).
+	Path []int64
+
+	// Sub is the SourceMap of the quoted program pushed by this
+	// instruction, if the instruction is a pushdata produced by
+	// [...] in the source.
+	Sub *SourceMap
+}
+
+// Lookup finds the instruction at pc in prog, which is either m's
+// program or a quoted program nested within it (as when it is run by
+// a contract or exec instruction). If the same quoted program
+// appears more than once in the source, the first is used.
+func (m *SourceMap) Lookup(prog []byte, pc int64) (SourcePos, bool) {
+	m = m.find(prog)
+	if m == nil {
+		return SourcePos{}, false
+	}
+	i := sort.Search(len(m.Insts), func(i int) bool { return m.Insts[i].PC >= pc })
+	if i == len(m.Insts) || m.Insts[i].PC != pc {
+		return SourcePos{}, false
+	}
+	return m.Insts[i], true
+}
+
+func (m *SourceMap) find(prog []byte) *SourceMap {
+	if bytes.Equal(m.Prog, prog) {
+		return m
+	}
+	for _, inst := range m.Insts {
+		if inst.Sub != nil {
+			if found := inst.Sub.find(prog); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// sourceMap constructs the SourceMap for prog, given the offset of
+// each of a's items in it.
+func (a *assembler) sourceMap(prog []byte, starts []int) (*SourceMap, error) {
+	m := &SourceMap{Prog: prog}
+	marks := a.marks
+	for pc := 0; pc < len(prog); {
+		_, _, n, err := op.DecodeInst(prog[pc:])
+		if err != nil {
+			return nil, err
+		}
+		for len(marks) > 1 && starts[marks[1].item]+marks[1].off <= pc {
+			marks = marks[1:]
+		}
+		pos := SourcePos{PC: int64(pc)}
+		if len(marks) > 0 {
+			mk := marks[0]
+			pos.Offset = mk.src
+			if mk.sub != nil && starts[mk.item]+mk.off == pc {
+				pos.Sub = mk.sub
+			}
+		}
+		m.Insts = append(m.Insts, pos)
+		pc += int(n)
+	}
+	for _, dm := range a.dmarks {
+		d := dm.d
+		d.PC = int64(len(prog))
+		if dm.item < len(starts) {
+			d.PC = int64(starts[dm.item] + dm.off)
+		}
+		m.Diagrams = append(m.Diagrams, d)
+	}
+	return m, nil
+}
+
+// setPositions fills in the Line, Col, and Path fields of the
+// instructions in m and its quoted programs, and the Line and Col
+// fields of their diagrams.
+func (m *SourceMap) setPositions(lines lineTable, path []int64) {
+	for i := range m.Diagrams {
+		d := &m.Diagrams[i]
+		d.Line, d.Col = lines.position(d.Offset)
+	}
+	for i := range m.Insts {
+		inst := &m.Insts[i]
+		inst.Line, inst.Col = lines.position(inst.Offset)
+		inst.Path = path
+		if inst.Sub != nil {
+			subpath := append(path[:len(path):len(path)], inst.PC)
+			inst.Sub.setPositions(lines, subpath)
+		}
+	}
+}
+
+// lineTable holds the offset of the start of each line in a source
+// string.
+type lineTable []int
+
+func newLineTable(s string) lineTable {
+	t := lineTable{0}
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\n' {
+			t = append(t, i+1)
+		}
+	}
+	return t
+}
+
+func (t lineTable) position(offset int) (line, col int) {
+	i := sort.SearchInts(t, offset+1) - 1
+	return i + 1, offset - t[i] + 1
+}
@@ -0,0 +1,90 @@
+package asm
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestSourceMap(t *testing.T) {
+	const src = `# comment
+1 jump:$a
+$a 100 sub
+[2 [splitzero] exec] contract
+{3, 'x'}`
+
+	m, err := AssembleWithSourceMap(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Assemble(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(m.Prog, want) {
+		t.Fatalf("got program %x, want %x", m.Prog, want)
+	}
+
+	type pos struct {
+		pc, line, col int
+		path          []int64
+	}
+	var got []pos
+	var walk func(m *SourceMap)
+	walk = func(m *SourceMap) {
+		for _, inst := range m.Insts {
+			got = append(got, pos{int(inst.PC), inst.Line, inst.Col, inst.Path})
+			if inst.Sub != nil {
+				walk(inst.Sub)
+			}
+		}
+	}
+	walk(m)
+
+	wantPos := []pos{
+		{0, 2, 1, nil},           // 1
+		{1, 2, 3, nil},           // jump:$a (1)
+		{2, 2, 3, nil},           // jump:$a (0)
+		{3, 2, 3, nil},           // jump:$a (jumpif)
+		{4, 3, 4, nil},           // 100 (pushdata)
+		{6, 3, 4, nil},           // 100 (int)
+		{7, 3, 8, nil},           // sub (neg)
+		{8, 3, 8, nil},           // sub (add)
+		{9, 4, 1, nil},           // [...]
+		{0, 4, 2, []int64{9}},    // 2
+		{1, 4, 4, []int64{9}},    // [splitzero]
+		{0, 4, 5, []int64{9, 1}}, // splitzero (0)
+		{1, 4, 5, []int64{9, 1}}, // splitzero (split)
+		{4, 4, 16, []int64{9}},   // exec
+		{15, 4, 22, nil},         // contract
+		{16, 5, 2, nil},          // 3
+		{17, 5, 5, nil},          // 'x'
+		{19, 5, 1, nil},          // {} (2)
+		{20, 5, 1, nil},          // {} (tuple)
+	}
+	if !reflect.DeepEqual(got, wantPos) {
+		t.Errorf("got positions:\n%v\nwant:\n%v", got, wantPos)
+	}
+
+	sub := m.Insts[8].Sub.Insts[1].Sub
+	inst, ok := m.Lookup(sub.Prog, 1)
+	if !ok || inst.Line != 4 || inst.Col != 5 {
+		t.Errorf("Lookup(%x, 1) = %+v, %v; want line 4 col 5", sub.Prog, inst, ok)
+	}
+	if _, ok := m.Lookup(sub.Prog, 2); ok {
+		t.Errorf("Lookup(%x, 2) found an instruction, want none", sub.Prog)
+	}
+	if _, ok := m.Lookup([]byte{0xff}, 0); ok {
+		t.Error("Lookup of unknown program found an instruction, want none")
+	}
+}
+
+func TestCommentAtEOF(t *testing.T) {
+	prog, err := Assemble("verify # no newline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prog) != 1 {
+		t.Errorf("got %x, want a single verify", prog)
+	}
+}
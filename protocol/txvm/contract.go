@@ -144,13 +144,6 @@ func opPut(vm *VM) {
 	vm.argstack.push(item)
 }
 
-func opExt(vm *VM) {
-	if !vm.extension {
-		panic(errors.Wrap(ErrExt, "ext"))
-	}
-	_ = vm.popData()
-}
-
 func opPrv(vm *VM) {
 	panic(ErrPrv)
 }
@@ -59,29 +59,57 @@ func opCheckSig(vm *VM) {
 		vm.pushBool(false)
 		return
 	}
-	vm.charge(2048)
 	// Ed25519 signatures have scheme Int(0).
 	if schemeint, ok := scheme.(Int); ok && schemeint == 0 {
-		checkEd25519(msg, pubkey, sig)
+		vm.charge(2048)
+		vm.checkEd25519(msg, pubkey, sig)
+	} else if s, ok := vm.checkSigSchemes[string(Encode(scheme))]; ok {
+		vm.charge(s.cost)
+		err := s.f(msg, pubkey, sig)
+		if err != nil {
+			panic(errors.Wrapf(err, "checksig scheme %s", scheme))
+		}
 	} else if !vm.extension {
 		panic(errors.Wrapf(ErrExt, "checksig cannot validate unknown signature scheme %s", scheme.String()))
-	} // else vm.extension==true, so accept unknown schemes as valid
+	} else {
+		// vm.extension==true, so accept unknown schemes as valid
+		vm.charge(2048)
+	}
 	vm.pushBool(true)
 }
 
-func checkEd25519(msg, pubkey, sig Bytes) {
+func (vm *VM) checkEd25519(msg, pubkey, sig Bytes) {
 	if len(sig) != ed25519.SignatureSize {
 		panic(errors.WithData(ErrSigSize, "got", len(sig), "want", ed25519.SignatureSize))
 	}
 	if len(pubkey) != ed25519.PublicKeySize {
 		panic(errors.WithData(ErrPubSize, "got", len(pubkey), "want", ed25519.PublicKeySize))
 	}
+	if vm.deferredSigs != nil {
+		vm.deferredSigs.Add(ed25519.PublicKey(pubkey), msg, sig)
+		return
+	}
 	valid := ed25519.Verify(ed25519.PublicKey(pubkey), msg, sig)
 	if !valid {
 		panic(errors.WithData(ErrSignature, "signature", []byte(sig), "message", []byte(msg), "public key", []byte(pubkey)))
 	}
 }
 
+// verifyDeferredSigs verifies the signatures deferred by the
+// ConcurrentVerify option, if any.
+func (vm *VM) verifyDeferredSigs() error {
+	if vm.deferredSigs == nil || vm.deferredSigs.Len() == 0 {
+		return nil
+	}
+	n := vm.deferredSigs.Len()
+	valid := vm.deferredSigs.Verify()
+	vm.deferredSigs = new(ed25519.ConcurrentVerifier)
+	if !valid {
+		return vm.wraperr(errors.WithData(ErrSignature, "signatures", n))
+	}
+	return nil
+}
+
 // VMHash computes the hash of the "function" f applied to the byte string x.
 func VMHash(f string, x []byte) (hash [32]byte) {
 	sha3.CShakeSum128(hash[:], x, nil, []byte("ChainVM."+f))
@@ -5,6 +5,10 @@ import (
 	"encoding/hex"
 	"fmt"
 	"testing"
+
+	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/txvm/op"
 )
 
 func TestVMHash(t *testing.T) {
@@ -27,3 +31,52 @@ func TestVMHash(t *testing.T) {
 		})
 	}
 }
+
+func TestConcurrentVerify(t *testing.T) {
+	// sigProg returns a program checking n signatures, the last of
+	// which is invalid if bad is true.
+	sigProg := func(n int, bad bool) []byte {
+		var buf bytes.Buffer
+		for i := 0; i < n; i++ {
+			pub, priv, err := ed25519.GenerateKey(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg := []byte(fmt.Sprintf("message %d", i))
+			sig := ed25519.Sign(priv, msg)
+			if bad && i == n-1 {
+				msg = []byte("wrong message")
+			}
+			Bytes(msg).encode(&buf)
+			Bytes(pub).encode(&buf)
+			Bytes(sig).encode(&buf)
+			Int(0).encode(&buf)
+			buf.WriteByte(op.CheckSig)
+			buf.WriteByte(op.Verify)
+		}
+		return buf.Bytes()
+	}
+
+	for _, n := range []int{1, 5} {
+		_, err := Validate(sigProg(n, false), 3, 100000, ConcurrentVerify)
+		if err != nil {
+			t.Errorf("%d valid signatures: got error %s", n, err)
+		}
+
+		// Without ConcurrentVerify, the bad signature stops execution at
+		// the checksig; with it, execution continues to the end.
+		var steps, deferredSteps int
+		prog := sigProg(n, true)
+		_, err = Validate(prog, 3, 100000, AfterStep(func(*VM) { steps++ }))
+		if errors.Root(err) != ErrSignature {
+			t.Errorf("%d signatures, one bad: got error %v, want %s", n, err, ErrSignature)
+		}
+		_, err = Validate(prog, 3, 100000, ConcurrentVerify, AfterStep(func(*VM) { deferredSteps++ }))
+		if errors.Root(err) != ErrSignature {
+			t.Errorf("%d signatures, one bad, deferred: got error %v, want %s", n, err, ErrSignature)
+		}
+		if deferredSteps != steps+2 {
+			t.Errorf("%d signatures, one bad: got %d steps deferred and %d not, want a difference of 2", n, deferredSteps, steps)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+/*
+Package debugger implements an interactive, step-through debugger
+for txvm programs.
+
+A Debugger runs a program in the txvm virtual machine in a separate
+goroutine, pausing it before selected instructions by way of the
+txvm.BeforeStep hook. While the VM is paused, its state — the
+current program and position, the contract and argument stacks,
+the current contract seed, and the transaction log — can be
+inspected in the State returned by each command.
+
+Typical use:
+
+	d := debugger.New(prog, 3, math.MaxInt64)
+	d.BreakOn(op.Call)
+	st, err := d.Start() // pauses before the first instruction
+	for st != nil {
+		fmt.Println(st.PC, st.Instruction)
+		st = d.StepOver()
+	}
+	vm, err := d.Result()
+
+Stepping commands return nil when the program has finished
+running, after which Result reports the outcome.
+
+A Debugger is not safe for concurrent use.
+*/
+package debugger
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/chain/txvm/protocol/txvm"
+	"github.com/chain/txvm/protocol/txvm/asm"
+	"github.com/chain/txvm/protocol/txvm/op"
+)
+
+// ErrRunning is returned by Result when the program has not run
+// to completion.
+var ErrRunning = errors.New("program has not finished running")
+
+// State is a snapshot of the VM, taken before the instruction at PC
+// in Program executes.
+type State struct {
+	// Depth is the number of programs suspended by call and exec
+	// instructions. It is 0 in the transaction program itself.
+	Depth int
+
+	// Program is the program being executed at this depth, and PC
+	// is the position in it of the next instruction.
+	Program []byte
+	PC      int64
+
+	// OpCode and Data are the decoded next instruction; Data is
+	// set only for pushdata instructions.
+	OpCode byte
+	Data   []byte
+
+	// Instruction is a textual rendering of the next instruction.
+	Instruction string
+
+	// Source is the result of the Debugger's Source function for
+	// Program and PC, if there is one.
+	Source string
+
+	// Seed is the seed of the current contract.
+	Seed []byte
+
+	// Runlimit is the runlimit remaining.
+	Runlimit int64
+
+	// Stack and ArgStack hold "inspected" copies of the items on
+	// the current contract's stack and on the argument stack,
+	// bottom first.
+	Stack    []txvm.Data
+	ArgStack []txvm.Data
+
+	// Log is the transaction log so far.
+	Log []txvm.Tuple
+}
+
+type stopFunc func(*txvm.VM) bool
+
+type pcBreak struct {
+	prog []byte // nil matches any program
+	pc   int64
+}
+
+// Debugger controls the execution of one txvm program.
+type Debugger struct {
+	// Source, if set, is called for each State with its Program
+	// and PC, and its result is stored in the State's Source
+	// field. It can be used to show the assembly-language source
+	// for the instruction.
+	Source func(prog []byte, pc int64) string
+
+	prog              []byte
+	version, runlimit int64
+	opts              []txvm.Option
+
+	breakPCs []pcBreak
+	breakOps map[byte]bool
+
+	// These are used to hand control back and forth between the
+	// caller and the goroutine running the VM. Each side reads and
+	// writes the fields below only while the other is blocked.
+	resume   chan stopFunc
+	stopped  chan *State
+	stop     stopFunc
+	detached bool
+
+	started, done bool
+	state         *State
+	vm            *txvm.VM
+	err           error
+}
+
+// New returns a Debugger for the given program, which will be run
+// with the given transaction version and runlimit and any additional
+// VM options.
+func New(prog []byte, version, runlimit int64, opts ...txvm.Option) *Debugger {
+	return &Debugger{
+		prog:     prog,
+		version:  version,
+		runlimit: runlimit,
+		opts:     opts,
+		breakOps: make(map[byte]bool),
+	}
+}
+
+// BreakAt sets a breakpoint before the instruction at pc in prog.
+// If prog is nil, the breakpoint applies at pc in every program:
+// the transaction program and any program run by call or exec.
+func (d *Debugger) BreakAt(prog []byte, pc int64) {
+	d.breakPCs = append(d.breakPCs, pcBreak{prog: prog, pc: pc})
+}
+
+// BreakOn sets a breakpoint before every instruction with the given
+// opcode.
+func (d *Debugger) BreakOn(opcode byte) {
+	d.breakOps[opcode] = true
+}
+
+// ClearBreakpoints removes all breakpoints.
+func (d *Debugger) ClearBreakpoints() {
+	d.breakPCs = nil
+	d.breakOps = make(map[byte]bool)
+}
+
+// Start begins running the program, pausing before the first
+// instruction. It returns the State at that point, or nil if the
+// program finished without executing any instructions.
+func (d *Debugger) Start() (*State, error) {
+	if d.started {
+		return nil, errors.New("debugger already started")
+	}
+	d.started = true
+	d.resume = make(chan stopFunc)
+	d.stopped = make(chan *State)
+	d.stop = func(*txvm.VM) bool { return true }
+
+	go func() {
+		opts := append([]txvm.Option{txvm.BeforeStep(d.beforeStep)}, d.opts...)
+		d.vm, d.err = txvm.Validate(d.prog, d.version, d.runlimit, opts...)
+		close(d.stopped)
+	}()
+	return d.wait(), nil
+}
+
+func (d *Debugger) beforeStep(vm *txvm.VM) {
+	if d.detached || !(d.stop(vm) || d.atBreakpoint(vm)) {
+		return
+	}
+	d.stopped <- d.snapshot(vm)
+	d.stop = <-d.resume
+}
+
+func (d *Debugger) atBreakpoint(vm *txvm.VM) bool {
+	if d.breakOps[vm.OpCode()] {
+		return true
+	}
+	for _, b := range d.breakPCs {
+		if b.pc == vm.PC() && (b.prog == nil || bytes.Equal(b.prog, vm.Program())) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Debugger) snapshot(vm *txvm.VM) *State {
+	s := &State{
+		Depth:       vm.RunDepth(),
+		Program:     vm.Program(),
+		PC:          vm.PC(),
+		OpCode:      vm.OpCode(),
+		Instruction: InstructionAt(vm.Program(), vm.PC()),
+		Seed:        vm.Seed(),
+		Runlimit:    vm.Runlimit(),
+		Log:         append([]txvm.Tuple(nil), vm.Log...),
+	}
+	if op.IsPushdataOp(s.OpCode) {
+		s.Data = vm.Data()
+	}
+	if d.Source != nil {
+		s.Source = d.Source(s.Program, s.PC)
+	}
+	for i := 0; i < vm.StackLen(); i++ {
+		s.Stack = append(s.Stack, vm.StackItem(i))
+	}
+	for i := 0; i < vm.ArgStackLen(); i++ {
+		s.ArgStack = append(s.ArgStack, vm.ArgStackItem(i))
+	}
+	return s
+}
+
+// wait waits for the VM to pause or finish and returns the
+// resulting State, or nil if it finished.
+func (d *Debugger) wait() *State {
+	s, ok := <-d.stopped
+	if !ok {
+		d.done = true
+		d.state = nil
+		return nil
+	}
+	d.state = s
+	return s
+}
+
+func (d *Debugger) run(f stopFunc) *State {
+	if !d.started || d.done {
+		return nil
+	}
+	d.resume <- f
+	return d.wait()
+}
+
+// State returns the State at which the VM is paused, or nil if it is
+// not paused.
+func (d *Debugger) State() *State {
+	return d.state
+}
+
+// Step executes one instruction and pauses before the next,
+// following call and exec into the programs they run.
+func (d *Debugger) Step() *State {
+	return d.run(func(*txvm.VM) bool { return true })
+}
+
+// StepOver executes one instruction and pauses before the next one
+// at the same depth or shallower, so that call and exec run to
+// completion (unless a breakpoint intervenes).
+func (d *Debugger) StepOver() *State {
+	if d.state == nil {
+		return nil
+	}
+	depth := d.state.Depth
+	return d.run(func(vm *txvm.VM) bool { return vm.RunDepth() <= depth })
+}
+
+// StepOut runs until the current program returns to the one that
+// ran it (unless a breakpoint intervenes).
+func (d *Debugger) StepOut() *State {
+	if d.state == nil {
+		return nil
+	}
+	depth := d.state.Depth
+	return d.run(func(vm *txvm.VM) bool { return vm.RunDepth() < depth })
+}
+
+// Continue runs until the next breakpoint or the end of the
+// program.
+func (d *Debugger) Continue() *State {
+	return d.run(func(*txvm.VM) bool { return false })
+}
+
+// Finish runs the program to completion, ignoring breakpoints.
+func (d *Debugger) Finish() {
+	if !d.started || d.done {
+		return
+	}
+	d.detached = true
+	d.resume <- nil
+	for d.wait() != nil {
+	}
+}
+
+// Result returns the VM and error produced by txvm.Validate once the
+// program has finished running.
+func (d *Debugger) Result() (*txvm.VM, error) {
+	if !d.done {
+		return nil, ErrRunning
+	}
+	return d.vm, d.err
+}
+
+// InstructionAt returns a textual rendering of the instruction at pc
+// in prog. A pushdata instruction whose data is a program run by the
+// following instruction is rendered as a quoted program, as in the
+// assembly language.
+func InstructionAt(prog []byte, pc int64) string {
+	if pc < 0 || pc >= int64(len(prog)) {
+		return ""
+	}
+	opcode, data, n, err := op.DecodeInst(prog[pc:])
+	if err != nil {
+		return fmt.Sprintf("<%s>", err)
+	}
+	switch {
+	case op.IsSmallIntOp(opcode):
+		return strconv.Itoa(int(opcode - op.MinSmallInt))
+	case op.IsPushdataOp(opcode):
+		if next := pc + n; next < int64(len(prog)) {
+			switch prog[next] {
+			case op.Contract, op.Exec, op.Wrap, op.Yield, op.Output:
+				if dis, err := asm.Disassemble(data); err == nil {
+					return "[" + dis + "]"
+				}
+			}
+		}
+		return txvm.Bytes(data).String()
+	}
+	return op.Name(opcode)
+}
+
+// Line is one instruction in a program listing.
+type Line struct {
+	PC          int64
+	Instruction string
+}
+
+// Listing returns the instructions of prog, one per Line.
+func Listing(prog []byte) ([]Line, error) {
+	var lines []Line
+	for pc := int64(0); pc < int64(len(prog)); {
+		_, _, n, err := op.DecodeInst(prog[pc:])
+		if err != nil {
+			return lines, err
+		}
+		lines = append(lines, Line{PC: pc, Instruction: InstructionAt(prog, pc)})
+		pc += n
+	}
+	return lines, nil
+}
@@ -0,0 +1,142 @@
+package debugger
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/chain/txvm/protocol/txvm/asm"
+	"github.com/chain/txvm/protocol/txvm/op"
+)
+
+const testSrc = "[1 2 add drop] exec 3 4 add drop"
+
+func start(t *testing.T, d *Debugger) *State {
+	st, err := d.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st == nil {
+		t.Fatal("program finished before its first instruction")
+	}
+	return st
+}
+
+func checkAt(t *testing.T, st *State, depth int, instruction string) {
+	t.Helper()
+	if st == nil {
+		t.Fatalf("program finished, want depth %d at %s", depth, instruction)
+	}
+	if st.Depth != depth || st.Instruction != instruction {
+		t.Fatalf("at depth %d pc %d (%s), want depth %d at %s", st.Depth, st.PC, st.Instruction, depth, instruction)
+	}
+}
+
+func finish(t *testing.T, d *Debugger, st *State) {
+	t.Helper()
+	if st != nil {
+		t.Fatalf("stopped at depth %d pc %d (%s), want end of program", st.Depth, st.PC, st.Instruction)
+	}
+	_, err := d.Result()
+	if err != nil {
+		t.Fatalf("program failed: %v", err)
+	}
+}
+
+func TestStep(t *testing.T) {
+	d := New(asm.MustAssemble(testSrc), 3, 10000)
+	st := start(t, d)
+	checkAt(t, st, 0, "[1 2 add drop]")
+
+	st = d.Step()
+	checkAt(t, st, 0, "exec")
+	st = d.Step()
+	checkAt(t, st, 1, "1")
+	if st.PC != 0 {
+		t.Errorf("pc in nested program = %d, want 0", st.PC)
+	}
+	st = d.Step()
+	st = d.Step()
+	checkAt(t, st, 1, "add")
+	if len(st.Stack) != 2 || fmt.Sprint(st.Stack[1]) != "{'Z', 2}" {
+		t.Errorf("stack before add = %v, want [1 2]", st.Stack)
+	}
+
+	st = d.StepOut()
+	checkAt(t, st, 0, "3")
+
+	finish(t, d, d.Continue())
+}
+
+func TestStepOver(t *testing.T) {
+	d := New(asm.MustAssemble(testSrc), 3, 10000)
+	start(t, d)
+	st := d.StepOver()
+	checkAt(t, st, 0, "exec")
+	st = d.StepOver()
+	checkAt(t, st, 0, "3")
+}
+
+func TestBreakpoints(t *testing.T) {
+	prog := asm.MustAssemble(testSrc)
+	d := New(prog, 3, 10000)
+	d.BreakOn(op.Add)
+	start(t, d)
+
+	st := d.Continue()
+	checkAt(t, st, 1, "add")
+	st = d.Continue()
+	checkAt(t, st, 0, "add")
+
+	d.ClearBreakpoints()
+	finish(t, d, d.Continue())
+
+	// A pc breakpoint restricted to the transaction program does not
+	// fire in the nested program.
+	d = New(prog, 3, 10000)
+	d.BreakAt(prog, 9)
+	start(t, d)
+	st = d.Continue()
+	if st == nil || st.Depth != 0 || st.PC != 9 {
+		t.Fatalf("stopped at %+v, want depth 0 pc 9", st)
+	}
+
+	d = New(prog, 3, 10000)
+	d.BreakAt(nil, 2)
+	start(t, d)
+	st = d.Continue()
+	checkAt(t, st, 1, "add")
+}
+
+func TestFinish(t *testing.T) {
+	d := New(asm.MustAssemble("1"), 3, 10000)
+	d.BreakOn(op.Add)
+	start(t, d)
+	d.Finish()
+	_, err := d.Result()
+	if err == nil {
+		t.Error("got no residue error")
+	}
+	if d.Step() != nil {
+		t.Error("Step after Finish returned a state")
+	}
+}
+
+func TestListing(t *testing.T) {
+	lines, err := Listing(asm.MustAssemble(testSrc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, l := range lines {
+		got = append(got, l.Instruction)
+	}
+	want := []string{"[1 2 add drop]", "exec", "3", "4", "add", "drop"}
+	if len(got) != len(want) {
+		t.Fatalf("listing = %q, want %q", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("listing line %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
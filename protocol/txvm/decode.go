@@ -0,0 +1,132 @@
+package txvm
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+
+	"github.com/chain/txvm/protocol/txvm/op"
+)
+
+// inst is a decoded instruction.
+type inst struct {
+	opcode byte
+	data   []byte // immediate data, for a pushdata instruction
+	n      int64  // length of the encoded instruction
+}
+
+// decodedProg is a program decoded into instructions. A program can
+// jump into the middle of an instruction, so its instructions cannot
+// all be known in advance; the index holds the ones found by decoding
+// from the beginning to the end (or to the first instruction that
+// does not decode), and inst decodes any other on demand.
+//
+// A decodedProg is immutable once built, so it can be shared by VMs
+// running concurrently. Its instructions' data slices refer to buf,
+// and the VM pushes them as they are, relying on Bytes never being
+// modified; their capacity ends with the data, so that appending to
+// one cannot write into buf either.
+type decodedProg struct {
+	buf   []byte
+	insts []inst
+	at    []int32 // at[pc] is 1 plus the index in insts of the instruction at pc, or 0
+}
+
+// decodeProg decodes prog, building the index if index is true. The
+// index is worth building only for programs that run many times,
+// which are cached, so with an index the decodedProg has its own
+// copy of prog; without one it refers to prog itself.
+func decodeProg(prog []byte, index bool) *decodedProg {
+	if !index || len(prog) > math.MaxInt32 {
+		return &decodedProg{buf: prog}
+	}
+	d := &decodedProg{buf: append([]byte(nil), prog...)}
+	d.at = make([]int32, len(prog))
+	for pc := int64(0); pc < int64(len(d.buf)); {
+		in, err := decodeInst(d.buf, pc)
+		if err != nil {
+			break
+		}
+		d.insts = append(d.insts, in)
+		d.at[pc] = int32(len(d.insts))
+		pc += in.n
+	}
+	return d
+}
+
+// inst returns the instruction at pc, which must be in range.
+func (d *decodedProg) inst(pc int64) inst {
+	if d.at != nil {
+		if i := d.at[pc]; i > 0 {
+			return d.insts[i-1]
+		}
+	}
+	in, err := decodeInst(d.buf, pc)
+	if err != nil {
+		panic(vmError(err))
+	}
+	return in
+}
+
+// decodeInst is like op.DecodeInst, but decodes the instruction at pc
+// in prog, and its data refers to prog rather than to a copy.
+func decodeInst(prog []byte, pc int64) (inst, error) {
+	opcode, n := binary.Uvarint(prog[pc:])
+	if n <= 0 || opcode >= uint64(op.MinPushdata) {
+		l := opcode - uint64(op.MinPushdata)
+		r := uint64(pc) + uint64(n) + l
+		if n <= 0 || r > uint64(len(prog)) || r < uint64(pc) {
+			// Let op.DecodeInst describe the problem.
+			_, _, _, err := op.DecodeInst(prog[pc:])
+			return inst{}, err
+		}
+		return inst{opcode: op.MinPushdata, data: prog[pc+int64(n) : r : r], n: int64(r) - pc}, nil
+	}
+	return inst{opcode: byte(opcode), n: int64(n)}, nil
+}
+
+// progCache holds decoded programs, keyed by their bytes, so that
+// contracts that run often (the standard ones, for instance) are
+// decoded only once. It is bounded by the total length of the
+// programs in it, and evicts arbitrary entries to make room.
+var progCache = decodeCache{max: 1 << 22}
+
+type decodeCache struct {
+	mu   sync.RWMutex
+	m    map[string]*decodedProg
+	size int
+	max  int
+}
+
+func (c *decodeCache) get(prog []byte) *decodedProg {
+	c.mu.RLock()
+	d := c.m[string(prog)]
+	c.mu.RUnlock()
+	if d != nil {
+		return d
+	}
+
+	d = decodeProg(prog, true)
+	if len(prog) > c.max {
+		return d
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if other := c.m[string(prog)]; other != nil {
+		return other
+	}
+	if c.m == nil {
+		c.m = make(map[string]*decodedProg)
+	}
+	for k := range c.m {
+		if c.size+len(prog) <= c.max {
+			break
+		}
+		c.size -= len(k)
+		delete(c.m, k)
+	}
+	c.m[string(prog)] = d
+	c.size += len(prog)
+	return d
+}
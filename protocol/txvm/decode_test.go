@@ -0,0 +1,104 @@
+package txvm
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/chain/txvm/protocol/txvm/op"
+)
+
+func TestDecodeProg(t *testing.T) {
+	progs := [][]byte{
+		nil,
+		{op.MinSmallInt + 1, op.MinSmallInt + 2, op.Add},
+		{op.MinPushdata + 3, 1, 2, 3, op.MinPushdata, op.Drop},
+		{op.MinPushdata + 3, op.MinSmallInt, op.Drop, op.Verify, op.Verify},
+		{op.MinSmallInt, op.MinPushdata + 5, 1, 2}, // truncated pushdata
+		{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	}
+	for _, prog := range progs {
+		for _, index := range []bool{false, true} {
+			checkDecodeProg(t, prog, decodeProg(prog, index))
+		}
+	}
+}
+
+func checkDecodeProg(t *testing.T, prog []byte, d *decodedProg) {
+	t.Helper()
+	for pc := int64(0); pc < int64(len(prog)); pc++ {
+		wantOp, wantData, wantN, wantErr := op.DecodeInst(prog[pc:])
+		var (
+			got inst
+			err error
+		)
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					err = r.(vmError)
+				}
+			}()
+			got = d.inst(pc)
+		}()
+		if (err != nil) != (wantErr != nil) {
+			t.Errorf("%x pc %d: got error %v, want %v", prog, pc, err, wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got.opcode != wantOp || !bytes.Equal(got.data, wantData) || got.n != wantN {
+			t.Errorf("%x pc %d: got (%d, %x, %d), want (%d, %x, %d)", prog, pc, got.opcode, got.data, got.n, wantOp, wantData, wantN)
+		}
+		if cap(got.data) != len(got.data) {
+			t.Errorf("%x pc %d: data has spare capacity", prog, pc)
+		}
+	}
+}
+
+func TestDecodeCache(t *testing.T) {
+	c := decodeCache{max: 10}
+	prog := []byte{op.MinSmallInt, op.MinSmallInt, op.Add, op.Drop}
+	d := c.get(prog)
+	prog[0] = op.Verify
+	if got := d.inst(0).opcode; got != op.MinSmallInt {
+		t.Errorf("decoded program changed with its source, got opcode %d", got)
+	}
+	if c.get([]byte{op.MinSmallInt, op.MinSmallInt, op.Add, op.Drop}) != d {
+		t.Error("got a new decoding of a cached program")
+	}
+	for i := byte(0); i < 10; i++ {
+		c.get([]byte{op.MinSmallInt + i, op.Drop, op.MinSmallInt})
+		if c.size > c.max {
+			t.Fatalf("cache size %d exceeds max %d", c.size, c.max)
+		}
+	}
+	c.get(make([]byte, 11))
+	if c.size > c.max {
+		t.Errorf("cache size %d exceeds max %d", c.size, c.max)
+	}
+}
+
+func TestPushdataShared(t *testing.T) {
+	// The program run by exec is decoded through progCache, and the
+	// items it pushes refer to the cached decoding rather than to
+	// copies.
+	inner := []byte{op.MinPushdata + 3, 'a', 'b', 'c', op.Log}
+	prog := append([]byte{op.MinPushdata + byte(len(inner))}, inner...)
+	prog = append(prog, op.Exec)
+	for i := 0; i < 2; i++ {
+		vm, err := Validate(prog, 3, 10000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(vm.Log) != 1 {
+			t.Fatalf("run %d: got %d log entries, want 1", i, len(vm.Log))
+		}
+		logged := vm.Log[0][2].(Bytes)
+		if string(logged) != "abc" {
+			t.Fatalf("run %d: logged %q, want \"abc\"", i, logged)
+		}
+		if &logged[0] != &progCache.get(inner).buf[1] {
+			t.Errorf("run %d: logged item is a copy of the cached pushdata", i)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package txvm
+
+import (
+	"math"
+
+	"github.com/chain/txvm/protocol/txvm/op"
+)
+
+// RunlimitEstimate describes the runlimit consumed by a transaction
+// program. Nothing a program does depends on its runlimit, except
+// whether it runs out, so a program that runs to completion with
+// some runlimit consumes the same amount with any other runlimit
+// that is large enough.
+type RunlimitEstimate struct {
+	// Runlimit is the smallest runlimit with which the program runs
+	// to completion: Used, or the length of the program if that is
+	// greater (since Validate rejects a program longer than its
+	// runlimit).
+	Runlimit int64
+
+	// Used is the total runlimit consumed.
+	Used int64
+
+	// BeforeFinalize and AfterFinalize divide Used between the
+	// instructions up to and including finalize and the ones after
+	// it. If the program does not finalize, AfterFinalize is 0.
+	BeforeFinalize, AfterFinalize int64
+
+	// CheckSig is the part of Used consumed by checksig
+	// instructions, in either phase.
+	CheckSig int64
+}
+
+// GetRunlimitEstimate can be passed as an option to Validate. It
+// causes the vm to write a breakdown of the runlimit it consumed to
+// the given pointer on exit. It can be combined with Resumer, in
+// which case the estimate is written once when execution stops after
+// finalize and again when it is resumed and completes, but note that
+// the estimate's Runlimit then reflects only the length of the
+// program passed to Validate.
+func GetRunlimitEstimate(e *RunlimitEstimate) Option {
+	return Option{
+		apply: func(vm *VM) {
+			var (
+				start     = vm.runlimit
+				progLen   = int64(len(vm.contract.program))
+				finalized bool
+				atFinal   int64 // runlimit remaining after finalize
+				sigStart  int64
+			)
+			*e = RunlimitEstimate{}
+			vm.beforeStep = append(vm.beforeStep, func(vm *VM) {
+				if vm.opcode == op.CheckSig {
+					sigStart = vm.runlimit
+				}
+			})
+			vm.afterStep = append(vm.afterStep, func(vm *VM) {
+				if vm.opcode == op.CheckSig {
+					e.CheckSig += sigStart - vm.runlimit
+				}
+			})
+			vm.onFinalize = append(vm.onFinalize, func(vm *VM) {
+				finalized = true
+				atFinal = vm.runlimit
+			})
+			vm.onExit = append(vm.onExit, func(vm *VM) {
+				e.Used = start - vm.runlimit
+				e.BeforeFinalize, e.AfterFinalize = e.Used, 0
+				if finalized {
+					e.BeforeFinalize = start - atFinal
+					e.AfterFinalize = atFinal - vm.runlimit
+				}
+				e.Runlimit = e.Used
+				if progLen > e.Runlimit {
+					e.Runlimit = progLen
+				}
+			})
+		},
+	}
+}
+
+// EstimateRunlimit runs prog, with the given transaction version and
+// options, with the largest possible runlimit, to find the runlimit
+// it needs. It returns an error if the program fails.
+func EstimateRunlimit(prog []byte, txVersion int64, o ...Option) (*RunlimitEstimate, error) {
+	e := new(RunlimitEstimate)
+	o = append(o[:len(o):len(o)], GetRunlimitEstimate(e))
+	_, err := Validate(prog, txVersion, math.MaxInt64, o...)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
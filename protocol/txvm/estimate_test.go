@@ -0,0 +1,65 @@
+package txvm_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/txvm"
+	"github.com/chain/txvm/protocol/txvm/asm"
+)
+
+func TestEstimateRunlimit(t *testing.T) {
+	pub, prv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte("message")
+	sig := ed25519.Sign(prv, msg)
+	src := fmt.Sprintf("'blockid' 10 nonce finalize x'%x' x'%x' x'%x' 0 checksig verify", msg, pub, sig)
+	prog, err := asm.Assemble(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := txvm.EstimateRunlimit(prog, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.BeforeFinalize+e.AfterFinalize != e.Used || e.Runlimit != e.Used {
+		t.Errorf("got inconsistent estimate %+v", e)
+	}
+	if e.BeforeFinalize == 0 || e.CheckSig < 2048 || e.AfterFinalize < e.CheckSig {
+		t.Errorf("got estimate %+v, want checksig (at least 2048) after finalize", e)
+	}
+
+	// The estimate is exact.
+	_, err = txvm.Validate(prog, 3, e.Runlimit)
+	if err != nil {
+		t.Errorf("validating with runlimit %d: %s", e.Runlimit, err)
+	}
+	_, err = txvm.Validate(prog, 3, e.Runlimit-1)
+	if errors.Root(err) != txvm.ErrRunlimit {
+		t.Errorf("validating with runlimit %d: got error %v, want ErrRunlimit", e.Runlimit-1, err)
+	}
+
+	// A program that skips most of itself needs a runlimit of at
+	// least its length.
+	prog, err = asm.Assemble("jump:$end 'aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa' $end")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err = txvm.EstimateRunlimit(prog, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Used >= int64(len(prog)) || e.Runlimit != int64(len(prog)) {
+		t.Errorf("got estimate %+v for %d-byte program, want Runlimit %d", e, len(prog), len(prog))
+	}
+
+	_, err = txvm.EstimateRunlimit([]byte{0x01}, 3)
+	if errors.Root(err) != txvm.ErrResidue {
+		t.Errorf("got error %v, want ErrResidue", err)
+	}
+}
@@ -0,0 +1,113 @@
+package txvm
+
+import "github.com/chain/txvm/errors"
+
+// ExtFunc implements the ext instruction for one value of its
+// argument. It is registered with RegisterExt and called, after ext
+// has popped its argument, with an ExtVM giving access to the VM.
+// A non-nil error aborts execution of the VM.
+type ExtFunc func(x ExtVM) error
+
+// CheckSigFunc verifies a signature in a scheme other than ed25519.
+// It is registered with RegisterCheckSig and called by checksig for
+// non-empty signatures in its scheme. It returns nil if the
+// signature is valid. Otherwise its error aborts execution of the
+// VM; it should usually be, or wrap, ErrSignature, ErrSigSize, or
+// ErrPubSize. It must not modify its arguments (see Bytes).
+type CheckSigFunc func(msg, pubkey, sig []byte) error
+
+type checkSigScheme struct {
+	cost int64
+	f    CheckSigFunc
+}
+
+// ExtVM is the access to the VM given to an ExtFunc.
+//
+// Like the VM's own instructions, Pop and Charge abort execution of
+// the VM (by panicking) if the stack is empty or its top item is not
+// plain data, or if the runlimit is exhausted. An ExtFunc must not
+// recover from those panics.
+type ExtVM struct {
+	vm *VM
+}
+
+// VM returns the VM, for introspection.
+func (x ExtVM) VM() *VM {
+	return x.vm
+}
+
+// Pop removes and returns the data item on top of the current
+// contract's stack.
+func (x ExtVM) Pop() Data {
+	return x.vm.popData()
+}
+
+// Push pushes a data item onto the current contract's stack. It
+// does not charge the runlimit for the new item; the ExtFunc should
+// do so with Charge.
+func (x ExtVM) Push(d Data) {
+	x.vm.push(d)
+}
+
+// Charge deducts n from the runlimit.
+func (x ExtVM) Charge(n int64) {
+	x.vm.charge(n)
+}
+
+// RegisterExt can be passed as an option to Validate. It registers f
+// to implement the ext instruction when its argument is arg. This
+// makes ext with that argument available whether or not the
+// EnableExtension option is also given. Other arguments to ext
+// behave as usual.
+func RegisterExt(arg Data, f ExtFunc) Option {
+	return Option{
+		apply: func(vm *VM) {
+			if vm.extFuncs == nil {
+				vm.extFuncs = make(map[string]ExtFunc)
+			}
+			vm.extFuncs[string(Encode(arg))] = f
+		},
+	}
+}
+
+// RegisterCheckSig can be passed as an option to Validate. It
+// registers f to verify checksig signatures whose scheme is the
+// given value, charging cost against the runlimit (in place of the
+// usual charge for checksig) before calling f. This makes the scheme
+// available whether or not the EnableExtension option is also given.
+//
+// The ed25519 scheme, Int(0), cannot be replaced; RegisterCheckSig
+// panics if scheme is Int(0). It also panics if cost is negative.
+func RegisterCheckSig(scheme Data, cost int64, f CheckSigFunc) Option {
+	if s, ok := scheme.(Int); ok && s == 0 {
+		panic("txvm: cannot register checksig scheme 0")
+	}
+	if cost < 0 {
+		panic("txvm: negative checksig cost")
+	}
+	return Option{
+		apply: func(vm *VM) {
+			if vm.checkSigSchemes == nil {
+				vm.checkSigSchemes = make(map[string]checkSigScheme)
+			}
+			vm.checkSigSchemes[string(Encode(scheme))] = checkSigScheme{cost: cost, f: f}
+		},
+	}
+}
+
+func opExt(vm *VM) {
+	if !vm.extension && len(vm.extFuncs) == 0 {
+		panic(errors.Wrap(ErrExt, "ext"))
+	}
+	arg := vm.popData()
+	if f, ok := vm.extFuncs[string(Encode(arg))]; ok {
+		err := f(ExtVM{vm: vm})
+		if err != nil {
+			panic(errors.Wrapf(err, "ext %s", arg))
+		}
+		return
+	}
+	if !vm.extension {
+		panic(errors.Wrapf(ErrExt, "ext %s", arg))
+	}
+}
@@ -0,0 +1,125 @@
+package txvm
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	chainerrors "github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/txvm/op"
+)
+
+func TestRegisterExt(t *testing.T) {
+	add := func(x ExtVM) error {
+		a, ok1 := x.Pop().(Int)
+		b, ok2 := x.Pop().(Int)
+		if !ok1 || !ok2 {
+			return ErrType
+		}
+		x.Charge(5)
+		x.Push(a + b)
+		return nil
+	}
+	errFoo := errors.New("foo")
+	fail := func(ExtVM) error { return errFoo }
+
+	cases := []struct {
+		prog    []byte
+		opts    []Option
+		want    Int
+		wanterr error
+	}{
+		// 2 3 7 ext
+		{[]byte{2, 3, 7, op.Ext}, nil, 0, ErrExt},
+		{[]byte{2, 3, 7, op.Ext}, []Option{RegisterExt(Int(7), add)}, 5, nil},
+		{[]byte{2, 3, 8, op.Ext}, []Option{RegisterExt(Int(7), add)}, 0, ErrExt},
+		{[]byte{2, 3, 8, op.Ext}, []Option{RegisterExt(Int(7), add), EnableExtension}, 3, nil},
+		{[]byte{2, 3, 7, op.Ext}, []Option{RegisterExt(Int(7), fail)}, 0, errFoo},
+		{[]byte{3, 7, op.Ext}, []Option{RegisterExt(Int(7), add)}, 0, ErrUnderflow},
+	}
+	for i, c := range cases {
+		var got Int
+		opts := append(c.opts, StopAfterFinalize, AfterStep(func(vm *VM) {
+			if vm.OpCode() == op.Ext && vm.StackLen() > 0 {
+				got, _ = vm.contract.stack[vm.StackLen()-1].(Int)
+			}
+		}))
+		var runlimit int64
+		opts = append(opts, GetRunlimit(&runlimit))
+		_, err := Validate(c.prog, 3, 100, opts...)
+		if chainerrors.Root(err) != c.wanterr {
+			t.Errorf("case %d: got error %v, want %v", i, err, c.wanterr)
+			continue
+		}
+		if err == nil && got != c.want {
+			t.Errorf("case %d: got %d on top of stack, want %d", i, got, c.want)
+		}
+		if err == nil && c.want == 5 && runlimit != 100-4-5 {
+			t.Errorf("case %d: got runlimit %d, want %d", i, runlimit, 100-4-5)
+		}
+	}
+}
+
+func TestRegisterCheckSig(t *testing.T) {
+	// A toy scheme: the signature is the message followed by the
+	// public key.
+	toy := func(msg, pubkey, sig []byte) error {
+		if !bytes.Equal(sig, append(append([]byte(nil), msg...), pubkey...)) {
+			return ErrSignature
+		}
+		return nil
+	}
+	opts := []Option{RegisterCheckSig(Bytes("toy"), 10, toy)}
+
+	prog := func(sig string, scheme Data) []byte {
+		var buf bytes.Buffer
+		Bytes("msg").encode(&buf)
+		Bytes("pub").encode(&buf)
+		Bytes(sig).encode(&buf)
+		scheme.encode(&buf)
+		buf.WriteByte(op.CheckSig)
+		buf.WriteByte(op.Verify)
+		return buf.Bytes()
+	}
+
+	// The registered scheme is charged its own cost, 10, instead of
+	// the 2048 charged for an unknown scheme under EnableExtension.
+	var runlimit, extRunlimit int64
+	_, err := Validate(prog("msgpub", Bytes("toy")), 3, 10000, append(opts, GetRunlimit(&runlimit))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Validate(prog("msgpub", Bytes("unk")), 3, 10000, EnableExtension, GetRunlimit(&extRunlimit))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runlimit-extRunlimit != 2048-10 {
+		t.Errorf("got runlimit %d, want %d", runlimit, extRunlimit+2048-10)
+	}
+	_, err = Validate(prog("msgpux", Bytes("toy")), 3, 10000, opts...)
+	if chainerrors.Root(err) != ErrSignature {
+		t.Errorf("bad toy signature: got error %v, want %s", err, ErrSignature)
+	}
+	_, err = Validate(prog("msgpub", Bytes("other")), 3, 10000, opts...)
+	if chainerrors.Root(err) != ErrExt {
+		t.Errorf("unregistered scheme: got error %v, want %s", err, ErrExt)
+	}
+
+	for _, c := range []struct {
+		desc   string
+		scheme Data
+		cost   int64
+	}{
+		{"scheme 0", Int(0), 1},
+		{"negative cost", Bytes("toy"), -1},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("registering with %s did not panic", c.desc)
+				}
+			}()
+			RegisterCheckSig(c.scheme, c.cost, toy)
+		}()
+	}
+}
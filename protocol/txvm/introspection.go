@@ -35,6 +35,40 @@ func (vm *VM) Seed() []byte {
 }
 
 // Program returns the program bytecode of the VM's current contract.
+// It must not be modified.
 func (vm *VM) Program() []byte {
 	return vm.run.prog
 }
+
+// PC returns the position in Program of the instruction being
+// executed. In a BeforeStep callback it is the position of the
+// instruction about to execute; in an AfterStep callback it is the
+// position of the next instruction (unless the instruction jumped).
+func (vm *VM) PC() int64 {
+	return vm.run.pc
+}
+
+// Data returns the immediate data of the current instruction, if
+// it is a pushdata instruction. It must not be modified.
+func (vm *VM) Data() []byte {
+	return vm.data
+}
+
+// RunDepth returns the number of programs suspended while the
+// current one runs, i.e. the depth of nested call and exec
+// instructions. It is 0 in the transaction program itself.
+func (vm *VM) RunDepth() int {
+	return len(vm.runstack)
+}
+
+// ArgStackLen returns the length of the VM's argument stack.
+func (vm *VM) ArgStackLen() int {
+	return len(vm.argstack)
+}
+
+// ArgStackItem returns an "inspected" copy of an item on the VM's
+// argument stack, by position. Position 0 is the bottom of the stack
+// and ArgStackLen()-1 is the top.
+func (vm *VM) ArgStackItem(i int) Data {
+	return vm.argstack[i].inspect()
+}
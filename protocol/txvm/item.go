@@ -29,6 +29,13 @@ type (
 	Int int64
 
 	// Bytes is a stack item containing a sequence of bytes.
+	//
+	// The contents of a Bytes are never modified once it is
+	// created, so it can share storage with other items and with
+	// the programs the VM runs, including decoded programs cached
+	// for use by other VMs. Code outside the VM that gets an item
+	// from it (from its Log or StackItem, say) must not modify it
+	// either.
 	Bytes []byte
 
 	// Tuple is a stack item containing a sequence of zero or more Data items.
@@ -108,6 +115,70 @@ func Encode(v Data) []byte {
 	return b.Bytes()
 }
 
+// ErrEncoding is returned by Decode when its input is not the
+// encoding of a Data value.
+var ErrEncoding = errorf("invalid data encoding")
+
+// Decode parses the program produced by Encode, returning the Data
+// value it pushes, without running it. It accepts only the exact
+// output of Encode: the program must consist of small-integer,
+// pushdata, int, and tuple instructions in canonical form, and must
+// produce a single value.
+func Decode(prog []byte) (Data, error) {
+	var stack []Data
+	for pc := 0; pc < len(prog); {
+		opcode, data, n, err := op.DecodeInst(prog[pc:])
+		if err != nil {
+			return nil, errors.WithData(errors.WithDetail(ErrEncoding, err.Error()), "pos", pc)
+		}
+		if int(n) != uvarintLen(uint64(opcode)+uint64(len(data)))+len(data) {
+			return nil, errors.WithData(errors.WithDetail(ErrEncoding, "non-minimal opcode varint"), "pos", pc)
+		}
+		switch {
+		case op.IsSmallIntOp(opcode):
+			stack = append(stack, Int(opcode-op.MinSmallInt))
+
+		case op.IsPushdataOp(opcode):
+			if end := pc + int(n); end < len(prog) && prog[end] == op.Int {
+				v, m := binary.Uvarint(data)
+				if m <= 0 || m != len(data) || m != uvarintLen(v) || op.IsSmallInt(int64(v)) {
+					return nil, errors.WithData(errors.WithDetail(ErrEncoding, "non-canonical int"), "pos", pc)
+				}
+				stack = append(stack, Int(v))
+				n++
+				break
+			}
+			stack = append(stack, Bytes(data))
+
+		case opcode == op.Tuple:
+			if len(stack) == 0 {
+				return nil, errors.WithData(errors.WithDetail(ErrEncoding, "tuple with no size"), "pos", pc)
+			}
+			size, ok := stack[len(stack)-1].(Int)
+			stack = stack[:len(stack)-1]
+			if !ok || size < 0 || int64(size) > int64(len(stack)) {
+				return nil, errors.WithData(errors.WithDetail(ErrEncoding, "bad tuple size"), "pos", pc)
+			}
+			t := make(Tuple, size)
+			copy(t, stack[len(stack)-int(size):])
+			stack = append(stack[:len(stack)-int(size)], t)
+
+		default:
+			return nil, errors.WithData(errors.WithDetailf(ErrEncoding, "unexpected opcode 0x%02x", opcode), "pos", pc)
+		}
+		pc += int(n)
+	}
+	if len(stack) != 1 {
+		return nil, errors.WithDetailf(ErrEncoding, "program produces %d values", len(stack))
+	}
+	return stack[0], nil
+}
+
+func uvarintLen(v uint64) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], v)
+}
+
 func writePushdata(buf *bytes.Buffer, data []byte) {
 	op := uint64(len(data)) + op.MinPushdata
 	varint := [binary.MaxVarintLen64]byte{}
@@ -0,0 +1,69 @@
+package txvm_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/txvm"
+	"github.com/chain/txvm/protocol/txvm/asm"
+)
+
+func TestDecode(t *testing.T) {
+	values := []txvm.Data{
+		txvm.Int(0),
+		txvm.Int(31),
+		txvm.Int(32),
+		txvm.Int(-1),
+		txvm.Int(1 << 62),
+		txvm.Int(-1 << 63),
+		txvm.Bytes{},
+		txvm.Bytes("foo"),
+		txvm.Bytes(make([]byte, 200)),
+		txvm.Tuple{},
+		txvm.Tuple{txvm.Int(1), txvm.Bytes("x"), txvm.Tuple{txvm.Int(-5), txvm.Tuple{}}, txvm.Bytes{}},
+	}
+	for _, v := range values {
+		enc := txvm.Encode(v)
+		got, err := txvm.Decode(enc)
+		if err != nil {
+			t.Errorf("txvm.Decode(txvm.Encode(%s)) error: %s", v, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, v) {
+			t.Errorf("txvm.Decode(txvm.Encode(%s)) = %s", v, got)
+		}
+	}
+
+	bad := []struct {
+		name string
+		prog []byte
+	}{
+		{"empty", nil},
+		{"two values", mustAssemble("1 2")},
+		{"small int as pushdata", mustAssemble("x'05' int")},
+		{"non-minimal varint", []byte{0x61, 0xa0, 0x00, 0x20}},
+		{"extra varint bytes", mustAssemble("x'2000' int")},
+		{"non-minimal opcode", []byte{0xe0, 0x00, 'a'}},
+		{"int of small int", mustAssemble("5 int")},
+		{"negative tuple size", mustAssemble("-1 tuple")},
+		{"tuple too big", mustAssemble("1 2 tuple")},
+		{"tuple of bytes size", mustAssemble("'a' tuple")},
+		{"other instruction", mustAssemble("1 2 add")},
+		{"truncated pushdata", []byte{0x65, 'a'}},
+	}
+	for _, c := range bad {
+		_, err := txvm.Decode(c.prog)
+		if errors.Root(err) != txvm.ErrEncoding {
+			t.Errorf("%s: txvm.Decode(%x) error = %v, want %s", c.name, c.prog, err, txvm.ErrEncoding)
+		}
+	}
+}
+
+func mustAssemble(src string) []byte {
+	prog, err := asm.Assemble(src)
+	if err != nil {
+		panic(err)
+	}
+	return prog
+}
@@ -0,0 +1,129 @@
+package txvm
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/chain/txvm/protocol/txvm/op"
+)
+
+// TraceStep is one step of an execution trace written by TraceJSON.
+// It describes the VM just before an instruction executes.
+type TraceStep struct {
+	// Depth is the number of programs suspended by call and exec
+	// instructions, as reported by VM.RunDepth.
+	Depth int `json:"depth"`
+
+	PC     int64  `json:"pc"`
+	OpCode byte   `json:"opcode"`
+	Op     string `json:"op"`
+
+	// Data is the immediate data of a pushdata instruction, in hex.
+	Data string `json:"data,omitempty"`
+
+	Runlimit int64  `json:"runlimit"`
+	Seed     string `json:"seed"`
+
+	// Stack and ArgStack are the contract and argument stacks,
+	// bottom first.
+	Stack    []TraceItem `json:"stack"`
+	ArgStack []TraceItem `json:"argstack"`
+
+	// Log holds the entries added to the transaction log by this
+	// step's instruction. Entries added by a program run with call
+	// or exec appear in the steps of that program.
+	Log []TraceItem `json:"log,omitempty"`
+}
+
+// TraceItem is a stack item or log entry in a TraceStep. Type is the
+// item's type code: IntCode, BytesCode, or TupleCode for plain data,
+// or ValueCode, ContractCode, or WrappedContractCode. Value is a
+// number for an Int, a hex string for Bytes, and a list of
+// TraceItems for a Tuple or for the fields of a value or contract
+// (as returned by the inspect instruction, less the type code).
+type TraceItem struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// TraceJSON can be passed as an option to Validate. It causes an
+// execution trace to be written to w as a sequence of JSON-encoded
+// TraceStep objects, one per line.
+func TraceJSON(w io.Writer) Option {
+	return Option{
+		apply: func(vm *VM) {
+			var (
+				loglen  int
+				pending *TraceStep // begun but not yet written
+				enc     = json.NewEncoder(w)
+			)
+			// flush writes the pending step, with the log entries
+			// added since the last one written.
+			flush := func(vm *VM) {
+				if pending != nil {
+					for _, entry := range vm.Log[loglen:] {
+						pending.Log = append(pending.Log, traceItem(entry))
+					}
+					enc.Encode(pending)
+					pending = nil
+				}
+				loglen = len(vm.Log)
+			}
+			vm.beforeStep = append(vm.beforeStep, func(vm *VM) {
+				// The pending step is a call or exec whose callee
+				// is about to run.
+				flush(vm)
+				step := &TraceStep{
+					Depth:    len(vm.runstack),
+					PC:       vm.run.pc,
+					OpCode:   vm.opcode,
+					Runlimit: vm.runlimit,
+					Seed:     hex.EncodeToString(vm.contract.seed),
+					Stack:    []TraceItem{},
+					ArgStack: []TraceItem{},
+				}
+				switch {
+				case op.IsSmallIntOp(vm.opcode):
+					step.Op = strconv.Itoa(int(vm.opcode - op.MinSmallInt))
+				case op.IsPushdataOp(vm.opcode):
+					step.Op = "pushdata"
+					step.Data = hex.EncodeToString(vm.data)
+				default:
+					step.Op = op.Name(vm.opcode)
+				}
+				for _, item := range vm.contract.stack {
+					step.Stack = append(step.Stack, traceItem(item))
+				}
+				for _, item := range vm.argstack {
+					step.ArgStack = append(step.ArgStack, traceItem(item))
+				}
+				pending = step
+			})
+			vm.afterStep = append(vm.afterStep, flush)
+			vm.onExit = append(vm.onExit, flush)
+		},
+	}
+}
+
+func traceItem(item Item) TraceItem {
+	switch item := item.(type) {
+	case Int:
+		return TraceItem{Type: string(IntCode), Value: int64(item)}
+	case Bytes:
+		return TraceItem{Type: string(BytesCode), Value: hex.EncodeToString(item)}
+	case Tuple:
+		return TraceItem{Type: string(TupleCode), Value: traceItems(item)}
+	}
+	t := item.inspect()
+	return TraceItem{Type: string(extractTypeCode(t)), Value: traceItems(t[1:])}
+}
+
+func traceItems(t Tuple) []TraceItem {
+	items := []TraceItem{}
+	for _, d := range t {
+		items = append(items, traceItem(d))
+	}
+	return items
+}
@@ -0,0 +1,100 @@
+package txvm
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/chain/txvm/protocol/txvm/op"
+)
+
+func TestTraceJSON(t *testing.T) {
+	// {2, 'a'} log 7 drop
+	prog := []byte{
+		op.MinSmallInt + 2,
+		op.MinPushdata + 1, 'a',
+		op.MinSmallInt + 2,
+		op.Tuple,
+		op.Log,
+		op.MinSmallInt + 7,
+		op.Drop,
+	}
+	var buf bytes.Buffer
+	_, err := Validate(prog, 3, 100, TraceJSON(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var steps []TraceStep
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var step TraceStep
+		err := dec.Decode(&step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		steps = append(steps, step)
+	}
+
+	var ops []string
+	for _, step := range steps {
+		ops = append(ops, step.Op)
+	}
+	wantOps := []string{"2", "pushdata", "2", "tuple", "log", "7", "drop"}
+	if !reflect.DeepEqual(ops, wantOps) {
+		t.Fatalf("got ops %v, want %v", ops, wantOps)
+	}
+
+	if steps[1].Data != "61" || steps[1].PC != 1 || steps[1].Runlimit != 99 {
+		t.Errorf("step 1: got %+v, want pushdata 61 at pc 1 with runlimit 99", steps[1])
+	}
+
+	// Before the tuple instruction: 2 'a' 2.
+	var stack []interface{}
+	for _, item := range steps[3].Stack {
+		stack = append(stack, item.Type, item.Value)
+	}
+	wantStack := []interface{}{"Z", 2.0, "S", "61", "Z", 2.0}
+	if !reflect.DeepEqual(stack, wantStack) {
+		t.Errorf("step 3 stack: got %v, want %v", stack, wantStack)
+	}
+
+	if len(steps[4].Log) != 1 || steps[4].Log[0].Type != "T" {
+		t.Errorf("step 4: got log %v, want one tuple", steps[4].Log)
+	}
+	if len(steps[5].Log) != 0 {
+		t.Errorf("step 5: got log %v, want none", steps[5].Log)
+	}
+}
+
+func TestTraceJSONFinalLog(t *testing.T) {
+	// "a" log
+	prog := []byte{op.MinPushdata + 1, 'a', op.Log}
+	var buf bytes.Buffer
+	_, err := Validate(prog, 3, 100, TraceJSON(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var steps []TraceStep
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var step TraceStep
+		err := dec.Decode(&step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		steps = append(steps, step)
+	}
+	if len(steps) != 2 {
+		t.Fatalf("got %d steps, want 2", len(steps))
+	}
+	// The entry is {'L', seed, "a"}.
+	if len(steps[1].Log) != 1 || steps[1].Log[0].Type != "T" {
+		t.Fatalf("log step: got log %v, want one tuple", steps[1].Log)
+	}
+	if fields, _ := steps[1].Log[0].Value.([]interface{}); len(fields) != 3 || !reflect.DeepEqual(fields[2], map[string]interface{}{"type": "S", "value": "61"}) {
+		t.Errorf("log step: got entry %v, want one ending in \"a\"", steps[1].Log[0].Value)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/chain/txvm/crypto/ed25519"
 	"github.com/chain/txvm/protocol/txvm/op"
 )
 
@@ -64,6 +65,20 @@ var EnableExtension = Option{
 	apply: func(vm *VM) { vm.extension = true },
 }
 
+// ConcurrentVerify can be passed as an option to Validate. It causes
+// checksig to defer the verification of non-empty ed25519 signatures
+// (after checking their sizes) until the program finishes, when they
+// are all verified concurrently with an ed25519.ConcurrentVerifier.
+// If any is invalid, Validate returns ErrSignature.
+//
+// The same signatures are accepted as without the option. It is
+// faster for a single transaction with many signatures when there is
+// more than one CPU, but gains nothing when transactions are already
+// being validated in parallel.
+var ConcurrentVerify = Option{
+	apply: func(vm *VM) { vm.deferredSigs = new(ed25519.ConcurrentVerifier) },
+}
+
 // GetRunlimit causes the vm to write its ending runlimit to the given
 // pointer on exit.
 func GetRunlimit(runlimit *int64) Option {
@@ -94,10 +109,14 @@ func Resumer(f *func(rest []byte) error) Option {
 
 				defer vm.recoverError(&err)
 				vm.stopAfterFinalize = false
-				vm.exec(rest)
+				vm.execDecoded(rest, decodeProg(rest, false))
 				if !vm.contract.stack.isEmpty() || !vm.argstack.isEmpty() {
 					return vm.wraperr(ErrResidue)
 				}
+				err = vm.verifyDeferredSigs()
+				if err != nil {
+					return err
+				}
 				vm.runHooks(vm.onExit)
 				return nil
 			}
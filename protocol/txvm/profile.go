@@ -0,0 +1,255 @@
+package txvm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"strconv"
+
+	"github.com/chain/txvm/protocol/txvm/op"
+)
+
+// Profile is a profile of the runlimit consumed by a program, made
+// by the Profiler option.
+type Profile struct {
+	// Samples lists the instructions that ran, one sample for each
+	// distinct stack of nested instructions, in the order they first
+	// ran.
+	Samples []*ProfileSample
+
+	index map[sampleKey]*ProfileSample
+	cur   []*ProfileSample // the running instruction at each run depth
+}
+
+// ProfileSample is the runlimit consumed by one instruction, running
+// nested in a particular stack of other instructions.
+type ProfileSample struct {
+	// Stack is the instruction, followed by the exec, call, or other
+	// instruction that ran its program, and so on out to the
+	// transaction program.
+	Stack []ProfileFrame
+
+	// Count is the number of times the instruction ran. Runlimit is
+	// the total runlimit charged while it ran, not including the
+	// runlimit charged by instructions nested in it.
+	Count, Runlimit int64
+}
+
+// ProfileFrame is an instruction in a ProfileSample's stack.
+type ProfileFrame struct {
+	// Seed is the seed of the contract running the instruction. It
+	// is all zeroes for the transaction program.
+	Seed []byte
+
+	// Depth is the number of programs suspended by call and exec
+	// instructions, as reported by VM.RunDepth.
+	Depth int
+
+	PC     int64
+	OpCode byte
+}
+
+// Op returns the name of the frame's instruction: a number for a
+// small-integer instruction, "pushdata" for a pushdata instruction,
+// and the opcode name otherwise.
+func (f ProfileFrame) Op() string {
+	switch {
+	case op.IsSmallIntOp(f.OpCode):
+		return strconv.Itoa(int(f.OpCode - op.MinSmallInt))
+	case op.IsPushdataOp(f.OpCode):
+		return "pushdata"
+	}
+	return op.Name(f.OpCode)
+}
+
+type sampleKey struct {
+	parent *ProfileSample
+	seed   [32]byte
+	pc     int64
+	opcode byte
+}
+
+// Profiler can be passed as an option to Validate. It causes the vm
+// to record in p the runlimit charged by each instruction it runs.
+func Profiler(p *Profile) Option {
+	return Option{
+		apply: func(vm *VM) {
+			p.Samples = nil
+			p.index = make(map[sampleKey]*ProfileSample)
+			p.cur = nil
+			vm.beforeStep = append(vm.beforeStep, p.step)
+			vm.onCharge = append(vm.onCharge, p.charge)
+		},
+	}
+}
+
+// step finds the sample for the instruction about to run, making it
+// the current one at its run depth.
+func (p *Profile) step(vm *VM) {
+	depth := len(vm.runstack)
+	if depth > len(p.cur) {
+		// Should not happen: every nested program is run by an
+		// instruction at the depth above it.
+		depth = len(p.cur)
+	}
+	p.cur = p.cur[:depth]
+	k := sampleKey{pc: vm.run.pc, opcode: vm.opcode}
+	copy(k.seed[:], vm.contract.seed)
+	if depth > 0 {
+		k.parent = p.cur[depth-1]
+	}
+	s := p.index[k]
+	if s == nil {
+		frame := ProfileFrame{
+			Seed:   append([]byte(nil), vm.contract.seed...),
+			Depth:  depth,
+			PC:     vm.run.pc,
+			OpCode: vm.opcode,
+		}
+		s = &ProfileSample{Stack: []ProfileFrame{frame}}
+		if k.parent != nil {
+			s.Stack = append(s.Stack, k.parent.Stack...)
+		}
+		p.index[k] = s
+		p.Samples = append(p.Samples, s)
+	}
+	s.Count++
+	p.cur = append(p.cur, s)
+}
+
+// charge attributes n to the current instruction at the current run
+// depth.
+func (p *Profile) charge(vm *VM, n int64) {
+	if depth := len(vm.runstack); depth < len(p.cur) {
+		p.cur[depth].Runlimit += n
+	}
+}
+
+// WritePprof writes p to w as a gzip-compressed protocol buffer in
+// the format read by the pprof tool. Each contract (distinguished by
+// seed) is a function, and each instruction a line in it numbered by
+// its pc. The samples have two values, the runlimit consumed and the
+// number of instructions run.
+func (p *Profile) WritePprof(w io.Writer) error {
+	var (
+		b       pprofBuf
+		strs    = map[string]int64{"": 0}
+		strList = []string{""}
+		funcs   = make(map[string]uint64)
+		locs    = make(map[locKey]uint64)
+		fbuf    pprofBuf
+		lbuf    pprofBuf
+	)
+	str := func(s string) int64 {
+		i, ok := strs[s]
+		if !ok {
+			i = int64(len(strList))
+			strs[s] = i
+			strList = append(strList, s)
+		}
+		return i
+	}
+
+	for _, t := range [][2]string{{"runlimit", "units"}, {"instructions", "count"}} {
+		var vt pprofBuf
+		vt.int(1, str(t[0]))
+		vt.int(2, str(t[1]))
+		b.bytes(1, vt)
+	}
+
+	for _, s := range p.Samples {
+		var ids []uint64
+		for _, f := range s.Stack {
+			lk := locKey{seed: string(f.Seed), depth: f.Depth, pc: f.PC, opcode: f.OpCode}
+			id, ok := locs[lk]
+			if !ok {
+				fid, ok := funcs[lk.seed]
+				if !ok {
+					fid = uint64(len(funcs) + 1)
+					funcs[lk.seed] = fid
+					name, sysName := "tx", hex.EncodeToString(f.Seed)
+					if !bytes.Equal(f.Seed, emptySeed) {
+						name = "contract " + sysName[:16]
+					}
+					var fn pprofBuf
+					fn.uint(1, fid)
+					fn.int(2, str(name))
+					fn.int(3, str(sysName))
+					fbuf.bytes(5, fn)
+				}
+				id = uint64(len(locs) + 1)
+				locs[lk] = id
+				var line pprofBuf
+				line.uint(1, fid)
+				line.int(2, f.PC)
+				var loc pprofBuf
+				loc.uint(1, id)
+				loc.uint(3, uint64(f.PC))
+				loc.bytes(4, line)
+				lbuf.bytes(4, loc)
+			}
+			ids = append(ids, id)
+		}
+		var sample pprofBuf
+		sample.packed(1, ids)
+		sample.packed(2, []uint64{uint64(s.Runlimit), uint64(s.Count)})
+		b.bytes(2, sample)
+	}
+
+	b = append(b, lbuf...)
+	b = append(b, fbuf...)
+	defaultType := str("runlimit")
+	for _, s := range strList {
+		b.bytes(6, pprofBuf(s))
+	}
+	b.int(14, defaultType)
+
+	zw := gzip.NewWriter(w)
+	_, err := zw.Write(b)
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// locKey identifies a pprof location. The opcode distinguishes
+// instructions at the same pc in the different programs a contract
+// may have (after yield, for instance).
+type locKey struct {
+	seed   string
+	depth  int
+	pc     int64
+	opcode byte
+}
+
+// pprofBuf is a protocol buffer message being encoded.
+type pprofBuf []byte
+
+func (b *pprofBuf) key(field, wireType uint64) {
+	*b = binary.AppendUvarint(*b, field<<3|wireType)
+}
+
+func (b *pprofBuf) uint(field, v uint64) {
+	b.key(field, 0)
+	*b = binary.AppendUvarint(*b, v)
+}
+
+func (b *pprofBuf) int(field uint64, v int64) {
+	b.uint(field, uint64(v))
+}
+
+func (b *pprofBuf) bytes(field uint64, v []byte) {
+	b.key(field, 2)
+	*b = binary.AppendUvarint(*b, uint64(len(v)))
+	*b = append(*b, v...)
+}
+
+func (b *pprofBuf) packed(field uint64, vs []uint64) {
+	var inner []byte
+	for _, v := range vs {
+		inner = binary.AppendUvarint(inner, v)
+	}
+	b.bytes(field, inner)
+}
@@ -0,0 +1,98 @@
+package txvm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+
+	"github.com/chain/txvm/protocol/txvm/op"
+)
+
+func TestProfiler(t *testing.T) {
+	// [1 2 add verify] contract call 3 drop
+	prog := []byte{
+		op.MinPushdata + 4, op.MinSmallInt + 1, op.MinSmallInt + 2, op.Add, op.Verify,
+		op.Contract,
+		op.Call,
+		op.MinSmallInt + 3,
+		op.Drop,
+	}
+	var (
+		p        Profile
+		runlimit int64
+	)
+	_, err := Validate(prog, 3, 1000, Profiler(&p), GetRunlimit(&runlimit))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var total int64
+	for _, s := range p.Samples {
+		total += s.Runlimit
+		if s.Count != 1 {
+			t.Errorf("%s at pc %d: got count %d, want 1", s.Stack[0].Op(), s.Stack[0].PC, s.Count)
+		}
+	}
+	if total != 1000-runlimit {
+		t.Errorf("got total %d, want %d", total, 1000-runlimit)
+	}
+
+	type frame struct {
+		op    string
+		depth int
+		pc    int64
+	}
+	var got [][]frame
+	for _, s := range p.Samples {
+		var stack []frame
+		for _, f := range s.Stack {
+			stack = append(stack, frame{f.Op(), f.Depth, f.PC})
+		}
+		got = append(got, stack)
+	}
+	call := frame{"call", 0, 6}
+	want := [][]frame{
+		{{"pushdata", 0, 0}},
+		{{"contract", 0, 5}},
+		{call},
+		{{"1", 1, 0}, call},
+		{{"2", 1, 1}, call},
+		{{"add", 1, 2}, call},
+		{{"verify", 1, 3}, call},
+		{{"3", 0, 7}},
+		{{"drop", 0, 8}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got samples %v, want %v", got, want)
+	}
+	for i := range want {
+		if len(got[i]) != len(want[i]) || got[i][0] != want[i][0] || got[i][len(got[i])-1] != want[i][len(want[i])-1] {
+			t.Errorf("sample %d: got stack %v, want %v", i, got[i], want[i])
+		}
+	}
+	// The call runs in the transaction, and the 1 in the contract.
+	if bytes.Equal(p.Samples[3].Stack[0].Seed, p.Samples[2].Stack[0].Seed) {
+		t.Error("got the same seed for the call and the called contract")
+	}
+	if s := p.Samples[0]; s.Runlimit != 1+1+4 {
+		t.Errorf("pushdata: got runlimit %d, want 6", s.Runlimit)
+	}
+
+	var buf bytes.Buffer
+	err = p.WritePprof(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b, []byte("runlimit")) {
+		t.Error("pprof profile does not name the runlimit sample type")
+	}
+}
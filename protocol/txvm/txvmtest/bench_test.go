@@ -0,0 +1,96 @@
+package txvmtest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/txbuilder"
+	"github.com/chain/txvm/protocol/txbuilder/standard"
+	"github.com/chain/txvm/protocol/txvm"
+)
+
+// The benchmarks below run transactions using the standard
+// contracts, with 2-of-3 multisig authorization.
+
+func BenchmarkMultisigSpend(b *testing.B) {
+	benchTx(b, func(tpl *txbuilder.Template, keyIDs [][]byte, pubkeys []ed25519.PublicKey) {
+		assetID := bc.HashFromBytes([]byte("asset"))
+		tpl.AddInput(2, keyIDs, nil, pubkeys, 10, assetID, []byte("anchor"), nil, 2)
+		tpl.AddOutput(2, pubkeys, 10, assetID, nil, nil)
+	})
+}
+
+func BenchmarkIssuance(b *testing.B) {
+	benchTx(b, func(tpl *txbuilder.Template, keyIDs [][]byte, pubkeys []ed25519.PublicKey) {
+		assetID := bc.NewHash(standard.AssetID(2, 2, pubkeys, nil))
+		tpl.AddIssuance(2, []byte("blockchain"), nil, 2, keyIDs, nil, pubkeys, 10, nil, nil)
+		tpl.AddOutput(2, pubkeys, 10, assetID, nil, nil)
+	})
+}
+
+// BenchmarkUntilFinalize is BenchmarkMultisigSpend stopping after
+// finalize, before the signatures are checked, which isolates the
+// cost of running the contracts from the cost of the cryptography.
+func BenchmarkUntilFinalize(b *testing.B) {
+	benchTx(b, func(tpl *txbuilder.Template, keyIDs [][]byte, pubkeys []ed25519.PublicKey) {
+		assetID := bc.HashFromBytes([]byte("asset"))
+		tpl.AddInput(2, keyIDs, nil, pubkeys, 10, assetID, []byte("anchor"), nil, 2)
+		tpl.AddOutput(2, pubkeys, 10, assetID, nil, nil)
+	}, txvm.StopAfterFinalize)
+}
+
+// BenchmarkHooks is BenchmarkMultisigSpend with trivial BeforeStep
+// and AfterStep hooks.
+func BenchmarkHooks(b *testing.B) {
+	var steps int
+	hook := func(*txvm.VM) { steps++ }
+	benchTx(b, func(tpl *txbuilder.Template, keyIDs [][]byte, pubkeys []ed25519.PublicKey) {
+		assetID := bc.HashFromBytes([]byte("asset"))
+		tpl.AddInput(2, keyIDs, nil, pubkeys, 10, assetID, []byte("anchor"), nil, 2)
+		tpl.AddOutput(2, pubkeys, 10, assetID, nil, nil)
+	}, txvm.BeforeStep(hook), txvm.AfterStep(hook))
+}
+
+func benchTx(b *testing.B, build func(*txbuilder.Template, [][]byte, []ed25519.PublicKey), o ...txvm.Option) {
+	var (
+		keyIDs  [][]byte
+		pubkeys []ed25519.PublicKey
+		prvkeys = make(map[byte]ed25519.PrivateKey)
+	)
+	for i := byte(0); i < 3; i++ {
+		pub, prv, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		keyIDs = append(keyIDs, []byte{i})
+		pubkeys = append(pubkeys, pub)
+		prvkeys[i] = prv
+	}
+
+	tpl := &txbuilder.Template{MaxTimeMS: bc.Millis(time.Now().Add(time.Hour))}
+	build(tpl, keyIDs, pubkeys)
+	err := tpl.Sign(context.Background(), func(_ context.Context, msg, keyID []byte, _ [][]byte) ([]byte, error) {
+		if keyID[0] == 2 {
+			return nil, nil
+		}
+		return ed25519.Sign(prvkeys[keyID[0]], msg), nil
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	tx, err := tpl.Tx()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := txvm.Validate(tx.Program, tx.Version, tx.Runlimit, o...)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
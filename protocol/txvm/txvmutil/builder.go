@@ -1,6 +1,7 @@
 /*
 Package txvmutil defines a "fluent" builder type for constructing TxVM
-programs.
+programs, and functions for converting between Go structs and TxVM
+tuples.
 */
 package txvmutil
 
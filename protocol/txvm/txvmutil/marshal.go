@@ -0,0 +1,352 @@
+package txvmutil
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/txvm"
+)
+
+var (
+	// ErrMismatch is returned by Unmarshal when a tuple does not
+	// match the shape of the Go value it is unmarshaled into.
+	ErrMismatch = errors.New("tuple does not match Go value")
+
+	// ErrUnsupported is returned by Marshal and Unmarshal for Go
+	// types that have no txvm counterpart, and for structs with
+	// malformed txvm tags.
+	ErrUnsupported = errors.New("unsupported type for txvm marshaling")
+)
+
+var (
+	dataType   = reflect.TypeOf((*txvm.Data)(nil)).Elem()
+	hashType   = reflect.TypeOf(bc.Hash{})
+	pubkeyType = reflect.TypeOf(ed25519.PublicKey(nil))
+)
+
+// Marshal converts v, a struct or a pointer to one, to a tuple. Each
+// field of the struct with a tag of the form
+//
+//	`txvm:"N"`
+//
+// is placed at position N of the tuple. The positions must run from 0
+// with no gaps. Fields without the tag are ignored.
+//
+// Signed and unsigned integer fields become Ints. Byte slices and
+// arrays, strings, bc.Hashes, and ed25519.PublicKeys become Bytes.
+// Structs (or pointers to them) become nested tuples, as do slices of
+// any other supported type. Fields of type txvm.Data, or of its
+// implementations (Int, Bytes, and Tuple), are copied as they are.
+func Marshal(v interface{}) (txvm.Tuple, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, errors.WithDetailf(ErrUnsupported, "cannot marshal %T, want a struct", v)
+	}
+	return marshalStruct(rv, rv.Type().String())
+}
+
+// Unmarshal is the inverse of Marshal. It sets the tagged fields of
+// the struct pointed to by v from the corresponding items of t, which
+// must have exactly as many items as v has tagged fields. Errors
+// describing how t does not match v have the root ErrMismatch and
+// name the field that does not match.
+func Unmarshal(t txvm.Tuple, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.WithDetailf(ErrUnsupported, "cannot unmarshal into %T, want a pointer to a struct", v)
+	}
+	rv = rv.Elem()
+	return unmarshalStruct(t, rv, rv.Type().String())
+}
+
+type tupleField struct {
+	index int // in the struct
+	name  string
+}
+
+// tupleFields returns the tagged fields of struct type t, in tuple
+// order.
+func tupleFields(t reflect.Type) ([]tupleField, error) {
+	var fields []tupleField
+	pos := make(map[int]tupleField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := f.Tag.Lookup("txvm")
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(tag)
+		if err != nil || n < 0 {
+			return nil, errors.WithDetailf(ErrUnsupported, "%s.%s: bad txvm tag %q", t, f.Name, tag)
+		}
+		if f.PkgPath != "" {
+			return nil, errors.WithDetailf(ErrUnsupported, "%s.%s: unexported field has a txvm tag", t, f.Name)
+		}
+		if other, ok := pos[n]; ok {
+			return nil, errors.WithDetailf(ErrUnsupported, "%s: fields %s and %s both at position %d", t, other.name, f.Name, n)
+		}
+		pos[n] = tupleField{index: i, name: f.Name}
+	}
+	for n := 0; n < len(pos); n++ {
+		f, ok := pos[n]
+		if !ok {
+			return nil, errors.WithDetailf(ErrUnsupported, "%s: no field at position %d", t, n)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func marshalStruct(rv reflect.Value, path string) (txvm.Tuple, error) {
+	fields, err := tupleFields(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+	t := make(txvm.Tuple, 0, len(fields))
+	for _, f := range fields {
+		d, err := marshalValue(rv.Field(f.index), path+"."+f.name)
+		if err != nil {
+			return nil, err
+		}
+		t = append(t, d)
+	}
+	return t, nil
+}
+
+func marshalValue(rv reflect.Value, path string) (txvm.Data, error) {
+	typ := rv.Type()
+	switch {
+	case typ == hashType:
+		h := rv.Interface().(bc.Hash)
+		return txvm.Bytes(h.Bytes()), nil
+
+	case typ.Implements(dataType):
+		if typ.Kind() == reflect.Interface && rv.IsNil() {
+			return nil, errors.WithDetailf(ErrUnsupported, "%s: nil txvm.Data", path)
+		}
+		return rv.Interface().(txvm.Data), nil
+	}
+
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return txvm.Int(rv.Int()), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u := rv.Uint()
+		if u > math.MaxInt64 {
+			return nil, errors.WithDetailf(ErrUnsupported, "%s: %d out of range for txvm.Int", path, u)
+		}
+		return txvm.Int(u), nil
+
+	case reflect.String:
+		return txvm.Bytes(rv.String()), nil
+
+	case reflect.Array:
+		if typ.Elem().Kind() != reflect.Uint8 {
+			break
+		}
+		b := make(txvm.Bytes, rv.Len())
+		reflect.Copy(reflect.ValueOf(b), rv)
+		return b, nil
+
+	case reflect.Slice:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return txvm.Bytes(append([]byte(nil), rv.Bytes()...)), nil
+		}
+		t := make(txvm.Tuple, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			d, err := marshalValue(rv.Index(i), fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			t = append(t, d)
+		}
+		return t, nil
+
+	case reflect.Struct:
+		return marshalStruct(rv, path)
+
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return nil, errors.WithDetailf(ErrUnsupported, "%s: nil pointer", path)
+		}
+		return marshalValue(rv.Elem(), path)
+	}
+	return nil, errors.WithDetailf(ErrUnsupported, "%s: cannot marshal %s", path, typ)
+}
+
+func unmarshalStruct(t txvm.Tuple, rv reflect.Value, path string) error {
+	fields, err := tupleFields(rv.Type())
+	if err != nil {
+		return err
+	}
+	if len(t) != len(fields) {
+		return errors.WithDetailf(ErrMismatch, "%s: want tuple of length %d, got %s", path, len(fields), describe(t))
+	}
+	for i, f := range fields {
+		err := unmarshalValue(t[i], rv.Field(f.index), path+"."+f.name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unmarshalValue(d txvm.Data, rv reflect.Value, path string) error {
+	typ := rv.Type()
+	mismatch := func(want string) error {
+		return errors.WithDetailf(ErrMismatch, "%s: want %s, got %s", path, want, describe(d))
+	}
+	if d == nil {
+		// A Tuple built by hand may hold a nil item.
+		return mismatch("item")
+	}
+
+	switch {
+	case typ == hashType:
+		b, ok := d.(txvm.Bytes)
+		if !ok || len(b) != 32 {
+			return mismatch("32-byte hash")
+		}
+		rv.Set(reflect.ValueOf(bc.HashFromBytes(b)))
+		return nil
+
+	case typ == pubkeyType:
+		b, ok := d.(txvm.Bytes)
+		if !ok || len(b) != ed25519.PublicKeySize {
+			return mismatch(fmt.Sprintf("%d-byte public key", ed25519.PublicKeySize))
+		}
+		rv.Set(reflect.ValueOf(ed25519.PublicKey(append([]byte(nil), b...))))
+		return nil
+
+	case typ.Kind() == reflect.Interface && typ.Implements(dataType):
+		rv.Set(reflect.ValueOf(d))
+		return nil
+
+	case typ.Implements(dataType):
+		if reflect.TypeOf(d) != typ {
+			return mismatch(typ.String())
+		}
+		rv.Set(reflect.ValueOf(d))
+		return nil
+	}
+
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := d.(txvm.Int)
+		if !ok {
+			return mismatch("int")
+		}
+		if rv.OverflowInt(int64(n)) {
+			return mismatch(fmt.Sprintf("int in range for %s", typ))
+		}
+		rv.SetInt(int64(n))
+		return nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := d.(txvm.Int)
+		if !ok {
+			return mismatch("int")
+		}
+		if n < 0 || rv.OverflowUint(uint64(n)) {
+			return mismatch(fmt.Sprintf("int in range for %s", typ))
+		}
+		rv.SetUint(uint64(n))
+		return nil
+
+	case reflect.String:
+		b, ok := d.(txvm.Bytes)
+		if !ok {
+			return mismatch("bytes")
+		}
+		rv.SetString(string(b))
+		return nil
+
+	case reflect.Array:
+		if typ.Elem().Kind() != reflect.Uint8 {
+			break
+		}
+		b, ok := d.(txvm.Bytes)
+		if !ok || len(b) != rv.Len() {
+			return mismatch(fmt.Sprintf("%d bytes", rv.Len()))
+		}
+		reflect.Copy(rv, reflect.ValueOf(b))
+		return nil
+
+	case reflect.Slice:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			b, ok := d.(txvm.Bytes)
+			if !ok {
+				return mismatch("bytes")
+			}
+			rv.Set(reflect.ValueOf(append([]byte(nil), b...)).Convert(typ))
+			return nil
+		}
+		t, ok := d.(txvm.Tuple)
+		if !ok {
+			return mismatch("tuple")
+		}
+		s := reflect.MakeSlice(typ, len(t), len(t))
+		for i, item := range t {
+			err := unmarshalValue(item, s.Index(i), fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return err
+			}
+		}
+		rv.Set(s)
+		return nil
+
+	case reflect.Struct:
+		t, ok := d.(txvm.Tuple)
+		if !ok {
+			return mismatch("tuple")
+		}
+		return unmarshalStruct(t, rv, path)
+
+	case reflect.Ptr:
+		p := reflect.New(typ.Elem())
+		err := unmarshalValue(d, p.Elem(), path)
+		if err != nil {
+			return err
+		}
+		rv.Set(p)
+		return nil
+	}
+	return errors.WithDetailf(ErrUnsupported, "%s: cannot unmarshal into %s", path, typ)
+}
+
+// describe describes d for error messages.
+func describe(d txvm.Data) string {
+	switch d := d.(type) {
+	case txvm.Int:
+		return fmt.Sprintf("int %d", d)
+	case txvm.Bytes:
+		return fmt.Sprintf("%d bytes", len(d))
+	case txvm.Tuple:
+		var types []string
+		for _, item := range d {
+			switch item.(type) {
+			case txvm.Int:
+				types = append(types, "int")
+			case txvm.Bytes:
+				types = append(types, "bytes")
+			case txvm.Tuple:
+				types = append(types, "tuple")
+			}
+		}
+		return fmt.Sprintf("tuple of length %d {%s}", len(d), strings.Join(types, ", "))
+	}
+	if d == nil {
+		return "nil"
+	}
+	return fmt.Sprintf("%T", d)
+}
@@ -0,0 +1,122 @@
+package txvmutil
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chain/txvm/crypto/ed25519"
+	"github.com/chain/txvm/errors"
+	"github.com/chain/txvm/protocol/bc"
+	"github.com/chain/txvm/protocol/txvm"
+	"github.com/chain/txvm/testutil"
+)
+
+type testValue struct {
+	Code    [1]byte `txvm:"0"`
+	Amount  uint64  `txvm:"1"`
+	AssetID bc.Hash `txvm:"2"`
+	Anchor  []byte  `txvm:"3"`
+}
+
+type testOutput struct {
+	Quorum  int                 `txvm:"0"`
+	Pubkeys []ed25519.PublicKey `txvm:"1"`
+	Value   *testValue          `txvm:"2"`
+	Extra   txvm.Data           `txvm:"4"`
+	Tag     string              `txvm:"3"`
+	Ignored int
+}
+
+func TestMarshal(t *testing.T) {
+	assetID := bc.HashFromBytes([]byte("assetid-assetid-assetid-assetid!"))
+	out := testOutput{
+		Quorum:  1,
+		Pubkeys: []ed25519.PublicKey{testutil.TestPub},
+		Value: &testValue{
+			Code:    [1]byte{txvm.ValueCode},
+			Amount:  100,
+			AssetID: assetID,
+			Anchor:  []byte("anchor"),
+		},
+		Extra:   txvm.Tuple{txvm.Int(-1)},
+		Tag:     "tag",
+		Ignored: 7,
+	}
+	want := txvm.Tuple{
+		txvm.Int(1),
+		txvm.Tuple{txvm.Bytes(testutil.TestPub)},
+		txvm.Tuple{txvm.Bytes{txvm.ValueCode}, txvm.Int(100), txvm.Bytes(assetID.Bytes()), txvm.Bytes("anchor")},
+		txvm.Bytes("tag"),
+		txvm.Tuple{txvm.Int(-1)},
+	}
+	got, err := Marshal(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Marshal got %s, want %s", got, want)
+	}
+
+	var back testOutput
+	err = Unmarshal(got, &back)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Ignored = 0
+	if !reflect.DeepEqual(back, out) {
+		t.Errorf("Unmarshal got %+v, want %+v", back, out)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	value := func(amount, assetID txvm.Data) txvm.Tuple {
+		return txvm.Tuple{
+			txvm.Int(1),
+			txvm.Tuple{},
+			txvm.Tuple{txvm.Bytes{txvm.ValueCode}, amount, assetID, txvm.Bytes{}},
+			txvm.Bytes{},
+			txvm.Int(0),
+		}
+	}
+	hash := txvm.Bytes(make([]byte, 32))
+	withNil := value(txvm.Int(1), hash)
+	withNil[4] = nil
+	cases := []struct {
+		tuple txvm.Tuple
+		want  string
+	}{
+		{txvm.Tuple{txvm.Int(1)}, "txvmutil.testOutput: want tuple of length 5, got tuple of length 1 {int}"},
+		{value(txvm.Int(-1), hash), "txvmutil.testOutput.Value.Amount: want int in range for uint64, got int -1"},
+		{value(txvm.Bytes{}, hash), "txvmutil.testOutput.Value.Amount: want int, got 0 bytes"},
+		{value(txvm.Int(1), hash[:31]), "txvmutil.testOutput.Value.AssetID: want 32-byte hash, got 31 bytes"},
+		{
+			txvm.Tuple{txvm.Int(1), txvm.Tuple{txvm.Bytes("short")}, txvm.Tuple{}, txvm.Bytes{}, txvm.Int(0)},
+			"txvmutil.testOutput.Pubkeys[0]: want 32-byte public key, got 5 bytes",
+		},
+		{withNil, "txvmutil.testOutput.Extra: want item, got nil"},
+	}
+	for _, c := range cases {
+		var out testOutput
+		err := Unmarshal(c.tuple, &out)
+		if errors.Root(err) != ErrMismatch {
+			t.Errorf("Unmarshal(%s) error = %v, want %s", c.tuple, err, ErrMismatch)
+			continue
+		}
+		if got := errors.Detail(err); !strings.Contains(got, c.want) {
+			t.Errorf("Unmarshal(%s) error detail = %q, want %q", c.tuple, got, c.want)
+		}
+	}
+
+	var notStruct int
+	if err := Unmarshal(txvm.Tuple{}, &notStruct); errors.Root(err) != ErrUnsupported {
+		t.Errorf("Unmarshal into *int: got error %v, want %s", err, ErrUnsupported)
+	}
+	var gap struct {
+		A int `txvm:"0"`
+		B int `txvm:"2"`
+	}
+	if _, err := Marshal(gap); errors.Root(err) != ErrUnsupported {
+		t.Errorf("Marshal with a gap in positions: got error %v, want %s", err, ErrUnsupported)
+	}
+}
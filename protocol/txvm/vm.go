@@ -1,6 +1,7 @@
 package txvm
 
 import (
+	"github.com/chain/txvm/crypto/ed25519"
 	"github.com/chain/txvm/errors"
 	"github.com/chain/txvm/math/checked"
 	"github.com/chain/txvm/protocol/txvm/op"
@@ -12,6 +13,7 @@ import (
 type run struct {
 	pc   int64
 	prog []byte
+	dec  *decodedProg
 }
 
 // VM is a virtual machine for executing Chain Protocol transactions.
@@ -21,11 +23,15 @@ type VM struct {
 	runlimit          int64
 	extension         bool
 	stopAfterFinalize bool
+	deferredSigs      *ed25519.ConcurrentVerifier
+	extFuncs          map[string]ExtFunc
+	checkSigSchemes   map[string]checkSigScheme
 	onFinalize        []func(*VM)
 	onLog             []func(*VM)
 	beforeStep        []func(*VM)
 	afterStep         []func(*VM)
 	onExit            []func(*VM)
+	onCharge          []func(*VM, int64)
 
 	// Runtime fields
 	argstack  stack
@@ -43,7 +49,8 @@ type VM struct {
 	// Finalized is true.
 	TxID [32]byte
 
-	// Log is the record of the transaction's effects.
+	// Log is the record of the transaction's effects. Like all
+	// items, its Bytes must not be modified (see Bytes).
 	Log []Tuple
 
 	// Finalized is true if and only if the finalize instruction was
@@ -126,15 +133,22 @@ func (vm *VM) validate(txprog []byte) (err error) {
 		return vm.wraperr(ErrRunlimit)
 	}
 
-	vm.exec(txprog)
+	vm.execDecoded(txprog, decodeProg(txprog, false))
 
 	if !vm.stopAfterFinalize && (!vm.contract.stack.isEmpty() || !vm.argstack.isEmpty()) {
 		return vm.wraperr(ErrResidue)
 	}
-	return nil
+	return vm.verifyDeferredSigs()
 }
 
+// exec runs prog, a contract program or one run by the exec
+// instruction. These are often run many times, so their decodings
+// are cached.
 func (vm *VM) exec(prog []byte) {
+	vm.execDecoded(prog, progCache.get(prog))
+}
+
+func (vm *VM) execDecoded(prog []byte, dec *decodedProg) {
 	if len(vm.run.prog) > 0 {
 		vm.runstack = append(vm.runstack, vm.run)
 		defer func() {
@@ -143,6 +157,7 @@ func (vm *VM) exec(prog []byte) {
 		}()
 	}
 	vm.run.prog = prog
+	vm.run.dec = dec
 	vm.run.pc = 0
 	for vm.run.pc < int64(len(vm.run.prog)) {
 		if vm.unwinding {
@@ -156,30 +171,30 @@ func (vm *VM) exec(prog []byte) {
 }
 
 func (vm *VM) step() {
-	opcode, data, n, err := op.DecodeInst(vm.run.prog[vm.run.pc:])
-	if err != nil {
-		panic(vmError(err))
-	}
-	vm.opcode = opcode
-	vm.data = data
+	in := vm.run.dec.inst(vm.run.pc)
+	vm.opcode = in.opcode
+	vm.data = in.data
 	vm.runHooks(vm.beforeStep)
 	vm.charge(1)
-	vm.run.pc += n
+	vm.run.pc += in.n
 	switch {
-	case op.IsSmallIntOp(opcode):
-		vm.push(Int(opcode - op.MinSmallInt))
-	case op.IsPushdataOp(opcode):
-		d := Bytes(data)
+	case op.IsSmallIntOp(in.opcode):
+		vm.push(Int(in.opcode - op.MinSmallInt))
+	case op.IsPushdataOp(in.opcode):
+		d := Bytes(vm.data)
 		vm.chargeCreate(d)
 		vm.push(d)
 	default:
-		f := opFuncs[opcode]
+		f := opFuncs[in.opcode]
 		f(vm)
 	}
 	vm.runHooks(vm.afterStep)
 }
 
 func (vm *VM) charge(n int64) {
+	for _, h := range vm.onCharge {
+		h(vm, n)
+	}
 	vm.runlimit -= n
 	if vm.runlimit < 0 {
 		panic(ErrRunlimit)